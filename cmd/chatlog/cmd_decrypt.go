@@ -2,9 +2,10 @@ package chatlog
 
 import (
 	"fmt"
-	"runtime"
+	"os"
 
 	"github.com/sjzar/chatlog/internal/chatlog"
+	"github.com/sjzar/chatlog/internal/chatlog/wechat"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -15,8 +16,9 @@ func init() {
 	decryptCmd.Flags().StringVarP(&dataDir, "data-dir", "d", "", "data dir")
 	decryptCmd.Flags().StringVarP(&workDir, "work-dir", "w", "", "work dir")
 	decryptCmd.Flags().StringVarP(&key, "key", "k", "", "key")
-	decryptCmd.Flags().StringVarP(&decryptPlatform, "platform", "p", runtime.GOOS, "platform")
-	decryptCmd.Flags().IntVarP(&decryptVer, "version", "v", 3, "version")
+	decryptCmd.Flags().StringVarP(&decryptPlatform, "platform", "p", "auto", "platform: windows, darwin or auto")
+	decryptCmd.Flags().IntVarP(&decryptVer, "version", "v", 0, "version: 3, 4 or 0 for auto")
+	decryptCmd.Flags().IntVarP(&decryptWorkers, "workers", "j", 0, "number of files decrypted in parallel, 0 for CPU count")
 }
 
 var (
@@ -25,6 +27,7 @@ var (
 	key             string
 	decryptPlatform string
 	decryptVer      int
+	decryptWorkers  int
 )
 
 var decryptCmd = &cobra.Command{
@@ -36,10 +39,18 @@ var decryptCmd = &cobra.Command{
 			log.Err(err).Msg("failed to create chatlog instance")
 			return
 		}
-		if err := m.CommandDecrypt(dataDir, workDir, key, decryptPlatform, decryptVer); err != nil {
+		var last *wechat.DecryptProgress
+		progress := func(p *wechat.DecryptProgress) {
+			fmt.Fprintf(os.Stderr, "\r%s", p)
+			last = p
+		}
+		if err := m.CommandDecrypt(dataDir, workDir, key, decryptPlatform, decryptVer, decryptWorkers, progress); err != nil {
 			log.Err(err).Msg("failed to decrypt")
 			return
 		}
+		if last != nil {
+			fmt.Fprintln(os.Stderr)
+		}
 		fmt.Println("decrypt success")
 	},
 }
@@ -0,0 +1,47 @@
+package chatlog
+
+import (
+	"fmt"
+
+	"github.com/sjzar/chatlog/internal/chatlog"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(encryptCmd)
+	encryptCmd.Flags().StringVarP(&encryptInput, "input", "i", "", "plain database file")
+	encryptCmd.Flags().StringVarP(&encryptOutput, "output", "o", "", "encrypted database file")
+	encryptCmd.Flags().StringVarP(&key, "key", "k", "", "key")
+	encryptCmd.Flags().StringVar(&encryptOriginal, "original", "", "original encrypted database, used for salt and platform detection")
+	encryptCmd.Flags().StringVar(&encryptSalt, "salt", "", "salt in hex, required if original is not set")
+	encryptCmd.Flags().StringVarP(&encryptPlatform, "platform", "p", "auto", "platform: windows, darwin or auto")
+	encryptCmd.Flags().IntVarP(&encryptVer, "version", "v", 0, "version: 3, 4 or 0 for auto")
+}
+
+var (
+	encryptInput    string
+	encryptOutput   string
+	encryptOriginal string
+	encryptSalt     string
+	encryptPlatform string
+	encryptVer      int
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "encrypt a plain database back to WeChat format",
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := chatlog.New("")
+		if err != nil {
+			log.Err(err).Msg("failed to create chatlog instance")
+			return
+		}
+		if err := m.CommandEncrypt(encryptInput, encryptOutput, key, encryptOriginal, encryptSalt, encryptPlatform, encryptVer); err != nil {
+			log.Err(err).Msg("failed to encrypt")
+			return
+		}
+		fmt.Println("encrypt success")
+	},
+}
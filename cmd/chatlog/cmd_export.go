@@ -0,0 +1,47 @@
+package chatlog
+
+import (
+	"github.com/sjzar/chatlog/internal/chatlog"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&exportDataDir, "data-dir", "d", "", "data dir")
+	exportCmd.Flags().StringVarP(&exportWorkDir, "work-dir", "w", "", "work dir")
+	exportCmd.Flags().StringVarP(&exportPlatform, "platform", "p", "auto", "platform: windows, darwin or auto")
+	exportCmd.Flags().IntVarP(&exportVer, "version", "v", 0, "version: 3, 4 or 0 for auto")
+	exportCmd.Flags().StringVar(&exportTalker, "talker", "", "talker, multiple talkers separated by commas")
+	exportCmd.Flags().StringVar(&exportTime, "time", "", "time range, default all")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "html", "export format: html, md, jsonl")
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "output dir")
+}
+
+var (
+	exportDataDir  string
+	exportWorkDir  string
+	exportPlatform string
+	exportVer      int
+	exportTalker   string
+	exportTime     string
+	exportFormat   string
+	exportOut      string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export --talker <talker> --out <dir>",
+	Short: "Export chat history",
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := chatlog.New("")
+		if err != nil {
+			log.Err(err).Msg("failed to create chatlog instance")
+			return
+		}
+		if err := m.CommandExport(exportDataDir, exportWorkDir, exportPlatform, exportVer, exportTalker, exportTime, exportFormat, exportOut); err != nil {
+			log.Err(err).Msg("failed to export")
+			return
+		}
+	},
+}
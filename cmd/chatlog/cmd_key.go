@@ -2,8 +2,10 @@ package chatlog
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/sjzar/chatlog/internal/chatlog"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -12,9 +14,22 @@ import (
 func init() {
 	rootCmd.AddCommand(keyCmd)
 	keyCmd.Flags().IntVarP(&pid, "pid", "p", 0, "pid")
+	keyCmd.Flags().StringVar(&fromDump, "from-dump", "", "memory dump file (.bin or .zip) created by dumpmemory")
+	keyCmd.Flags().StringVarP(&keyDataDir, "data-dir", "d", "", "data dir used to validate key")
+	keyCmd.Flags().StringVar(&keyPlatform, "platform", "auto", "platform: windows, darwin or auto")
+	keyCmd.Flags().IntVar(&keyVersion, "version", 0, "version: 3, 4 or 0 for auto")
+	keyCmd.Flags().BoolVar(&keyScan, "scan", false, "brute-force scan memory when key patterns are not found, may take minutes")
 }
 
-var pid int
+var (
+	pid         int
+	fromDump    string
+	keyDataDir  string
+	keyPlatform string
+	keyVersion  int
+	keyScan     bool
+)
+
 var keyCmd = &cobra.Command{
 	Use:   "key",
 	Short: "key",
@@ -24,7 +39,20 @@ var keyCmd = &cobra.Command{
 			log.Err(err).Msg("failed to create chatlog instance")
 			return
 		}
-		ret, err := m.CommandKey(pid)
+		scanned := false
+		progress := func(p *scan.Progress) {
+			fmt.Fprintf(os.Stderr, "\r%s", p)
+			scanned = true
+		}
+		var ret string
+		if fromDump != "" {
+			ret, err = m.CommandKeyFromDump(fromDump, keyDataDir, keyPlatform, keyVersion, keyScan, progress)
+		} else {
+			ret, err = m.CommandKey(pid, keyScan, progress)
+		}
+		if scanned {
+			fmt.Fprintln(os.Stderr)
+		}
 		if err != nil {
 			log.Err(err).Msg("failed to get key")
 			return
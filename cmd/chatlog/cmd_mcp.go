@@ -0,0 +1,47 @@
+package chatlog
+
+import (
+	"fmt"
+
+	"github.com/sjzar/chatlog/internal/chatlog"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+	mcpCmd.Flags().BoolVar(&mcpStdio, "stdio", false, "use stdio transport")
+	mcpCmd.Flags().StringVarP(&mcpDataDir, "data-dir", "d", "", "data dir")
+	mcpCmd.Flags().StringVarP(&mcpWorkDir, "work-dir", "w", "", "work dir")
+	mcpCmd.Flags().StringVarP(&mcpPlatform, "platform", "p", "auto", "platform: windows, darwin or auto")
+	mcpCmd.Flags().IntVarP(&mcpVer, "version", "v", 0, "version: 3, 4 or 0 for auto")
+}
+
+var (
+	mcpStdio    bool
+	mcpDataDir  string
+	mcpWorkDir  string
+	mcpPlatform string
+	mcpVer      int
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp --stdio",
+	Short: "Start MCP server",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !mcpStdio {
+			fmt.Println("only stdio transport is supported, use `chatlog mcp --stdio`, or `chatlog server` for SSE")
+			return
+		}
+		m, err := chatlog.New("")
+		if err != nil {
+			log.Err(err).Msg("failed to create chatlog instance")
+			return
+		}
+		if err := m.CommandMCPStdio(mcpDataDir, mcpWorkDir, mcpPlatform, mcpVer); err != nil {
+			log.Err(err).Msg("failed to serve mcp")
+			return
+		}
+	},
+}
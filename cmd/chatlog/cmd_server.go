@@ -1,8 +1,6 @@
 package chatlog
 
 import (
-	"runtime"
-
 	"github.com/sjzar/chatlog/internal/chatlog"
 
 	"github.com/rs/zerolog/log"
@@ -14,8 +12,8 @@ func init() {
 	serverCmd.Flags().StringVarP(&serverAddr, "addr", "a", "127.0.0.1:5030", "server address")
 	serverCmd.Flags().StringVarP(&serverDataDir, "data-dir", "d", "", "data dir")
 	serverCmd.Flags().StringVarP(&serverWorkDir, "work-dir", "w", "", "work dir")
-	serverCmd.Flags().StringVarP(&serverPlatform, "platform", "p", runtime.GOOS, "platform")
-	serverCmd.Flags().IntVarP(&serverVer, "version", "v", 3, "version")
+	serverCmd.Flags().StringVarP(&serverPlatform, "platform", "p", "auto", "platform: windows, darwin or auto")
+	serverCmd.Flags().IntVarP(&serverVer, "version", "v", 0, "version: 3, 4 or 0 for auto")
 }
 
 var (
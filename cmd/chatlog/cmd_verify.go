@@ -0,0 +1,143 @@
+package chatlog
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sjzar/chatlog/internal/chatlog"
+	"github.com/sjzar/chatlog/internal/chatlog/wechat"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringVarP(&dataDir, "data-dir", "d", "", "data dir")
+	verifyCmd.Flags().StringVarP(&workDir, "work-dir", "w", "", "work dir")
+	verifyCmd.Flags().StringVarP(&key, "key", "k", "", "key")
+	verifyCmd.Flags().StringVarP(&verifyPlatform, "platform", "p", "auto", "platform: windows, darwin or auto")
+	verifyCmd.Flags().IntVarP(&verifyVer, "version", "v", 0, "version: 3, 4 or 0 for auto")
+	verifyCmd.Flags().BoolVar(&verifySalvage, "salvage", false, "decrypt again and zero-fill pages that fail HMAC verification")
+}
+
+var (
+	verifyPlatform string
+	verifyVer      int
+	verifySalvage  bool
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verify page HMACs and integrity of databases",
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := chatlog.New("")
+		if err != nil {
+			log.Err(err).Msg("failed to create chatlog instance")
+			return
+		}
+		progress := func(done int, total int, report *wechat.VerifyReport) {
+			fmt.Fprintf(os.Stderr, "\r%d/%d %s\033[K", done, total, report.Path)
+		}
+		reports, err := m.CommandVerify(dataDir, workDir, key, verifyPlatform, verifyVer, verifySalvage, progress)
+		if err != nil {
+			log.Err(err).Msg("failed to verify")
+			return
+		}
+		if len(reports) > 0 {
+			fmt.Fprintln(os.Stderr)
+		}
+		printVerifyReports(reports)
+	},
+}
+
+// printVerifyReports 输出校验结果汇总表，并列出未通过校验的文件的详细信息
+func printVerifyReports(reports []*wechat.VerifyReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tPAGES\tBAD PAGES\tINTEGRITY\tSTATUS")
+
+	failed := 0
+	for _, r := range reports {
+		pages, bad := "-", "-"
+		if r.Result != nil {
+			pages = strconv.FormatInt(r.Result.CheckedPages, 10)
+			bad = strconv.Itoa(len(r.Result.BadPages))
+		}
+		integrity := "-"
+		if len(r.Integrity) > 0 {
+			integrity = r.Integrity[0]
+			if len(r.Integrity) > 1 {
+				integrity = fmt.Sprintf("%d errors", len(r.Integrity))
+			}
+		}
+		if !r.OK() {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Path, pages, bad, integrity, verifyStatus(r))
+	}
+	w.Flush()
+
+	for _, r := range reports {
+		if r.OK() {
+			continue
+		}
+		var details []string
+		if r.Err != nil {
+			details = append(details, "error: "+r.Err.Error())
+		}
+		if r.Result != nil && len(r.Result.BadPages) > 0 {
+			details = append(details, "bad pages: "+formatPages(r.Result.BadPages))
+		}
+		if len(r.Integrity) > 0 && r.Integrity[0] != "ok" {
+			details = append(details, r.Integrity...)
+		}
+		if len(details) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s\n", r.Path)
+		for _, d := range details {
+			fmt.Printf("  %s\n", d)
+		}
+	}
+
+	fmt.Printf("\n%d files verified, %d with problems\n", len(reports), failed)
+}
+
+func verifyStatus(r *wechat.VerifyReport) string {
+	switch {
+	case r.Err != nil:
+		return "error"
+	case r.Result != nil && r.Result.AllBad():
+		return "all pages bad, wrong key or version?"
+	case r.Salvaged:
+		return "salvaged"
+	case r.Result != nil && len(r.Result.BadPages) > 0:
+		return "bad pages"
+	case len(r.Integrity) == 0:
+		return "not decrypted"
+	case !r.OK():
+		return "corrupted"
+	}
+	return "ok"
+}
+
+// formatPages 将升序的页号合并为区间，例如 3-5, 9
+func formatPages(pages []int64) string {
+	var parts []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.FormatInt(pages[i], 10))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/sjzar/chatlog/internal/chatlog/ctx"
+	cwechat "github.com/sjzar/chatlog/internal/chatlog/wechat"
 	"github.com/sjzar/chatlog/internal/ui/footer"
 	"github.com/sjzar/chatlog/internal/ui/form"
 	"github.com/sjzar/chatlog/internal/ui/help"
@@ -252,7 +253,12 @@ func (a *App) initMenu() {
 			// 在后台执行解密操作
 			go func() {
 				// 执行解密
-				err := a.m.DecryptDBFiles()
+				err := a.m.DecryptDBFiles(func(p *cwechat.DecryptProgress) {
+					text := "解密中...\n" + p.String()
+					a.QueueUpdateDraw(func() {
+						modal.SetText(text)
+					})
+				})
 
 				// 在主线程中更新UI
 				a.QueueUpdateDraw(func() {
@@ -580,8 +586,11 @@ func (a *App) settingDataKey() {
 
 	// 添加按钮 - 点击保存时才设置数据密钥
 	formView.AddButton("保存", func() {
-		a.ctx.DataKey = tempDataKey // 设置数据密钥
 		a.mainPages.RemovePage("submenu2")
+		if err := a.m.SetDataKey(tempDataKey); err != nil {
+			a.showError(fmt.Errorf("设置数据密钥失败: %v", err))
+			return
+		}
 		a.showInfo("数据密钥已设置")
 	})
 
@@ -608,8 +617,15 @@ func (a *App) settingDataDir() {
 
 	// 添加按钮 - 点击保存时才设置数据目录
 	formView.AddButton("保存", func() {
-		a.ctx.DataDir = tempDataDir // 设置数据目录
 		a.mainPages.RemovePage("submenu2")
+		if err := a.m.SetDataDir(tempDataDir); err != nil {
+			a.showError(fmt.Errorf("设置数据目录失败: %v", err))
+			return
+		}
+		if a.ctx.Current == nil {
+			a.showInfo(fmt.Sprintf("数据目录已设置为 %s\n识别为 %s %d.x 版本", a.ctx.DataDir, a.ctx.Platform, a.ctx.Version))
+			return
+		}
 		a.showInfo("数据目录已设置为 " + a.ctx.DataDir)
 	})
 
@@ -23,10 +23,16 @@ type ProcessConfig struct {
 	Files       []File `mapstructure:"files" json:"files"`
 }
 
+// File 已解密的数据文件，文件未变化时再次解密会跳过
 type File struct {
-	Path         string `mapstructure:"path" json:"path"`
+	Path         string `mapstructure:"path" json:"path"` // 相对数据目录的路径
 	ModifiedTime int64  `mapstructure:"modified_time" json:"modified_time"`
 	Size         int64  `mapstructure:"size" json:"size"`
+	Salt         string `mapstructure:"salt" json:"salt"` // 文件开头的盐值，十六进制
+
+	// WAL 文件中尚未写回数据库文件的页面会一并解密，WAL 变化时同样需要重新解密
+	WALModifiedTime int64 `mapstructure:"wal_modified_time" json:"wal_modified_time"`
+	WALSize         int64 `mapstructure:"wal_size" json:"wal_size"`
 }
 
 func (c *Config) ParseHistory() map[string]ProcessConfig {
@@ -1,6 +1,8 @@
 package ctx
 
 import (
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -30,6 +32,9 @@ type Context struct {
 	WorkDir   string
 	WorkUsage string
 
+	// 已解密的数据文件，key 为相对数据目录的路径
+	Files map[string]conf.File
+
 	// HTTP服务相关状态
 	HTTPEnabled bool
 	HTTPAddr    string
@@ -83,6 +88,10 @@ func (c *Context) SwitchHistory(account string) {
 		c.WorkDir = history.WorkDir
 		c.HTTPEnabled = history.HTTPEnabled
 		c.HTTPAddr = history.HTTPAddr
+		c.Files = make(map[string]conf.File, len(history.Files))
+		for _, f := range history.Files {
+			c.Files[f.Path] = f
+		}
 	} else {
 		c.Account = ""
 		c.Platform = ""
@@ -93,7 +102,24 @@ func (c *Context) SwitchHistory(account string) {
 		c.WorkDir = ""
 		c.HTTPEnabled = false
 		c.HTTPAddr = ""
+		c.Files = make(map[string]conf.File)
+	}
+}
+
+// SwitchDataDir 切换到使用该数据目录的历史账号，没有时以数据目录名称作为账号名称
+// 用于命令行解密，以便沿用历史账号中记录的数据文件信息
+func (c *Context) SwitchDataDir(dir string) {
+	for account, history := range c.History {
+		if history.DataDir == dir {
+			c.SwitchHistory(account)
+			return
+		}
 	}
+	c.SwitchHistory("")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Account = filepath.Base(dir)
+	c.DataDir = dir
 }
 
 func (c *Context) SwitchCurrent(info *wechat.Account) {
@@ -162,6 +188,48 @@ func (c *Context) SetDataDir(dir string) {
 	c.Refresh()
 }
 
+func (c *Context) SetDataKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.DataKey = key
+	c.UpdateConfig()
+}
+
+// SetOfflineDataDir 设置未连接微信进程时的数据目录，平台和版本由目录结构识别
+// 未指定账号时使用数据目录名称作为账号名称，以便保存到历史账号
+func (c *Context) SetOfflineDataDir(dir string, platform string, version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Account == "" {
+		c.Account = filepath.Base(dir)
+	}
+	c.Platform = platform
+	c.Version = version
+	c.DataDir = dir
+	c.DataUsage = ""
+	c.UpdateConfig()
+	c.Refresh()
+}
+
+// GetFile 返回上次解密数据文件时记录的文件信息
+func (c *Context) GetFile(path string) (conf.File, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	f, ok := c.Files[path]
+	return f, ok
+}
+
+// SetFile 记录已解密的数据文件并保存配置，中断后再次解密时跳过未变化的文件
+func (c *Context) SetFile(file conf.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Files == nil {
+		c.Files = make(map[string]conf.File)
+	}
+	c.Files[file.Path] = file
+	c.UpdateConfig()
+}
+
 func (c *Context) SetAutoDecrypt(enabled bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -182,7 +250,14 @@ func (c *Context) UpdateConfig() {
 		WorkDir:     c.WorkDir,
 		HTTPEnabled: c.HTTPEnabled,
 		HTTPAddr:    c.HTTPAddr,
+		Files:       make([]conf.File, 0, len(c.Files)),
+	}
+	for _, f := range c.Files {
+		pconf.Files = append(pconf.Files, f)
 	}
+	sort.Slice(pconf.Files, func(i, j int) bool {
+		return pconf.Files[i].Path < pconf.Files[j].Path
+	})
 	conf := c.conf.GetConfig()
 	conf.UpdateHistory(c.Account, pconf)
 }
@@ -1,21 +1,29 @@
 package database
 
 import (
+	"context"
 	"time"
 
 	"github.com/sjzar/chatlog/internal/chatlog/ctx"
 	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
 )
 
 type Service struct {
 	ctx *ctx.Context
 	db  *wechatdb.DB
+
+	// 数据库重新打开后需要重新设置的回调函数
+	callbacks map[string][]func(event fsnotify.Event) error
 }
 
 func NewService(ctx *ctx.Context) *Service {
 	return &Service{
-		ctx: ctx,
+		ctx:       ctx,
+		callbacks: make(map[string][]func(event fsnotify.Event) error),
 	}
 }
 
@@ -24,10 +32,26 @@ func (s *Service) Start() error {
 	if err != nil {
 		return err
 	}
+	for name, callbacks := range s.callbacks {
+		for _, callback := range callbacks {
+			if err := db.SetCallback(name, callback); err != nil {
+				log.Debug().Err(err).Msgf("set callback %s failed", name)
+			}
+		}
+	}
 	s.db = db
 	return nil
 }
 
+// SetCallback 设置数据库文件变更的回调函数，切换账号重新启动后仍然有效
+func (s *Service) SetCallback(name string, callback func(event fsnotify.Event) error) error {
+	s.callbacks[name] = append(s.callbacks[name], callback)
+	if s.db != nil {
+		return s.db.SetCallback(name, callback)
+	}
+	return nil
+}
+
 func (s *Service) Stop() error {
 	if s.db != nil {
 		s.db.Close()
@@ -40,25 +64,57 @@ func (s *Service) GetDB() *wechatdb.DB {
 	return s.db
 }
 
-func (s *Service) GetMessages(start, end time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
-	return s.db.GetMessages(start, end, talker, sender, keyword, limit, offset)
+func (s *Service) GetMessages(ctx context.Context, start, end time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
+	return s.db.GetMessages(ctx, start, end, talker, sender, keyword, limit, offset)
+}
+
+func (s *Service) GetMessagesByCursor(ctx context.Context, start, end time.Time, talker string, sender string, keyword string, cursor string, limit int) (*wechatdb.GetMessagesResp, error) {
+	return s.db.GetMessagesByCursor(ctx, start, end, talker, sender, keyword, cursor, limit)
+}
+
+func (s *Service) GetMessageContext(ctx context.Context, talker string, seq int64, before, after int) ([]*model.Message, error) {
+	return s.db.GetMessageContext(ctx, talker, seq, before, after)
+}
+
+func (s *Service) GetMessageContextByTime(ctx context.Context, talker string, t time.Time, before, after int) ([]*model.Message, error) {
+	return s.db.GetMessageContextByTime(ctx, talker, t, before, after)
+}
+
+func (s *Service) GetStats(ctx context.Context, start, end time.Time, talker string, sender string, top int) (*model.Stats, error) {
+	return s.db.GetStats(ctx, start, end, talker, sender, top)
+}
+
+func (s *Service) SearchMessages(ctx context.Context, start, end time.Time, talker string, sender string, keyword string, limit, offset int) (*wechatdb.SearchMessagesResp, error) {
+	return s.db.SearchMessages(ctx, start, end, talker, sender, keyword, limit, offset)
+}
+
+func (s *Service) GetContacts(ctx context.Context, key string, limit, offset int) (*wechatdb.GetContactsResp, error) {
+	return s.db.GetContacts(ctx, key, limit, offset)
+}
+
+func (s *Service) GetContactDetail(ctx context.Context, key string) (*model.ContactDetail, error) {
+	return s.db.GetContactDetail(ctx, key)
+}
+
+func (s *Service) Resolve(ctx context.Context, key string, talker string, limit int) ([]*model.Candidate, error) {
+	return s.db.Resolve(ctx, key, talker, limit)
 }
 
-func (s *Service) GetContacts(key string, limit, offset int) (*wechatdb.GetContactsResp, error) {
-	return s.db.GetContacts(key, limit, offset)
+func (s *Service) GetChatRooms(ctx context.Context, key string, limit, offset int) (*wechatdb.GetChatRoomsResp, error) {
+	return s.db.GetChatRooms(ctx, key, limit, offset)
 }
 
-func (s *Service) GetChatRooms(key string, limit, offset int) (*wechatdb.GetChatRoomsResp, error) {
-	return s.db.GetChatRooms(key, limit, offset)
+func (s *Service) GetChatRoomDetail(ctx context.Context, key string) (*model.ChatRoomDetail, error) {
+	return s.db.GetChatRoomDetail(ctx, key)
 }
 
 // GetSession retrieves session information
-func (s *Service) GetSessions(key string, limit, offset int) (*wechatdb.GetSessionsResp, error) {
-	return s.db.GetSessions(key, limit, offset)
+func (s *Service) GetSessions(ctx context.Context, key string, limit, offset int) (*wechatdb.GetSessionsResp, error) {
+	return s.db.GetSessions(ctx, key, limit, offset)
 }
 
-func (s *Service) GetMedia(_type string, key string) (*model.Media, error) {
-	return s.db.GetMedia(_type, key)
+func (s *Service) GetMedia(ctx context.Context, _type string, key string) (*model.Media, error) {
+	return s.db.GetMedia(ctx, _type, key)
 }
 
 // Close closes the database connection
@@ -0,0 +1,277 @@
+package export
+
+import (
+	"bufio"
+	"embed"
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// HTMLFile 导出 HTML 的文件名
+const HTMLFile = "index.html"
+
+//go:embed template
+var templateFS embed.FS
+
+var htmlTemplate = template.Must(template.ParseFS(templateFS, "template/chat.html"))
+
+// htmlWriter 将消息写入离线可浏览的 HTML 页面
+// 页面在写入第一条消息时生成头部，以获取聊天对象名称
+type htmlWriter struct {
+	file   *os.File
+	buf    *bufio.Writer
+	talker string
+	media  *mediaExporter
+
+	started bool
+	count   int
+	lastDay string
+}
+
+type htmlHeader struct {
+	Title      string
+	Talker     string
+	IsChatRoom bool
+}
+
+type htmlFooter struct {
+	Count      int
+	ExportTime string
+}
+
+// htmlMessage 一条消息气泡
+type htmlMessage struct {
+	Day     string // 与上一条消息不在同一天时显示日期分隔
+	Time    string
+	Sender  string
+	IsSelf  bool
+	System  bool
+	Content *htmlContent
+}
+
+// htmlContent 消息内容，引用和合并转发中的消息递归展开
+type htmlContent struct {
+	Text   string
+	Image  string
+	Video  string
+	Voice  string
+	Link   string
+	Title  string
+	Quote  *htmlQuote
+	Record *htmlRecord
+}
+
+type htmlQuote struct {
+	Sender  string
+	Content *htmlContent
+}
+
+type htmlRecord struct {
+	Title string
+	Items []*htmlRecordItem
+}
+
+type htmlRecordItem struct {
+	Sender  string
+	Time    string
+	Content *htmlContent
+}
+
+func newHTMLWriter(dir string, talker string, media *mediaExporter) (*htmlWriter, error) {
+	file, err := os.Create(filepath.Join(dir, HTMLFile))
+	if err != nil {
+		return nil, err
+	}
+	return &htmlWriter{
+		file:   file,
+		buf:    bufio.NewWriter(file),
+		talker: talker,
+		media:  media,
+	}, nil
+}
+
+func (w *htmlWriter) Write(m *model.Message) error {
+	if !w.started {
+		if err := w.header(m); err != nil {
+			return err
+		}
+	}
+
+	msg := &htmlMessage{
+		Time:    m.Time.Format("15:04:05"),
+		Sender:  senderName(m),
+		IsSelf:  m.IsSelf,
+		System:  m.Type == 10000,
+		Content: w.content(m),
+	}
+	if day := m.Time.Format("2006-01-02"); day != w.lastDay {
+		msg.Day = day
+		w.lastDay = day
+	}
+
+	w.count++
+	return htmlTemplate.ExecuteTemplate(w.buf, "message", msg)
+}
+
+func (w *htmlWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *htmlWriter) Close() error {
+	defer w.file.Close()
+
+	if !w.started {
+		if err := w.header(nil); err != nil {
+			return err
+		}
+	}
+
+	footer := &htmlFooter{
+		Count:      w.count,
+		ExportTime: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if err := htmlTemplate.ExecuteTemplate(w.buf, "footer", footer); err != nil {
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *htmlWriter) header(m *model.Message) error {
+	w.started = true
+	header := &htmlHeader{
+		Title:  w.talker,
+		Talker: w.talker,
+	}
+	if m != nil {
+		header.Talker = m.Talker
+		header.Title = m.Talker
+		if m.TalkerName != "" {
+			header.Title = m.TalkerName
+		}
+		header.IsChatRoom = m.IsChatRoom
+	}
+	return htmlTemplate.ExecuteTemplate(w.buf, "header", header)
+}
+
+// content 将消息转换为页面内容，媒体文件导出到媒体目录
+func (w *htmlWriter) content(m *model.Message) *htmlContent {
+	switch m.Type {
+	case 1, 10000:
+		return &htmlContent{Text: m.Content}
+	case 3:
+		if src := w.media.Image(contentKeys(m, "md5", "imgfile", "thumb")...); src != "" {
+			return &htmlContent{Image: src}
+		}
+		return &htmlContent{Text: "[图片]"}
+	case 34:
+		if src := w.media.Voice(contentString(m, "voice")); src != "" {
+			return &htmlContent{Voice: src}
+		}
+		return &htmlContent{Text: "[语音]"}
+	case 43:
+		if src := w.media.Video(contentKeys(m, "md5", "rawmd5", "videofile")...); src != "" {
+			return &htmlContent{Video: src}
+		}
+		// 视频文件不存在时显示封面
+		if src := w.media.Image(contentString(m, "thumb")); src != "" {
+			return &htmlContent{Image: src, Text: "[视频]"}
+		}
+		return &htmlContent{Text: "[视频]"}
+	case 49:
+		switch m.SubType {
+		case 5, 33, 36, 51:
+			url, title := contentString(m, "url"), contentString(m, "title")
+			if url == "" {
+				break
+			}
+			if title == "" {
+				title = url
+			}
+			return &htmlContent{Link: url, Title: title}
+		case 6:
+			title := contentString(m, "title")
+			if src := w.media.File(contentString(m, "md5")); src != "" {
+				return &htmlContent{Link: src, Title: "[文件|" + title + "]"}
+			}
+			return &htmlContent{Text: "[文件|" + title + "]"}
+		case 19:
+			if recordInfo, ok := m.Contents["recordInfo"].(*model.RecordInfo); ok {
+				return &htmlContent{Record: w.record(recordInfo, "")}
+			}
+		case 57:
+			c := &htmlContent{Text: m.Content}
+			if refer, ok := m.Contents["refer"].(*model.Message); ok {
+				c.Quote = &htmlQuote{
+					Sender:  senderName(refer),
+					Content: w.content(refer),
+				}
+			}
+			return c
+		}
+	}
+
+	// 其余消息使用纯文本描述
+	m.SetContent("host", "")
+	return &htmlContent{Text: m.PlainTextContent()}
+}
+
+// record 展开合并转发的聊天记录
+func (w *htmlWriter) record(r *model.RecordInfo, title string) *htmlRecord {
+	if title == "" {
+		title = r.Title
+	}
+	record := &htmlRecord{Title: title}
+	for _, item := range r.DataList.DataItems {
+		ri := &htmlRecordItem{
+			Sender: item.SourceName,
+			Time:   item.SourceTime,
+		}
+		switch {
+		case item.DataType == "17" && item.RecordXML != nil:
+			// 套娃合并转发
+			ri.Content = &htmlContent{Record: w.record(&item.RecordXML.RecordInfo, item.DataTitle)}
+		case item.DataFmt == "pic" || item.DataFmt == "jpg":
+			if src := w.media.Image(item.FullMD5); src != "" {
+				ri.Content = &htmlContent{Image: src}
+			} else {
+				ri.Content = &htmlContent{Text: "[图片]"}
+			}
+		default:
+			ri.Content = &htmlContent{Text: item.DataDesc}
+		}
+		record.Items = append(record.Items, ri)
+	}
+	return record
+}
+
+func senderName(m *model.Message) string {
+	if m.SenderName != "" {
+		return m.SenderName
+	}
+	if m.IsSelf {
+		return "我"
+	}
+	return m.Sender
+}
+
+func contentString(m *model.Message, key string) string {
+	s, _ := m.Contents[key].(string)
+	return s
+}
+
+func contentKeys(m *model.Message, keys ...string) []string {
+	list := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if s := contentString(m, key); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,52 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// JSONLFile 导出 JSON Lines 的文件名
+const JSONLFile = "messages.jsonl"
+
+// jsonlWriter 将消息以 JSON Lines 格式追加写入文件，每行一条消息
+// 引用消息、合并转发等内容随 Contents 完整输出
+type jsonlWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *json.Encoder
+}
+
+func newJSONLWriter(dir string) (*jsonlWriter, error) {
+	file, err := os.OpenFile(filepath.Join(dir, JSONLFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	return &jsonlWriter{
+		file: file,
+		buf:  buf,
+		enc:  enc,
+	}, nil
+}
+
+func (w *jsonlWriter) Write(m *model.Message) error {
+	return w.enc.Encode(m)
+}
+
+func (w *jsonlWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *jsonlWriter) Close() error {
+	defer w.file.Close()
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// MarkdownFile 导出 Markdown 的文件名
+const MarkdownFile = "messages.md"
+
+// mediaHost 生成 Markdown 时使用的占位 host，媒体链接随后替换为导出目录中的相对路径
+const mediaHost = "chatlog.export"
+
+var mediaLinkRegex = regexp.MustCompile(`\(http://` + regexp.QuoteMeta(mediaHost) + `/(image|video|voice|file)/([^)\s]*)\)`)
+
+// markdownWriter 将消息以 Markdown 格式追加写入文件
+type markdownWriter struct {
+	file   *os.File
+	buf    *bufio.Writer
+	talker string
+	media  *mediaExporter
+
+	// 文件为空时在第一条消息前写入标题
+	started bool
+}
+
+func newMarkdownWriter(dir string, talker string, media *mediaExporter) (*markdownWriter, error) {
+	file, err := os.OpenFile(filepath.Join(dir, MarkdownFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &markdownWriter{
+		file:    file,
+		buf:     bufio.NewWriter(file),
+		talker:  talker,
+		media:   media,
+		started: info.Size() > 0,
+	}, nil
+}
+
+func (w *markdownWriter) Write(m *model.Message) error {
+	if !w.started {
+		w.started = true
+		title := m.TalkerName
+		if title == "" {
+			title = m.Talker
+		}
+		if _, err := fmt.Fprintf(w.buf, "# %s\n\n", title); err != nil {
+			return err
+		}
+	}
+
+	text := w.replaceMediaLinks(m.PlainText(false, "2006-01-02 15:04:05", mediaHost))
+	header, content, _ := strings.Cut(strings.TrimRight(text, "\n"), "\n")
+
+	_, err := fmt.Fprintf(w.buf, "**%s**\n\n%s\n\n", header, markdownLines(content))
+	return err
+}
+
+// markdownLines 将消息内容中的换行转换为 Markdown 硬换行，引用块结束时插入空行
+func markdownLines(content string) string {
+	lines := strings.Split(content, "\n")
+	buf := strings.Builder{}
+	for i, line := range lines {
+		if i > 0 {
+			if strings.HasPrefix(lines[i-1], ">") && !strings.HasPrefix(line, ">") {
+				buf.WriteString("\n\n")
+			} else {
+				buf.WriteString("  \n")
+			}
+		}
+		buf.WriteString(line)
+	}
+	return buf.String()
+}
+
+// replaceMediaLinks 导出消息中的媒体文件，并将链接替换为相对路径，导出失败时移除链接
+func (w *markdownWriter) replaceMediaLinks(text string) string {
+	return mediaLinkRegex.ReplaceAllStringFunc(text, func(link string) string {
+		match := mediaLinkRegex.FindStringSubmatch(link)
+		keys := strings.Split(match[2], ",")
+
+		var src string
+		switch match[1] {
+		case "image":
+			src = w.media.Image(keys...)
+		case "video":
+			src = w.media.Video(keys...)
+		case "voice":
+			src = w.media.Voice(keys[0])
+		case "file":
+			src = w.media.File(keys...)
+		}
+		if src == "" {
+			return ""
+		}
+		return "(" + src + ")"
+	})
+}
+
+func (w *markdownWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *markdownWriter) Close() error {
+	defer w.file.Close()
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
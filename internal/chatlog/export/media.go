@@ -0,0 +1,182 @@
+package export
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sjzar/chatlog/internal/chatlog/database"
+	"github.com/sjzar/chatlog/pkg/util/dat2img"
+	"github.com/sjzar/chatlog/pkg/util/silk"
+
+	"github.com/rs/zerolog/log"
+)
+
+// mediaExporter 将消息中的媒体文件复制到导出目录，返回相对于导出目录的路径
+// 图片解码为原始格式，语音转换为 mp3，同一媒体只导出一次
+type mediaExporter struct {
+	dataDir string
+	db      *database.Service
+	dir     string
+
+	exported map[string]string
+}
+
+func newMediaExporter(dataDir string, db *database.Service, dir string) *mediaExporter {
+	return &mediaExporter{
+		dataDir:  dataDir,
+		db:       db,
+		dir:      dir,
+		exported: make(map[string]string),
+	}
+}
+
+// Image 导出图片，依次尝试 keys，返回第一个导出成功的路径，全部失败时返回空字符串
+func (e *mediaExporter) Image(keys ...string) string {
+	return e.export("image", keys, e.writeImage)
+}
+
+// Video 导出视频
+func (e *mediaExporter) Video(keys ...string) string {
+	return e.export("video", keys, e.copyFile)
+}
+
+// File 导出文件
+func (e *mediaExporter) File(keys ...string) string {
+	return e.export("file", keys, e.copyFile)
+}
+
+// Voice 导出语音，转换失败时保留 silk 格式
+func (e *mediaExporter) Voice(key string) string {
+	return e.export("voice", []string{key}, nil)
+}
+
+func (e *mediaExporter) export(_type string, keys []string, write func(src string) (string, error)) string {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		cacheKey := _type + ":" + key
+		if name, ok := e.exported[cacheKey]; ok {
+			if name == "" {
+				continue
+			}
+			return name
+		}
+
+		name, err := e.exportOne(_type, key, write)
+		if err != nil {
+			log.Debug().Err(err).Msgf("export %s failed: %s", _type, key)
+		}
+		e.exported[cacheKey] = name
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func (e *mediaExporter) exportOne(_type string, key string, write func(src string) (string, error)) (string, error) {
+	if err := os.MkdirAll(e.dir, 0755); err != nil {
+		return "", err
+	}
+
+	// 图片、视频和文件中非 MD5 的 key 为数据目录下的相对路径
+	if _type != "voice" && len(key) != 32 {
+		src := filepath.Join(e.dataDir, key)
+		if _, err := os.Stat(src); err != nil {
+			return "", err
+		}
+		return write(src)
+	}
+
+	media, err := e.db.GetMedia(context.Background(), _type, key)
+	if err != nil {
+		return "", err
+	}
+	if media.Type == "voice" {
+		return e.writeVoice(key, media.Data)
+	}
+	return write(filepath.Join(e.dataDir, media.Path))
+}
+
+// writeImage 写入图片，dat 文件解码后按实际格式保存
+func (e *mediaExporter) writeImage(src string) (string, error) {
+	if strings.ToLower(filepath.Ext(src)) != ".dat" {
+		return e.copyFile(src)
+	}
+
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	out, ext, err := dat2img.Dat2Image(b)
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src)) + "." + ext
+	return e.writeFile(e.mediaName(src, name), out)
+}
+
+// writeVoice 写入语音，转换为 mp3 格式
+func (e *mediaExporter) writeVoice(key string, data []byte) (string, error) {
+	out, err := silk.Silk2MP3(data)
+	if err != nil {
+		return e.writeFile(key+".silk", data)
+	}
+	return e.writeFile(key+".mp3", out)
+}
+
+func (e *mediaExporter) writeFile(name string, data []byte) (string, error) {
+	if err := os.WriteFile(filepath.Join(e.dir, name), data, 0644); err != nil {
+		return "", err
+	}
+	return MediaDir + "/" + name, nil
+}
+
+// mediaName 导出的文件名，以源文件路径的哈希作为前缀，不同目录中的同名文件不会互相覆盖
+func (e *mediaExporter) mediaName(src string, name string) string {
+	rel, err := filepath.Rel(e.dataDir, src)
+	if err != nil {
+		rel = src
+	}
+	sum := md5.Sum([]byte(filepath.ToSlash(rel)))
+	return hex.EncodeToString(sum[:8]) + "_" + name
+}
+
+// copyFile 复制文件，同一源文件已导出且大小相同时跳过
+func (e *mediaExporter) copyFile(src string) (string, error) {
+	name := e.mediaName(src, filepath.Base(src))
+	dst := filepath.Join(e.dir, name)
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && dstInfo.Size() == srcInfo.Size() {
+		return MediaDir + "/" + name, nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return MediaDir + "/" + name, nil
+}
@@ -0,0 +1,166 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/chatlog/ctx"
+	"github.com/sjzar/chatlog/internal/chatlog/database"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/pkg/util"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FormatHTML     = "html"
+	FormatMarkdown = "md"
+	FormatJSONL    = "jsonl"
+
+	// PageSize 导出时每次从数据库读取的消息数量
+	PageSize = 1000
+
+	// MediaDir 导出目录中存放媒体文件的子目录
+	MediaDir = "media"
+)
+
+// writer 将消息逐条写入导出文件
+type writer interface {
+	Write(m *model.Message) error
+	Flush() error
+	Close() error
+}
+
+// Service 聊天记录导出服务
+type Service struct {
+	ctx *ctx.Context
+	db  *database.Service
+}
+
+func NewService(ctx *ctx.Context, db *database.Service) *Service {
+	return &Service{
+		ctx: ctx,
+		db:  db,
+	}
+}
+
+// Export 导出聊天记录，每个聊天对象导出到 out 下的独立目录
+// talker 支持多个聊天对象，使用英文逗号分隔；timeRange 为空时导出全部时间
+func (s *Service) Export(ctx context.Context, talker string, timeRange string, format string, out string) error {
+	talkers := util.Str2List(talker, ",")
+	if len(talkers) == 0 {
+		return fmt.Errorf("talker is required")
+	}
+
+	if timeRange == "" {
+		timeRange = "all"
+	}
+	start, end, ok := util.TimeRangeOf(timeRange)
+	if !ok {
+		return fmt.Errorf("invalid time range: %s", timeRange)
+	}
+
+	if format == "" {
+		format = FormatHTML
+	}
+	switch format {
+	case FormatHTML, FormatMarkdown, FormatJSONL:
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	for _, t := range talkers {
+		dir := filepath.Join(out, dirName(t))
+		count, err := s.export(ctx, t, start, end, format, dir)
+		if err != nil {
+			return fmt.Errorf("export %s failed: %v", t, err)
+		}
+		log.Info().Msgf("exported %d messages of %s to %s", count, t, dir)
+	}
+	return nil
+}
+
+// export 导出单个聊天对象的聊天记录，按页读取消息并逐条写入，返回导出的消息数量
+// HTML 每次重新生成；Markdown 与 JSON Lines 为追加写入，只导出上次导出之后的新消息
+func (s *Service) export(ctx context.Context, talker string, start, end time.Time, format string, dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	var st *state
+	var err error
+	cursor := ""
+	if format != FormatHTML {
+		if st, err = loadState(dir, format); err != nil {
+			return 0, err
+		}
+		cursor = st.Cursor
+	}
+
+	media := newMediaExporter(s.ctx.DataDir, s.db, filepath.Join(dir, MediaDir))
+
+	var w writer
+	switch format {
+	case FormatHTML:
+		w, err = newHTMLWriter(dir, talker, media)
+	case FormatMarkdown:
+		w, err = newMarkdownWriter(dir, talker, media)
+	case FormatJSONL:
+		w, err = newJSONLWriter(dir)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for {
+		resp, err := s.db.GetMessagesByCursor(ctx, start, end, talker, "", "", cursor, PageSize)
+		if err != nil {
+			w.Close()
+			return count, err
+		}
+		for _, m := range resp.Items {
+			if err := w.Write(m); err != nil {
+				w.Close()
+				return count, err
+			}
+			count++
+		}
+
+		// 每页写入完成后记录导出进度，中断后再次导出时从此处继续
+		if st != nil && len(resp.Items) > 0 {
+			if err := w.Flush(); err != nil {
+				w.Close()
+				return count, err
+			}
+			st.Cursor = model.NewCursor(resp.Items[len(resp.Items)-1], 0).String()
+			st.Count += len(resp.Items)
+			if err := st.save(dir, format); err != nil {
+				w.Close()
+				return count, err
+			}
+		}
+
+		if resp.NextCursor == "" {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+
+	return count, w.Close()
+}
+
+// dirName 将聊天对象转换为可用作目录名的字符串
+func dirName(talker string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, talker)
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// StateFile 记录增量导出进度的文件，位于每个聊天对象的导出目录中
+const StateFile = ".export.json"
+
+// state 某种导出格式的导出进度
+type state struct {
+	Cursor string `json:"cursor"` // 最后一条已导出消息的游标
+	Count  int    `json:"count"`  // 已导出的消息数量
+}
+
+// outputFile 返回导出格式对应的文件名
+func outputFile(format string) string {
+	switch format {
+	case FormatMarkdown:
+		return MarkdownFile
+	case FormatJSONL:
+		return JSONLFile
+	default:
+		return HTMLFile
+	}
+}
+
+// loadState 读取导出进度，导出文件不存在时从头开始导出
+func loadState(dir string, format string) (*state, error) {
+	if _, err := os.Stat(filepath.Join(dir, outputFile(format))); os.IsNotExist(err) {
+		return &state{}, nil
+	}
+
+	states, err := readStates(dir)
+	if err != nil {
+		return nil, err
+	}
+	if st, ok := states[format]; ok {
+		return st, nil
+	}
+	return &state{}, nil
+}
+
+func (st *state) save(dir string, format string) error {
+	states, err := readStates(dir)
+	if err != nil {
+		return err
+	}
+	states[format] = st
+
+	b, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, StateFile), b, 0644)
+}
+
+func readStates(dir string) (map[string]*state, error) {
+	states := make(map[string]*state)
+	b, err := os.ReadFile(filepath.Join(dir, StateFile))
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"encoding/csv"
+	"strconv"
+	"strings"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/pkg/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// utf8BOM 写在 CSV 开头，使 Excel 以 UTF-8 编码打开文件
+const utf8BOM = "\ufeff"
+
+// csvColumn CSV 中的一列
+type csvColumn[T any] struct {
+	Name  string
+	Value func(T) string
+}
+
+// csvQuery CSV 输出的通用参数
+type csvQuery struct {
+	BOM     bool   `form:"bom"`     // 是否输出 UTF-8 BOM
+	Columns string `form:"columns"` // 输出的列，多个以英文逗号分隔，不区分大小写，默认输出全部列
+}
+
+var messageColumns = []csvColumn[*model.Message]{
+	{"Seq", func(m *model.Message) string { return strconv.FormatInt(m.Seq, 10) }},
+	{"Time", func(m *model.Message) string { return m.Time.Format("2006-01-02 15:04:05") }},
+	{"Talker", func(m *model.Message) string { return m.Talker }},
+	{"TalkerName", func(m *model.Message) string { return m.TalkerName }},
+	{"Sender", func(m *model.Message) string { return m.Sender }},
+	{"SenderName", func(m *model.Message) string { return m.SenderName }},
+	{"IsSelf", func(m *model.Message) string { return strconv.FormatBool(m.IsSelf) }},
+	{"Type", func(m *model.Message) string { return strconv.FormatInt(m.Type, 10) }},
+	{"SubType", func(m *model.Message) string { return strconv.FormatInt(m.SubType, 10) }},
+	{"Content", func(m *model.Message) string { return m.PlainTextContent() }},
+}
+
+var contactColumns = []csvColumn[*model.Contact]{
+	{"UserName", func(c *model.Contact) string { return c.UserName }},
+	{"Alias", func(c *model.Contact) string { return c.Alias }},
+	{"Remark", func(c *model.Contact) string { return c.Remark }},
+	{"NickName", func(c *model.Contact) string { return c.NickName }},
+}
+
+var chatRoomColumns = []csvColumn[*model.ChatRoom]{
+	{"Name", func(c *model.ChatRoom) string { return c.Name }},
+	{"Remark", func(c *model.ChatRoom) string { return c.Remark }},
+	{"NickName", func(c *model.ChatRoom) string { return c.NickName }},
+	{"Owner", func(c *model.ChatRoom) string { return c.Owner }},
+	{"UserCount", func(c *model.ChatRoom) string { return strconv.Itoa(len(c.Users)) }},
+}
+
+var sessionColumns = []csvColumn[*model.Session]{
+	{"UserName", func(s *model.Session) string { return s.UserName }},
+	{"NOrder", func(s *model.Session) string { return strconv.Itoa(s.NOrder) }},
+	{"NickName", func(s *model.Session) string { return s.NickName }},
+	{"Content", func(s *model.Session) string { return s.Content }},
+	{"NTime", func(s *model.Session) string { return s.NTime.Format("2006-01-02 15:04:05") }},
+}
+
+// selectColumns 按 columns 参数选择输出的列，未指定时返回全部列
+func selectColumns[T any](all []csvColumn[T], columns string) ([]csvColumn[T], error) {
+	names := util.Str2List(columns, ",")
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	selected := make([]csvColumn[T], 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, col := range all {
+			if strings.EqualFold(col.Name, strings.TrimSpace(name)) {
+				selected = append(selected, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.InvalidArg("columns")
+		}
+	}
+	return selected, nil
+}
+
+// writeCSV 以 RFC 4180 格式输出 CSV，包含表头
+// contentType 为空时使用 text/csv 并以 CRLF 换行，否则以 LF 换行便于终端查看
+func writeCSV[T any](c *gin.Context, all []csvColumn[T], items []T, contentType string) {
+	var q csvQuery
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	columns, err := selectColumns(all, q.Columns)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	useCRLF := contentType == ""
+	if useCRLF {
+		contentType = "text/csv; charset=utf-8"
+	}
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	if q.BOM {
+		c.Writer.WriteString(utf8BOM)
+	}
+
+	w := csv.NewWriter(c.Writer)
+	w.UseCRLF = useCRLF
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		record[i] = col.Name
+	}
+	w.Write(record)
+
+	for _, item := range items {
+		for i, col := range columns {
+			record[i] = col.Value(item)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	c.Writer.Flush()
+}
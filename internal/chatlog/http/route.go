@@ -8,8 +8,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/pkg/util"
 	"github.com/sjzar/chatlog/pkg/util/dat2img"
 	"github.com/sjzar/chatlog/pkg/util/silk"
@@ -17,6 +19,20 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// DefaultSearchLimit 全文检索未指定 limit 时返回的结果数量
+	DefaultSearchLimit = 20
+
+	// HeaderNextCursor 游标分页时返回下一页游标的响应头，没有更多消息时为空
+	HeaderNextCursor = "X-Next-Cursor"
+
+	// DefaultContextSize 消息上下文未指定 before/after 时返回的前后消息数量
+	DefaultContextSize = 10
+
+	// DefaultStatsTop 聊天统计未指定 top 时返回的发送者、聊天数量
+	DefaultStatsTop = 20
+)
+
 // EFS holds embedded file system data for static assets.
 //
 //go:embed static
@@ -45,14 +61,25 @@ func (s *Service) initRouter() {
 		// mcp inspector is shit
 		// https://github.com/modelcontextprotocol/inspector/blob/aeaf32f/server/src/index.ts#L155
 		router.POST("/message", s.mcp.HandleMessages)
+
+		// Streamable HTTP
+		router.POST("/mcp", s.mcp.HandleStreamable)
+		router.GET("/mcp", s.mcp.HandleStreamable)
+		router.DELETE("/mcp", s.mcp.HandleStreamable)
 	}
 
 	// API V1 Router
 	api := router.Group("/api/v1")
 	{
 		api.GET("/chatlog", s.GetChatlog)
+		api.GET("/chatlog/context", s.GetChatlogContext)
+		api.GET("/search", s.SearchMessages)
+		api.GET("/stats", s.GetStats)
 		api.GET("/contact", s.GetContacts)
+		api.GET("/contact/:username", s.GetContactDetail)
 		api.GET("/chatroom", s.GetChatRooms)
+		api.GET("/chatroom/:name", s.GetChatRoomDetail)
+		api.GET("/resolve", s.Resolve)
 		api.GET("/session", s.GetSessions)
 	}
 
@@ -81,6 +108,7 @@ func (s *Service) GetChatlog(c *gin.Context) {
 		Keyword string `form:"keyword"`
 		Limit   int    `form:"limit"`
 		Offset  int    `form:"offset"`
+		Cursor  string `form:"cursor"`
 		Format  string `form:"format"`
 	}{}
 
@@ -93,6 +121,7 @@ func (s *Service) GetChatlog(c *gin.Context) {
 	start, end, ok := util.TimeRangeOf(q.Time)
 	if !ok {
 		errors.Err(c, errors.InvalidArg("time"))
+		return
 	}
 	if q.Limit < 0 {
 		q.Limit = 0
@@ -102,16 +131,49 @@ func (s *Service) GetChatlog(c *gin.Context) {
 		q.Offset = 0
 	}
 
-	messages, err := s.db.GetMessages(start, end, q.Talker, q.Sender, q.Keyword, q.Limit, q.Offset)
-	if err != nil {
-		errors.Err(c, err)
-		return
+	// 指定 cursor 参数时使用游标分页，第一页传空值，之后传入上一页返回的 next_cursor
+	_, useCursor := c.GetQuery("cursor")
+
+	var messages []*model.Message
+	var nextCursor string
+	if useCursor {
+		resp, err := s.db.GetMessagesByCursor(c.Request.Context(), start, end, q.Talker, q.Sender, q.Keyword, q.Cursor, q.Limit)
+		if err != nil {
+			errors.Err(c, err)
+			return
+		}
+		messages, nextCursor = resp.Items, resp.NextCursor
+		c.Header(HeaderNextCursor, nextCursor)
+	} else {
+		messages, err = s.db.GetMessages(c.Request.Context(), start, end, q.Talker, q.Sender, q.Keyword, q.Limit, q.Offset)
+		if err != nil {
+			errors.Err(c, err)
+			return
+		}
 	}
 
+	// 未指定聊天对象时查询所有聊天，附带本页消息中各聊天的消息数量
+	allTalkers := q.Talker == ""
+
 	switch strings.ToLower(q.Format) {
 	case "csv":
+		for _, m := range messages {
+			m.SetContent("host", c.Request.Host)
+		}
+		writeCSV(c, messageColumns, messages, "")
 	case "json":
 		// json
+		if allTalkers || useCursor {
+			resp := gin.H{"items": messages}
+			if allTalkers {
+				resp["page_talkers"] = model.CountByTalker(messages)
+			}
+			if useCursor {
+				resp["next_cursor"] = nextCursor
+			}
+			c.JSON(http.StatusOK, resp)
+			return
+		}
 		c.JSON(http.StatusOK, messages)
 	default:
 		// plain text
@@ -120,17 +182,79 @@ func (s *Service) GetChatlog(c *gin.Context) {
 		c.Writer.Header().Set("Connection", "keep-alive")
 		c.Writer.Flush()
 
+		if allTalkers {
+			c.Writer.WriteString(talkerSummary(messages))
+		}
 		for _, m := range messages {
-			c.Writer.WriteString(m.PlainText(strings.Contains(q.Talker, ","), util.PerfectTimeFormat(start, end), c.Request.Host))
+			c.Writer.WriteString(m.PlainText(allTalkers || strings.Contains(q.Talker, ","), util.PerfectTimeFormat(start, end), c.Request.Host))
 			c.Writer.WriteString("\n")
 			c.Writer.Flush()
 		}
 	}
 }
 
-func (s *Service) GetContacts(c *gin.Context) {
+func (s *Service) GetChatlogContext(c *gin.Context) {
 
 	q := struct {
+		Talker string `form:"talker"`
+		Seq    int64  `form:"seq"`
+		Before *int   `form:"before"`
+		After  *int   `form:"after"`
+		Format string `form:"format"`
+	}{}
+
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	if q.Talker == "" {
+		errors.Err(c, errors.ErrTalkerEmpty)
+		return
+	}
+	if q.Seq <= 0 {
+		errors.Err(c, errors.InvalidArg("seq"))
+		return
+	}
+	before, after := contextSize(q.Before), contextSize(q.After)
+
+	messages, err := s.db.GetMessageContext(c.Request.Context(), q.Talker, q.Seq, before, after)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	switch strings.ToLower(q.Format) {
+	case "json":
+		c.JSON(http.StatusOK, messages)
+	default:
+		c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.Flush()
+
+		for _, m := range messages {
+			c.Writer.WriteString(m.PlainText(false, "2006-01-02 15:04:05", c.Request.Host))
+			c.Writer.WriteString("\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+// contextSize 消息上下文的前后消息数量，未指定时使用默认值
+func contextSize(n *int) int {
+	if n == nil {
+		return DefaultContextSize
+	}
+	return *n
+}
+
+func (s *Service) SearchMessages(c *gin.Context) {
+
+	q := struct {
+		Time    string `form:"time"`
+		Talker  string `form:"talker"`
+		Sender  string `form:"sender"`
 		Keyword string `form:"keyword"`
 		Limit   int    `form:"limit"`
 		Offset  int    `form:"offset"`
@@ -142,37 +266,145 @@ func (s *Service) GetContacts(c *gin.Context) {
 		return
 	}
 
-	list, err := s.db.GetContacts(q.Keyword, q.Limit, q.Offset)
+	if q.Keyword == "" {
+		errors.Err(c, errors.ErrKeywordEmpty)
+		return
+	}
+
+	// 未指定时间范围时检索全部消息
+	var start, end time.Time
+	if q.Time != "" {
+		var ok bool
+		start, end, ok = util.TimeRangeOf(q.Time)
+		if !ok {
+			errors.Err(c, errors.InvalidArg("time"))
+			return
+		}
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultSearchLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	resp, err := s.db.SearchMessages(c.Request.Context(), start, end, q.Talker, q.Sender, q.Keyword, q.Limit, q.Offset)
 	if err != nil {
 		errors.Err(c, err)
 		return
 	}
 
-	format := strings.ToLower(q.Format)
-	switch format {
+	switch strings.ToLower(q.Format) {
 	case "json":
-		// json
-		c.JSON(http.StatusOK, list)
+		c.JSON(http.StatusOK, resp)
 	default:
-		// csv
-		if format == "csv" {
-			// 浏览器访问时，会下载文件
-			c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
-		} else {
-			c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		}
+		c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		c.Writer.Header().Set("Cache-Control", "no-cache")
 		c.Writer.Header().Set("Connection", "keep-alive")
 		c.Writer.Flush()
 
-		c.Writer.WriteString("UserName,Alias,Remark,NickName\n")
-		for _, contact := range list.Items {
-			c.Writer.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", contact.UserName, contact.Alias, contact.Remark, contact.NickName))
+		c.Writer.WriteString(fmt.Sprintf("共 %d 条结果\n\n", resp.Total))
+		for _, item := range resp.Items {
+			c.Writer.WriteString(item.Message.PlainText(true, "2006-01-02 15:04:05", c.Request.Host))
+			c.Writer.WriteString("\n")
 		}
 		c.Writer.Flush()
 	}
 }
 
+func (s *Service) GetStats(c *gin.Context) {
+
+	q := struct {
+		Time   string `form:"time"`
+		Talker string `form:"talker"`
+		Sender string `form:"sender"`
+		Top    *int   `form:"top"`
+		Format string `form:"format"`
+	}{}
+
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	// 未指定时间范围时统计全部消息
+	if q.Time == "" {
+		q.Time = "all"
+	}
+	start, end, ok := util.TimeRangeOf(q.Time)
+	if !ok {
+		errors.Err(c, errors.InvalidArg("time"))
+		return
+	}
+	top := DefaultStatsTop
+	if q.Top != nil {
+		top = max(0, *q.Top)
+	}
+
+	stats, err := s.db.GetStats(c.Request.Context(), start, end, q.Talker, q.Sender, top)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	switch strings.ToLower(q.Format) {
+	case "json":
+		c.JSON(http.StatusOK, stats)
+	default:
+		c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.WriteString(stats.PlainText())
+		c.Writer.Flush()
+	}
+}
+
+// talkerSummary 本页消息中各聊天消息数量的文本摘要
+func talkerSummary(messages []*model.Message) string {
+	counts := model.CountByTalker(messages)
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("本页共 %d 条消息，来自 %d 个聊天\n", len(messages), len(counts)))
+	for _, c := range counts {
+		buf.WriteString(c.String())
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+func (s *Service) GetContacts(c *gin.Context) {
+
+	q := struct {
+		Keyword string `form:"keyword"`
+		Limit   int    `form:"limit"`
+		Offset  int    `form:"offset"`
+		Format  string `form:"format"`
+	}{}
+
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	list, err := s.db.GetContacts(c.Request.Context(), q.Keyword, q.Limit, q.Offset)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	format := strings.ToLower(q.Format)
+	switch format {
+	case "json":
+		// json
+		c.JSON(http.StatusOK, list)
+	case "csv":
+		// 浏览器访问时，会下载文件
+		writeCSV(c, contactColumns, list.Items, "")
+	default:
+		writeCSV(c, contactColumns, list.Items, "text/plain; charset=utf-8")
+	}
+}
+
 func (s *Service) GetChatRooms(c *gin.Context) {
 
 	q := struct {
@@ -187,7 +419,7 @@ func (s *Service) GetChatRooms(c *gin.Context) {
 		return
 	}
 
-	list, err := s.db.GetChatRooms(q.Keyword, q.Limit, q.Offset)
+	list, err := s.db.GetChatRooms(c.Request.Context(), q.Keyword, q.Limit, q.Offset)
 	if err != nil {
 		errors.Err(c, err)
 		return
@@ -197,22 +429,95 @@ func (s *Service) GetChatRooms(c *gin.Context) {
 	case "json":
 		// json
 		c.JSON(http.StatusOK, list)
+	case "csv":
+		// 浏览器访问时，会下载文件
+		writeCSV(c, chatRoomColumns, list.Items, "")
 	default:
-		// csv
-		if format == "csv" {
-			// 浏览器访问时，会下载文件
-			c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
-		} else {
-			c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		}
-		c.Writer.Header().Set("Cache-Control", "no-cache")
-		c.Writer.Header().Set("Connection", "keep-alive")
+		writeCSV(c, chatRoomColumns, list.Items, "text/plain; charset=utf-8")
+	}
+}
+
+func (s *Service) GetContactDetail(c *gin.Context) {
+
+	q := struct {
+		Format string `form:"format"`
+	}{}
+
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	detail, err := s.db.GetContactDetail(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	switch strings.ToLower(q.Format) {
+	case "json":
+		c.JSON(http.StatusOK, detail)
+	default:
+		c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.Writer.WriteString(detail.PlainText())
 		c.Writer.Flush()
+	}
+}
 
-		c.Writer.WriteString("Name,Remark,NickName,Owner,UserCount\n")
-		for _, chatRoom := range list.Items {
-			c.Writer.WriteString(fmt.Sprintf("%s,%s,%s,%s,%d\n", chatRoom.Name, chatRoom.Remark, chatRoom.NickName, chatRoom.Owner, len(chatRoom.Users)))
-		}
+func (s *Service) GetChatRoomDetail(c *gin.Context) {
+
+	q := struct {
+		Format string `form:"format"`
+	}{}
+
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	detail, err := s.db.GetChatRoomDetail(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	switch strings.ToLower(q.Format) {
+	case "json":
+		c.JSON(http.StatusOK, detail)
+	default:
+		c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.Writer.WriteString(detail.PlainText())
+		c.Writer.Flush()
+	}
+}
+
+// Resolve 按名称查找联系人、群聊或群成员，返回按匹配程度排序的候选列表
+func (s *Service) Resolve(c *gin.Context) {
+
+	q := struct {
+		Name   string `form:"name"`
+		Talker string `form:"talker"`
+		Limit  int    `form:"limit"`
+		Format string `form:"format"`
+	}{}
+
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	candidates, err := s.db.Resolve(c.Request.Context(), q.Name, q.Talker, q.Limit)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	switch strings.ToLower(q.Format) {
+	case "json":
+		c.JSON(http.StatusOK, candidates)
+	default:
+		c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.Writer.WriteString(model.CandidatesPlainText(candidates))
 		c.Writer.Flush()
 	}
 }
@@ -231,7 +536,7 @@ func (s *Service) GetSessions(c *gin.Context) {
 		return
 	}
 
-	sessions, err := s.db.GetSessions(q.Keyword, q.Limit, q.Offset)
+	sessions, err := s.db.GetSessions(c.Request.Context(), q.Keyword, q.Limit, q.Offset)
 	if err != nil {
 		errors.Err(c, err)
 		return
@@ -239,16 +544,7 @@ func (s *Service) GetSessions(c *gin.Context) {
 	format := strings.ToLower(q.Format)
 	switch format {
 	case "csv":
-		c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
-		c.Writer.Header().Set("Cache-Control", "no-cache")
-		c.Writer.Header().Set("Connection", "keep-alive")
-		c.Writer.Flush()
-
-		c.Writer.WriteString("UserName,NOrder,NickName,Content,NTime\n")
-		for _, session := range sessions.Items {
-			c.Writer.WriteString(fmt.Sprintf("%s,%d,%s,%s,%s\n", session.UserName, session.NOrder, session.NickName, strings.ReplaceAll(session.Content, "\n", "\\n"), session.NTime))
-		}
-		c.Writer.Flush()
+		writeCSV(c, sessionColumns, sessions.Items, "")
 	case "json":
 		// json
 		c.JSON(http.StatusOK, sessions)
@@ -303,7 +599,7 @@ func (s *Service) GetMedia(c *gin.Context, _type string) {
 			c.Redirect(http.StatusFound, "/data/"+k)
 			return
 		}
-		media, err := s.db.GetMedia(_type, k)
+		media, err := s.db.GetMedia(c.Request.Context(), _type, k)
 		if err != nil {
 			_err = err
 			continue
@@ -2,7 +2,10 @@ package chatlog
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -10,10 +13,16 @@ import (
 	"github.com/sjzar/chatlog/internal/chatlog/conf"
 	"github.com/sjzar/chatlog/internal/chatlog/ctx"
 	"github.com/sjzar/chatlog/internal/chatlog/database"
+	"github.com/sjzar/chatlog/internal/chatlog/export"
 	"github.com/sjzar/chatlog/internal/chatlog/http"
 	"github.com/sjzar/chatlog/internal/chatlog/mcp"
 	"github.com/sjzar/chatlog/internal/chatlog/wechat"
+	"github.com/sjzar/chatlog/internal/errors"
 	iwechat "github.com/sjzar/chatlog/internal/wechat"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/internal/wechat/key"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
 	"github.com/sjzar/chatlog/pkg/util"
 	"github.com/sjzar/chatlog/pkg/util/dat2img"
 )
@@ -28,6 +37,7 @@ type Manager struct {
 	http   *http.Service
 	mcp    *mcp.Service
 	wechat *wechat.Service
+	export *export.Service
 
 	// Terminal UI
 	app *App
@@ -52,6 +62,8 @@ func New(configPath string) (*Manager, error) {
 
 	http := http.NewService(ctx, db, mcp)
 
+	export := export.NewService(ctx, db)
+
 	return &Manager{
 		conf:   conf,
 		ctx:    ctx,
@@ -59,6 +71,7 @@ func New(configPath string) (*Manager, error) {
 		mcp:    mcp,
 		http:   http,
 		wechat: wechat,
+		export: export,
 	}, nil
 }
 
@@ -189,7 +202,7 @@ func (m *Manager) SetHTTPAddr(text string) error {
 
 func (m *Manager) GetDataKey() error {
 	if m.ctx.Current == nil {
-		return fmt.Errorf("未选择任何账号")
+		return fmt.Errorf("未选择任何微信进程，离线解密请在设置中填写数据密钥")
 	}
 	if _, err := m.wechat.GetDataKey(m.ctx.Current); err != nil {
 		return err
@@ -199,10 +212,49 @@ func (m *Manager) GetDataKey() error {
 	return nil
 }
 
-func (m *Manager) DecryptDBFiles() error {
-	if m.ctx.DataKey == "" {
+// SetDataDir 设置数据目录
+// 未选择微信进程时根据目录结构识别平台和版本，用于离线解密从其他设备复制的数据目录
+func (m *Manager) SetDataDir(dir string) error {
+	if m.ctx.Current != nil {
+		m.ctx.SetDataDir(dir)
+		return nil
+	}
+	platform, version, err := decrypt.DetectDataDir(dir)
+	if err != nil {
+		return err
+	}
+	m.ctx.SetOfflineDataDir(dir, platform, version)
+	return nil
+}
+
+// SetDataKey 设置数据密钥，数据目录已设置时先验证密钥是否匹配
+func (m *Manager) SetDataKey(key string) error {
+	if m.ctx.DataDir != "" && m.ctx.Platform != "" && m.ctx.Version != 0 {
+		// 数据目录中没有可用于验证的数据库文件或文件已解密时跳过验证
+		if validator, err := decrypt.NewValidator(m.ctx.Platform, m.ctx.Version, m.ctx.DataDir); err == nil {
+			b, err := hex.DecodeString(key)
+			if err != nil {
+				return fmt.Errorf("数据密钥格式错误: %v", err)
+			}
+			if !validator.Validate(b) {
+				return fmt.Errorf("数据密钥与数据目录不匹配")
+			}
+		}
+	}
+	m.ctx.SetDataKey(key)
+	return nil
+}
+
+// DecryptDBFiles 解密数据文件，progress 不为空时在每个文件处理完成后调用
+func (m *Manager) DecryptDBFiles(progress func(*wechat.DecryptProgress)) error {
+	if m.ctx.Current == nil && m.ctx.DataDir != "" && (m.ctx.Platform == "" || m.ctx.Version == 0) {
+		if err := m.SetDataDir(m.ctx.DataDir); err != nil {
+			return err
+		}
+	}
+	if m.ctx.DataKey == "" && !m.isDecryptedDataDir() {
 		if m.ctx.Current == nil {
-			return fmt.Errorf("未选择任何账号")
+			return fmt.Errorf("未选择任何微信进程，离线解密请在设置中填写数据密钥")
 		}
 		if err := m.GetDataKey(); err != nil {
 			return err
@@ -212,7 +264,7 @@ func (m *Manager) DecryptDBFiles() error {
 		m.ctx.WorkDir = util.DefaultWorkDir(m.ctx.Account)
 	}
 
-	if err := m.wechat.DecryptDBFiles(); err != nil {
+	if err := m.wechat.DecryptDBFiles(0, progress); err != nil {
 		return err
 	}
 	m.ctx.Refresh()
@@ -220,6 +272,15 @@ func (m *Manager) DecryptDBFiles() error {
 	return nil
 }
 
+// isDecryptedDataDir 判断数据目录中的数据库是否已经解密，已解密的数据目录无需密钥，直接复制到工作目录
+func (m *Manager) isDecryptedDataDir() bool {
+	if m.ctx.DataDir == "" {
+		return false
+	}
+	_, err := decrypt.NewValidator(m.ctx.Platform, m.ctx.Version, m.ctx.DataDir)
+	return err == errors.ErrAlreadyDecrypted
+}
+
 func (m *Manager) StartAutoDecrypt() error {
 	if m.ctx.DataKey == "" || m.ctx.DataDir == "" {
 		return fmt.Errorf("请先获取密钥")
@@ -251,7 +312,7 @@ func (m *Manager) RefreshSession() error {
 			return err
 		}
 	}
-	resp, err := m.db.GetSessions("", 1, 0)
+	resp, err := m.db.GetSessions(context.Background(), "", 1, 0)
 	if err != nil {
 		return err
 	}
@@ -262,13 +323,21 @@ func (m *Manager) RefreshSession() error {
 	return nil
 }
 
-func (m *Manager) CommandKey(pid int) (string, error) {
+// CommandKey 从微信进程中获取密钥，fallback 为 true 时特征串搜索失败后暴力扫描进程内存
+func (m *Manager) CommandKey(pid int, fallback bool, progress func(*scan.Progress)) (string, error) {
+	getKey := func(ins *iwechat.Account) (string, error) {
+		if fallback {
+			return ins.ScanKey(context.Background(), progress)
+		}
+		return ins.GetKey(context.Background())
+	}
+
 	instances := m.wechat.GetWeChatInstances()
 	if len(instances) == 0 {
 		return "", fmt.Errorf("wechat process not found")
 	}
 	if len(instances) == 1 {
-		return instances[0].GetKey(context.Background())
+		return getKey(instances[0])
 	}
 	if pid == 0 {
 		str := "Select a process:\n"
@@ -279,13 +348,64 @@ func (m *Manager) CommandKey(pid int) (string, error) {
 	}
 	for _, ins := range instances {
 		if ins.PID == uint32(pid) {
-			return ins.GetKey(context.Background())
+			return getKey(ins)
 		}
 	}
 	return "", fmt.Errorf("wechat process not found")
 }
 
-func (m *Manager) CommandDecrypt(dataDir string, workDir string, key string, platform string, version int) error {
+// CommandKeyFromDump 从离线保存的内存转储中提取密钥，dumpFile 可以是 dumpmemory 生成的 .bin 或 .zip 文件
+// 未指定数据目录时，使用 zip 文件中一并打包的 session 数据库验证密钥，fallback 为 true 时特征串搜索失败后暴力扫描
+func (m *Manager) CommandKeyFromDump(dumpFile string, dataDir string, platform string, version int, fallback bool, progress func(*scan.Progress)) (string, error) {
+	dump, err := key.OpenDump(dumpFile)
+	if err != nil {
+		return "", err
+	}
+	defer dump.Close()
+	sessionDB := dump.SessionDB()
+
+	var validator *decrypt.Validator
+	switch {
+	case dataDir != "":
+		platform, version, err = detectPlatform(platform, version, "", dataDir)
+		if err != nil {
+			return "", err
+		}
+		validator, err = decrypt.NewValidator(platform, version, dataDir)
+	case sessionDB != nil:
+		if platform == decrypt.PlatformAuto {
+			platform = "darwin"
+		}
+		if version == 0 {
+			version = sessionDB.Version
+		}
+		if version == 0 {
+			return "", fmt.Errorf("version is required to validate key with %s", sessionDB.Name)
+		}
+		var path string
+		var cleanup func()
+		if path, cleanup, err = sessionDB.Extract(); err != nil {
+			return "", err
+		}
+		defer cleanup()
+		validator, err = decrypt.NewValidatorWithFile(platform, version, path)
+	default:
+		return "", fmt.Errorf("dataDir is required to validate key")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var scanner *scan.Scanner
+	if fallback {
+		scanner = scan.NewScanner(validator, progress)
+	}
+
+	log.Info().Msgf("searching key in %s, size %s", dumpFile, util.ByteCountSI(dump.Size()))
+	return key.SearchDump(context.Background(), dump, validator, scanner)
+}
+
+func (m *Manager) CommandDecrypt(dataDir string, workDir string, key string, platform string, version int, workers int, progress func(*wechat.DecryptProgress)) error {
 	if dataDir == "" {
 		return fmt.Errorf("dataDir is required")
 	}
@@ -295,18 +415,131 @@ func (m *Manager) CommandDecrypt(dataDir string, workDir string, key string, pla
 	if workDir == "" {
 		workDir = util.DefaultWorkDir(filepath.Base(filepath.Dir(dataDir)))
 	}
-	m.ctx.DataDir = dataDir
+	platform, version, err := detectPlatform(platform, version, key, dataDir)
+	if err != nil {
+		return err
+	}
+	m.ctx.SwitchDataDir(dataDir)
 	m.ctx.WorkDir = workDir
 	m.ctx.DataKey = key
 	m.ctx.Platform = platform
 	m.ctx.Version = version
-	if err := m.wechat.DecryptDBFiles(); err != nil {
+	if err := m.wechat.DecryptDBFiles(workers, progress); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// CommandVerify 校验数据目录中各数据库文件的 HMAC 和工作目录中解密结果的完整性
+// salvage 为 true 时重新解密，校验失败的页面以全零写入工作目录
+func (m *Manager) CommandVerify(dataDir string, workDir string, key string, platform string, version int, salvage bool, progress func(done int, total int, report *wechat.VerifyReport)) ([]*wechat.VerifyReport, error) {
+	if dataDir == "" {
+		return nil, fmt.Errorf("dataDir is required")
+	}
+	if key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+	if workDir == "" {
+		workDir = util.DefaultWorkDir(filepath.Base(filepath.Dir(dataDir)))
+	}
+	platform, version, err := detectPlatform(platform, version, key, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	m.ctx.SwitchDataDir(dataDir)
+	m.ctx.WorkDir = workDir
+	m.ctx.DataKey = key
+	m.ctx.Platform = platform
+	m.ctx.Version = version
+	return m.wechat.VerifyDBFiles(salvage, progress)
+}
+
+// CommandEncrypt 将明文数据库重新加密为微信可读取的数据库
+// original 为原始的加密数据库，用于读取盐值并识别平台和版本；未指定时需提供 salt、platform 和 version
+func (m *Manager) CommandEncrypt(input string, output string, key string, original string, salt string, platform string, version int) error {
+	if input == "" {
+		return fmt.Errorf("input is required")
+	}
+	if output == "" {
+		return fmt.Errorf("output is required")
+	}
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	var saltBytes []byte
+	switch {
+	case original != "":
+		p, v, err := decrypt.DetectFile(original, key)
+		if err != nil {
+			return fmt.Errorf("failed to validate key with %s: %v", original, err)
+		}
+		if platform != decrypt.PlatformAuto && platform != p {
+			log.Warn().Msgf("platform %s does not match detected platform %s", platform, p)
+		}
+		if version != 0 && version != v {
+			log.Warn().Msgf("version %d does not match detected version %d", version, v)
+		}
+		platform, version = p, v
+
+		f, err := os.Open(original)
+		if err != nil {
+			return err
+		}
+		saltBytes = make([]byte, common.SaltSize)
+		_, err = io.ReadFull(f, saltBytes)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read salt from %s: %v", original, err)
+		}
+	case salt != "":
+		if platform == decrypt.PlatformAuto || version == 0 {
+			return fmt.Errorf("platform and version are required when original is not set")
+		}
+		var err error
+		if saltBytes, err = hex.DecodeString(salt); err != nil {
+			return fmt.Errorf("failed to decode salt: %v", err)
+		}
+	default:
+		return fmt.Errorf("original or salt is required")
+	}
+
+	decryptor, err := decrypt.NewDecryptor(platform, version)
+	if err != nil {
+		return err
+	}
+
+	// 未合并的 WAL 中的修改不会被加密
+	if stat, err := os.Stat(input + "-wal"); err == nil && stat.Size() > 0 {
+		log.Warn().Msgf("%s-wal is not empty, run a checkpoint first or uncommitted changes will be lost", input)
+	}
+
+	if err := util.PrepareDir(filepath.Dir(output)); err != nil {
+		return err
+	}
+	outputTemp := output + ".tmp"
+	outputFile, err := os.Create(outputTemp)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	err = decryptor.Encrypt(context.Background(), input, key, saltBytes, outputFile)
+	if closeErr := outputFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputTemp)
+		return err
+	}
+	if err := os.Rename(outputTemp, output); err != nil {
+		os.Remove(outputTemp)
+		return err
+	}
+
+	log.Info().Msgf("encrypted %s to %s with %s", input, output, decryptor.GetVersion())
+	return nil
+}
+
 func (m *Manager) CommandHTTPServer(addr string, dataDir string, workDir string, platform string, version int) error {
 
 	if addr == "" {
@@ -317,12 +550,9 @@ func (m *Manager) CommandHTTPServer(addr string, dataDir string, workDir string,
 		return fmt.Errorf("workDir is required")
 	}
 
-	if platform == "" {
-		return fmt.Errorf("platform is required")
-	}
-
-	if version == 0 {
-		return fmt.Errorf("version is required")
+	platform, version, err := detectPlatform(platform, version, "", workDir, dataDir)
+	if err != nil {
+		return err
 	}
 
 	m.ctx.HTTPAddr = addr
@@ -347,3 +577,102 @@ func (m *Manager) CommandHTTPServer(addr string, dataDir string, workDir string,
 
 	return m.http.ListenAndServe()
 }
+
+func (m *Manager) CommandMCPStdio(dataDir string, workDir string, platform string, version int) error {
+
+	if workDir == "" {
+		return fmt.Errorf("workDir is required")
+	}
+
+	platform, version, err := detectPlatform(platform, version, "", workDir, dataDir)
+	if err != nil {
+		return err
+	}
+
+	m.ctx.DataDir = dataDir
+	m.ctx.WorkDir = workDir
+	m.ctx.Platform = platform
+	m.ctx.Version = version
+
+	// 按依赖顺序启动服务
+	if err := m.db.Start(); err != nil {
+		return err
+	}
+	defer m.db.Stop()
+
+	if err := m.mcp.Start(); err != nil {
+		return err
+	}
+	defer m.mcp.Stop()
+
+	// stdin 关闭后 ServeStdio 等待已收到的请求全部回复再返回，随后才停止服务
+	return m.mcp.ServeStdio(os.Stdin, os.Stdout)
+}
+
+func (m *Manager) CommandExport(dataDir string, workDir string, platform string, version int, talker string, timeRange string, format string, out string) error {
+
+	if workDir == "" {
+		return fmt.Errorf("workDir is required")
+	}
+
+	platform, version, err := detectPlatform(platform, version, "", workDir, dataDir)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		return fmt.Errorf("out is required")
+	}
+
+	m.ctx.DataDir = dataDir
+	m.ctx.WorkDir = workDir
+	m.ctx.Platform = platform
+	m.ctx.Version = version
+
+	// 导出图片前需要先获取 v4 图片的 XOR key
+	if m.ctx.Version == 4 && m.ctx.DataDir != "" {
+		dat2img.ScanAndSetXorKey(m.ctx.DataDir)
+	}
+
+	if err := m.db.Start(); err != nil {
+		return err
+	}
+	defer m.db.Stop()
+
+	return m.export.Export(context.Background(), talker, timeRange, format, out)
+}
+
+// detectPlatform 平台为 auto 或版本为 0 时，依次根据 dirs 中的目录识别平台和版本
+// 指定 key 时使用密钥验证样本数据库，否则只根据目录结构识别
+func detectPlatform(platform string, version int, key string, dirs ...string) (string, int, error) {
+	if platform == "" {
+		return "", 0, fmt.Errorf("platform is required")
+	}
+	if platform != decrypt.PlatformAuto && version != 0 {
+		return platform, version, nil
+	}
+
+	var lastErr error
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		p, v, err := decrypt.Detect(dir, key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if platform != decrypt.PlatformAuto && platform != p {
+			log.Warn().Msgf("platform %s does not match detected platform %s", platform, p)
+		}
+		if version != 0 && version != v {
+			log.Warn().Msgf("version %d does not match detected version %d", version, v)
+		}
+		log.Info().Msgf("detected platform %s, version %d in %s", p, v, dir)
+		return p, v, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("data dir or work dir is required to detect platform and version")
+	}
+	return "", 0, fmt.Errorf("failed to detect platform and version: %v", lastErr)
+}
@@ -4,6 +4,17 @@ import (
 	"github.com/sjzar/chatlog/internal/mcp"
 )
 
+const (
+	// ContextSize chatlog_context 工具未指定 before/after 时返回的前后消息数量
+	ContextSize = 10
+
+	// StatsTop chat_stats 工具未指定 top 时返回的发送者、聊天数量
+	StatsTop = 20
+
+	// ResolveLimit resolve_name 工具返回的候选数量上限
+	ResolveLimit = 20
+)
+
 // MCPTools 和资源定义
 var (
 	InitializeResponse = mcp.InitializeResponse{
@@ -45,6 +56,65 @@ var (
 		},
 	}
 
+	ToolContactDetail = mcp.Tool{
+		Name: "contact_detail",
+		Description: `查询单个联系人的详细信息，包括与该联系人共同所在的群聊，以及其在各群中的群昵称、是否为群主。
+使用场景：
+- "Alice在哪些群里"、"我和张三有哪些共同群聊"
+- 需要确认某个联系人的微信ID、备注名、昵称时`,
+		InputSchema: mcp.ToolSchema{
+			Type: "object",
+			Properties: mcp.M{
+				"username": mcp.M{
+					"type":        "string",
+					"description": "联系人的微信ID、备注名或昵称",
+				},
+			},
+			Required: []string{"username"},
+		},
+	}
+
+	ToolChatRoomDetail = mcp.Tool{
+		Name: "chat_room_detail",
+		Description: `查询单个群聊的详细信息，包括群主、完整的成员列表（群昵称、备注名、昵称、是否为好友）以及我在群里的群昵称。
+使用场景：
+- "工作群里有哪些人"、"谁是群主"
+- 需要根据群昵称确认群成员的微信ID时`,
+		InputSchema: mcp.ToolSchema{
+			Type: "object",
+			Properties: mcp.M{
+				"name": mcp.M{
+					"type":        "string",
+					"description": "群聊ID、备注名或群名称",
+				},
+			},
+			Required: []string{"name"},
+		},
+	}
+
+	ToolResolveName = mcp.Tool{
+		Name: "resolve_name",
+		Description: `按名称查找联系人、群聊或群成员，返回按匹配程度排序的候选列表（微信ID、显示名称、匹配的字段）。
+支持ID、微信号、备注名、昵称、群昵称，以及备注名和昵称的全拼（如"zhangsan"）和拼音首字母（如"zs"）。
+使用场景：
+- chatlog等工具提示名称存在歧义时，查看全部候选并选择正确的ID
+- "群里的小王是谁"：指定talker在群成员中查找`,
+		InputSchema: mcp.ToolSchema{
+			Type: "object",
+			Properties: mcp.M{
+				"name": mcp.M{
+					"type":        "string",
+					"description": "要查找的名称或拼音",
+				},
+				"talker": mcp.M{
+					"type":        "string",
+					"description": "群聊的ID或名称，指定时只在该群成员中查找",
+				},
+			},
+			Required: []string{"name"},
+		},
+	}
+
 	ToolRecentChat = mcp.Tool{
 		Name:        "query_recent_chat",
 		Description: "查询最近会话列表，包括个人聊天和群聊。当用户想了解最近的聊天记录、查看最近联系过的人或群组时使用此工具。不需要参数，直接返回最近的会话列表。",
@@ -72,6 +142,7 @@ var (
 - 每次独立查询必须移除sender参数
 - 每次独立查询使用"Tn前后15-30分钟"的窄范围
 - 每次独立查询仅保留talker参数
+- 也可以使用chatlog_context工具，直接获取每个关键结果点前后的若干条消息
 
 步骤3: 【必须执行】综合分析所有上下文
 - 必须等待所有步骤2的查询结果返回后再进行分析
@@ -106,6 +177,7 @@ var (
 
 返回格式："昵称(ID) 时间\n消息内容\n昵称(ID) 时间\n消息内容"
 当查询多个Talker时，返回格式为："昵称(ID)\n[TalkerName(Talker)] 时间\n消息内容"
+不指定Talker时在所有聊天中查询，返回结果前会列出本页消息中各聊天的消息数量，适用于"上周谁提到了合同"这类不确定对话方的问题
 
 重要提示：
 1. 当用户询问特定时间段内的聊天记录时，必须使用正确的时间格式，特别是包含小时和分钟的查询
@@ -139,8 +211,10 @@ var (
 				"talker": mcp.M{
 					"type": "string",
 					"description": `指定对话方（联系人或群组）
-- 可使用ID、昵称或备注名
+- 可使用ID、昵称、备注名或其拼音（全拼或首字母），如："zhangsan"、"zs"
 - 多个对话方用","分隔，如："张三,李四,工作群"
+- 名称存在歧义时返回候选列表，请改用候选中的ID重新查询
+- 不指定时在所有聊天中查询，此时建议同时指定keyword或sender，并在后续步骤中使用结果中的对话方
 - 【重要】这是多步查询中唯一应保留的参数`,
 				},
 				"sender": mcp.M{
@@ -148,7 +222,7 @@ var (
 					"description": `指定群聊中的发送者
 - 仅在查询群聊记录时有效
 - 多个发送者用","分隔，如："张三,李四"
-- 可使用ID、昵称或备注名
+- 可使用ID、群昵称、昵称、备注名或其拼音，指定群聊时只在该群成员中查找
 【重要】查询特定发送者的消息时：
   1. 第一步：使用sender参数初步定位多个相关消息时间点
   2. 后续步骤：必须移除sender参数，分别查询每个时间点前后的完整对话
@@ -165,8 +239,91 @@ var (
   3. 错误示例：对所有找到的关键词消息一次性查询大范围上下文
   4. 正确示例：对每个时间点T分别执行查询"T前后15-30分钟"（不带keyword）`,
 				},
+				"limit": mcp.M{
+					"type":        "integer",
+					"description": "返回的消息数量上限，不指定时返回全部消息",
+				},
+				"cursor": mcp.M{
+					"type": "string",
+					"description": `分页游标，与limit一起使用
+- 第一页传空字符串
+- 结果末尾会给出下一页游标，继续查询时原样传入，其余参数保持不变
+- 结果中没有下一页游标时表示已经没有更多消息`,
+				},
+			},
+			Required: []string{"time"},
+		},
+	}
+
+	ToolChatLogContext = mcp.Tool{
+		Name: "chatlog_context",
+		Description: `获取与某个联系人或群聊的聊天中，指定消息前后的若干条消息。
+使用场景：
+- 通过chatlog工具定位到关键消息后，获取该消息前后的完整对话
+- 相比猜测一个时间范围，可以准确获取前后固定数量的消息，不会遗漏或过多
+
+返回格式与chatlog工具相同："昵称(ID) 时间\n消息内容"`,
+		InputSchema: mcp.ToolSchema{
+			Type: "object",
+			Properties: mcp.M{
+				"talker": mcp.M{
+					"type":        "string",
+					"description": "对话方（联系人或群组），可使用ID、昵称或备注名，只能指定一个",
+				},
+				"time": mcp.M{
+					"type": "string",
+					"description": `消息的时间点，精确到分钟，如"2023-04-18/14:30"
+以该时间点及之后的第一条消息为中心获取上下文`,
+				},
+				"seq": mcp.M{
+					"type":        "integer",
+					"description": "消息序号，指定时优先于time参数",
+				},
+				"before": mcp.M{
+					"type":        "integer",
+					"description": "获取该消息之前的消息数量，默认10",
+				},
+				"after": mcp.M{
+					"type":        "integer",
+					"description": "获取该消息之后的消息数量，默认10",
+				},
+			},
+			Required: []string{"talker"},
+		},
+	}
+
+	ToolChatStats = mcp.Tool{
+		Name: "chat_stats",
+		Description: `统计聊天记录，返回汇总数据而不是原始消息。
+使用场景：
+- "工作群里谁最活跃"：按发送者统计消息数量
+- "我和张三每天聊多少"：每日消息数量（超过两个月时按月汇总）
+- "这个群什么时候最热闹"：按小时统计的消息分布及最活跃时段
+- "群里主要发什么"：按消息类型统计
+- "张三一般多久回我消息"：回复时间的平均值、中位数和P90
+同时返回第一条和最后一条消息的时间。
+
+回答统计类问题时应优先使用此工具，而不是用chatlog工具获取大量消息后自行统计。`,
+		InputSchema: mcp.ToolSchema{
+			Type: "object",
+			Properties: mcp.M{
+				"talker": mcp.M{
+					"type":        "string",
+					"description": "对话方（联系人或群组），可使用ID、昵称或备注名，多个用\",\"分隔；不指定时统计所有聊天",
+				},
+				"time": mcp.M{
+					"type":        "string",
+					"description": "时间范围，格式与chatlog工具相同，如\"2023-04-01~2023-04-30\"、\"2023\"；不指定时统计全部时间",
+				},
+				"sender": mcp.M{
+					"type":        "string",
+					"description": "只统计指定发送者的消息，多个用\",\"分隔；在群聊中指定两人时可统计两人之间的回复时间",
+				},
+				"top": mcp.M{
+					"type":        "integer",
+					"description": "返回消息数量最多的前N个发送者，默认20",
+				},
 			},
-			Required: []string{"time", "talker"},
 		},
 	}
 
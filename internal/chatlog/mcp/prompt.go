@@ -0,0 +1,184 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sjzar/chatlog/internal/mcp"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+// 内置 Prompt，参考 docs/prompt.md
+// 所有 Prompt 都以 talker 和 time 为参数，对应的聊天记录以 resource 的形式附在消息中
+var (
+	PromptChatSummary = mcp.Prompt{
+		Name:        "chat_summary",
+		Description: "总结与指定联系人或群聊在一段时间内的聊天内容",
+		Arguments:   promptArguments,
+	}
+
+	PromptActionItems = mcp.Prompt{
+		Name:        "action_items",
+		Description: "从与指定联系人或群聊的聊天记录中提取待办事项",
+		Arguments:   promptArguments,
+	}
+
+	PromptTechDiscussion = mcp.Prompt{
+		Name:        "tech_discussion",
+		Description: "将技术群的讨论整理为问答形式",
+		Arguments:   promptArguments,
+	}
+
+	promptArguments = []mcp.PromptArgument{
+		{
+			Name:        "talker",
+			Description: "联系人或群聊，可使用ID、昵称或备注名",
+			Required:    true,
+		},
+		{
+			Name:        "time",
+			Description: `时间范围，如"2023-04-18"、"2023-04-01~2023-04-18"、"2023-04-18/14:30~2023-04-18/15:45"`,
+			Required:    true,
+		},
+	}
+
+	Prompts = []mcp.Prompt{
+		PromptChatSummary,
+		PromptActionItems,
+		PromptTechDiscussion,
+	}
+
+	// promptTemplates Prompt 名称到模板的映射，模板中的 %[1]s 为 talker，%[2]s 为 time
+	promptTemplates = map[string]string{
+		PromptChatSummary.Name: `你是一个中文的聊天记录总结助手，请将 "%[1]s" 在 %[2]s 的聊天内容总结成一份报告，聊天记录附在后面。
+
+报告包含不多于5个话题的总结（如果还有更多话题，可以在后面简单补充），每个话题包含以下内容：
+- 话题名(50字以内，带序号1️⃣2️⃣3️⃣，同时附带热度，以🔥数量表示）
+- 参与者(不超过5个人，将重复的人名去重)
+- 时间段(从几点到几点)
+- 过程(50到200字左右）
+- 评价(50字以下)
+
+另外有以下要求：
+1. 每个话题结束使用 ------------ 分割
+2. 使用中文冒号
+3. 无需大标题
+4. 开始给出整体讨论风格的评价，例如活跃、话题不集中、无聊诸如此类
+
+最后总结下最活跃的前五个发言者。`,
+
+		PromptActionItems.Name: `请从 "%[1]s" 在 %[2]s 的聊天记录中提取所有待办事项，聊天记录附在后面。
+
+每个待办事项包含以下内容：
+- 事项：需要完成的具体工作，简明扼要
+- 负责人：明确被指派或主动认领的人，没有则写"未指定"
+- 截止时间：聊天中提到的时间点，没有则写"未指定"
+- 来源：提出该事项的发言者与发言时间
+
+另外有以下要求：
+1. 按截止时间先后排序，未指定截止时间的排在最后
+2. 已在聊天中明确完成或取消的事项不要列出
+3. 不要编造聊天记录中没有的信息`,
+
+		PromptTechDiscussion.Name: `你作为一个专业的技术讨论分析者，请对 "%[1]s" 在 %[2]s 的聊天记录进行分析和结构化总结，聊天记录附在后面：
+
+1. 基础信息提取：
+- 将每个主题分成独立的问答对
+- 保持原始对话的时间顺序
+
+2. 问题分析要点：
+- 提取问题的具体场景和背景
+- 识别问题的核心技术难点
+- 突出问题的实际影响
+
+3. 解决方案总结：
+- 列出具体的解决步骤
+- 提取关键工具和资源
+- 包含实践经验和注意事项
+- 保留重要的链接和参考资料
+
+4. 输出格式：
+- 问题1：<简明扼要的问题描述>
+- 回答1：<完整的解决方案>
+- 补充：<额外的讨论要点或注意事项>
+
+5. 额外要求(严格执行)：
+- 如果有多个相关问题，保持逻辑顺序
+- 标记重要的警告和建议、突出经验性的分享内容、保留有价值的专业术语解释
+- 直接开始输出，不要添加任何开场白`,
+	}
+)
+
+// promptsGet 处理 Prompt 获取请求
+func (s *Service) promptsGet(ctx context.Context, session *mcp.Session, req *mcp.Request) error {
+	getReq, err := parseParams[mcp.PromptsGetRequest](req.Params)
+	if err != nil {
+		return fmt.Errorf("解析Prompt参数失败: %v", err)
+	}
+
+	var prompt *mcp.Prompt
+	for i := range Prompts {
+		if Prompts[i].Name == getReq.Name {
+			prompt = &Prompts[i]
+			break
+		}
+	}
+	if prompt == nil {
+		return fmt.Errorf("未支持的Prompt: %s", getReq.Name)
+	}
+
+	args := make(map[string]string)
+	for _, arg := range prompt.Arguments {
+		v, _ := getReq.Arguments[arg.Name].(string)
+		if arg.Required && v == "" {
+			return fmt.Errorf("缺少参数: %s", arg.Name)
+		}
+		args[arg.Name] = v
+	}
+
+	talker, _time := args["talker"], args["time"]
+	start, end, ok := util.TimeRangeOf(_time)
+	if !ok {
+		return fmt.Errorf("无法解析时间范围")
+	}
+
+	messages, err := s.db.GetMessages(ctx, start, end, talker, "", "", 0, 0)
+	if err != nil {
+		return fmt.Errorf("无法获取聊天记录: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if len(messages) == 0 {
+		buf.WriteString("未找到符合查询条件的聊天记录")
+	}
+	for _, m := range messages {
+		buf.WriteString(m.PlainText(strings.Contains(talker, ","), util.PerfectTimeFormat(start, end), ""))
+		buf.WriteString("\n")
+	}
+
+	resp := mcp.PromptsGetResponse{
+		Description: prompt.Description,
+		Messages: []mcp.PromptMessage{
+			{
+				Role: "user",
+				Content: mcp.PromptContent{
+					Type: "text",
+					Text: fmt.Sprintf(promptTemplates[prompt.Name], talker, _time),
+				},
+			},
+			{
+				Role: "user",
+				Content: mcp.PromptContent{
+					Type: "resource",
+					Resource: mcp.ReadingResourceContent{
+						URI:      fmt.Sprintf("chatlog://%s/%s", talker, _time),
+						MimeType: "text/plain",
+						Text:     buf.String(),
+					},
+				},
+			},
+		},
+	}
+	return session.WriteResponse(req, resp)
+}
@@ -2,9 +2,11 @@ package mcp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"strings"
 	"time"
@@ -12,6 +14,7 @@ import (
 	"github.com/sjzar/chatlog/internal/chatlog/ctx"
 	"github.com/sjzar/chatlog/internal/chatlog/database"
 	"github.com/sjzar/chatlog/internal/mcp"
+	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/pkg/util"
 
 	"github.com/gin-gonic/gin"
@@ -21,14 +24,17 @@ type Service struct {
 	ctx *ctx.Context
 	db  *database.Service
 
-	mcp *mcp.MCP
+	mcp       *mcp.MCP
+	scheduler *scheduler
 }
 
 func NewService(ctx *ctx.Context, db *database.Service) *Service {
-	return &Service{
+	s := &Service{
 		ctx: ctx,
 		db:  db,
 	}
+	s.setCallbacks()
+	return s
 }
 
 // GetMCP 获取底层MCP实例
@@ -39,6 +45,7 @@ func (s *Service) GetMCP() *mcp.MCP {
 // Start 启动MCP服务
 func (s *Service) Start() error {
 	s.mcp = mcp.NewMCP()
+	s.scheduler = newScheduler(s.processMCP)
 	go s.worker()
 	return nil
 }
@@ -48,10 +55,13 @@ func (s *Service) Stop() error {
 	if s.mcp != nil {
 		s.mcp.Close()
 	}
+	if s.scheduler != nil {
+		s.scheduler.stop()
+	}
 	return nil
 }
 
-// worker 处理MCP请求
+// worker 分发MCP请求，由 scheduler 并发处理
 func (s *Service) worker() {
 	for {
 		select {
@@ -59,7 +69,7 @@ func (s *Service) worker() {
 			if !ok {
 				return
 			}
-			s.processMCP(p.Session, p.Request)
+			s.scheduler.dispatch(p)
 		}
 	}
 }
@@ -72,8 +82,17 @@ func (s *Service) HandleMessages(c *gin.Context) {
 	s.mcp.HandleMessages(c)
 }
 
+func (s *Service) HandleStreamable(c *gin.Context) {
+	s.mcp.HandleStreamable(c)
+}
+
+// ServeStdio 通过标准输入输出提供MCP服务，阻塞直到 r 读取结束
+func (s *Service) ServeStdio(r io.Reader, w io.Writer) error {
+	return s.mcp.ServeStdio(r, w)
+}
+
 // processMCP 处理MCP请求
-func (s *Service) processMCP(session *mcp.Session, req *mcp.Request) {
+func (s *Service) processMCP(ctx context.Context, session *mcp.Session, req *mcp.Request) {
 	var err error
 	switch req.Method {
 	case mcp.MethodInitialize:
@@ -81,15 +100,22 @@ func (s *Service) processMCP(session *mcp.Session, req *mcp.Request) {
 	case mcp.MethodToolsList:
 		err = s.sendCustomParams(session, req, mcp.M{"tools": []mcp.Tool{
 			ToolContact,
+			ToolContactDetail,
 			ToolChatRoom,
+			ToolChatRoomDetail,
+			ToolResolveName,
 			ToolRecentChat,
 			ToolChatLog,
+			ToolChatLogContext,
+			ToolChatStats,
 			ToolCurrentTime,
 		}})
 	case mcp.MethodToolsCall:
-		err = s.toolsCall(session, req)
+		err = s.toolsCall(ctx, session, req)
 	case mcp.MethodPromptsList:
-		err = s.sendCustomParams(session, req, mcp.M{"prompts": []mcp.Prompt{}})
+		err = s.sendCustomParams(session, req, mcp.M{"prompts": Prompts})
+	case mcp.MethodPromptsGet:
+		err = s.promptsGet(ctx, session, req)
 	case mcp.MethodResourcesList:
 		err = s.sendCustomParams(session, req, mcp.M{"resources": []mcp.Resource{
 			ResourceRecentChat,
@@ -101,12 +127,30 @@ func (s *Service) processMCP(session *mcp.Session, req *mcp.Request) {
 			ResourceTemplateChatlog,
 		}})
 	case mcp.MethodResourcesRead:
-		err = s.resourcesRead(session, req)
+		err = s.resourcesRead(ctx, session, req)
+	case mcp.MethodResourcesSubscribe:
+		err = s.resourcesSubscribe(session, req)
+	case mcp.MethodResourcesUnsubscribe:
+		err = s.resourcesUnsubscribe(session, req)
 	case mcp.MethodPing:
 		err = s.sendCustomParams(session, req, struct{}{})
+	default:
+		// 通知不需要回复，未知的请求需要返回错误，否则 Streamable HTTP 的 POST 请求会一直等待
+		if req.ID != nil {
+			resp := mcp.ErrMethodNotFound.JsonRPC()
+			resp.ID = req.ID
+			err = s.sendResponse(session, &resp)
+		}
 	}
 
 	if err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			// 客户端取消的请求不再回复
+			return
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = ErrRequestTimeout
+		}
 		session.WriteError(req, err)
 	}
 }
@@ -119,11 +163,13 @@ func (s *Service) initialize(session *mcp.Session, req *mcp.Request) error {
 	}
 	session.SaveClientInfo(initReq.ClientInfo)
 
-	return session.WriteResponse(req, InitializeResponse)
+	resp := InitializeResponse
+	resp.ProtocolVersion = mcp.NegotiateProtocolVersion(initReq.ProtocolVersion)
+	return session.WriteResponse(req, resp)
 }
 
 // toolsCall 处理工具调用
-func (s *Service) toolsCall(session *mcp.Session, req *mcp.Request) error {
+func (s *Service) toolsCall(ctx context.Context, session *mcp.Session, req *mcp.Request) error {
 	callReq, err := parseParams[mcp.ToolsCallRequest](req.Params)
 	if err != nil {
 		return fmt.Errorf("解析工具调用参数失败: %v", err)
@@ -138,7 +184,7 @@ func (s *Service) toolsCall(session *mcp.Session, req *mcp.Request) error {
 		}
 		limit := util.MustAnyToInt(callReq.Arguments["limit"])
 		offset := util.MustAnyToInt(callReq.Arguments["offset"])
-		list, err := s.db.GetContacts(keyword, limit, offset)
+		list, err := s.db.GetContacts(ctx, keyword, limit, offset)
 		if err != nil {
 			return fmt.Errorf("无法获取联系人列表: %v", err)
 		}
@@ -153,7 +199,7 @@ func (s *Service) toolsCall(session *mcp.Session, req *mcp.Request) error {
 		}
 		limit := util.MustAnyToInt(callReq.Arguments["limit"])
 		offset := util.MustAnyToInt(callReq.Arguments["offset"])
-		list, err := s.db.GetChatRooms(keyword, limit, offset)
+		list, err := s.db.GetChatRooms(ctx, keyword, limit, offset)
 		if err != nil {
 			return fmt.Errorf("无法获取群聊列表: %v", err)
 		}
@@ -161,6 +207,28 @@ func (s *Service) toolsCall(session *mcp.Session, req *mcp.Request) error {
 		for _, chatRoom := range list.Items {
 			buf.WriteString(fmt.Sprintf("%s,%s,%s,%s,%d\n", chatRoom.Name, chatRoom.Remark, chatRoom.NickName, chatRoom.Owner, len(chatRoom.Users)))
 		}
+	case "contact_detail":
+		username, _ := callReq.Arguments["username"].(string)
+		detail, err := s.db.GetContactDetail(ctx, username)
+		if err != nil {
+			return fmt.Errorf("无法获取联系人详情: %v", err)
+		}
+		buf.WriteString(detail.PlainText())
+	case "chat_room_detail":
+		name, _ := callReq.Arguments["name"].(string)
+		detail, err := s.db.GetChatRoomDetail(ctx, name)
+		if err != nil {
+			return fmt.Errorf("无法获取群聊详情: %v", err)
+		}
+		buf.WriteString(detail.PlainText())
+	case "resolve_name":
+		name, _ := callReq.Arguments["name"].(string)
+		talker, _ := callReq.Arguments["talker"].(string)
+		candidates, err := s.db.Resolve(ctx, name, talker, ResolveLimit)
+		if err != nil {
+			return fmt.Errorf("无法查找名称: %v", err)
+		}
+		buf.WriteString(model.CandidatesPlainText(candidates))
 	case "query_recent_chat":
 		keyword := ""
 		if v, ok := callReq.Arguments["keyword"]; ok {
@@ -168,7 +236,7 @@ func (s *Service) toolsCall(session *mcp.Session, req *mcp.Request) error {
 		}
 		limit := util.MustAnyToInt(callReq.Arguments["limit"])
 		offset := util.MustAnyToInt(callReq.Arguments["offset"])
-		data, err := s.db.GetSessions(keyword, limit, offset)
+		data, err := s.db.GetSessions(ctx, keyword, limit, offset)
 		if err != nil {
 			return fmt.Errorf("无法获取会话列表: %v", err)
 		}
@@ -202,7 +270,68 @@ func (s *Service) toolsCall(session *mcp.Session, req *mcp.Request) error {
 		}
 		limit := util.MustAnyToInt(callReq.Arguments["limit"])
 		offset := util.MustAnyToInt(callReq.Arguments["offset"])
-		messages, err := s.db.GetMessages(start, end, talker, sender, keyword, limit, offset)
+
+		// 指定 cursor 参数时使用游标分页
+		var messages []*model.Message
+		var nextCursor string
+		if v, ok := callReq.Arguments["cursor"]; ok {
+			cursor, _ := v.(string)
+			resp, err := s.db.GetMessagesByCursor(ctx, start, end, talker, sender, keyword, cursor, limit)
+			if err != nil {
+				return fmt.Errorf("无法获取聊天记录: %v", err)
+			}
+			messages, nextCursor = resp.Items, resp.NextCursor
+		} else {
+			messages, err = s.db.GetMessages(ctx, start, end, talker, sender, keyword, limit, offset)
+			if err != nil {
+				return fmt.Errorf("无法获取聊天记录: %v", err)
+			}
+		}
+		if len(messages) == 0 {
+			buf.WriteString("未找到符合查询条件的聊天记录")
+		}
+		// 未指定对话方时查询所有聊天，先列出本页消息中各聊天的消息数量
+		if talker == "" && len(messages) > 0 {
+			counts := model.CountByTalker(messages)
+			buf.WriteString(fmt.Sprintf("本页共 %d 条消息，来自 %d 个聊天\n", len(messages), len(counts)))
+			for _, c := range counts {
+				buf.WriteString(c.String())
+				buf.WriteString("\n")
+			}
+			buf.WriteString("\n")
+		}
+		for _, m := range messages {
+			buf.WriteString(m.PlainText(talker == "" || strings.Contains(talker, ","), util.PerfectTimeFormat(start, end), ""))
+			buf.WriteString("\n")
+		}
+		if nextCursor != "" {
+			buf.WriteString(fmt.Sprintf("还有更多消息，下一页游标: %s\n", nextCursor))
+		}
+	case "chatlog_context":
+		if callReq.Arguments == nil {
+			return mcp.ErrInvalidParams
+		}
+		talker, _ := callReq.Arguments["talker"].(string)
+		before, after := ContextSize, ContextSize
+		if v, ok := callReq.Arguments["before"]; ok {
+			before = util.MustAnyToInt(v)
+		}
+		if v, ok := callReq.Arguments["after"]; ok {
+			after = util.MustAnyToInt(v)
+		}
+		var messages []*model.Message
+		var err error
+		if seq := int64(util.MustAnyToInt(callReq.Arguments["seq"])); seq > 0 {
+			messages, err = s.db.GetMessageContext(ctx, talker, seq, before, after)
+		} else {
+			// 只指定时间时由数据源找到该时间之后的第一条消息
+			_time, _ := callReq.Arguments["time"].(string)
+			t, ok := util.TimeOf(_time)
+			if !ok {
+				return fmt.Errorf("需要指定seq或time参数")
+			}
+			messages, err = s.db.GetMessageContextByTime(ctx, talker, t, before, after)
+		}
 		if err != nil {
 			return fmt.Errorf("无法获取聊天记录: %v", err)
 		}
@@ -210,9 +339,29 @@ func (s *Service) toolsCall(session *mcp.Session, req *mcp.Request) error {
 			buf.WriteString("未找到符合查询条件的聊天记录")
 		}
 		for _, m := range messages {
-			buf.WriteString(m.PlainText(strings.Contains(talker, ","), util.PerfectTimeFormat(start, end), ""))
+			buf.WriteString(m.PlainText(false, "2006-01-02 15:04:05", ""))
 			buf.WriteString("\n")
 		}
+	case "chat_stats":
+		_time, _ := callReq.Arguments["time"].(string)
+		if _time == "" {
+			_time = "all"
+		}
+		start, end, ok := util.TimeRangeOf(_time)
+		if !ok {
+			return fmt.Errorf("无法解析时间范围")
+		}
+		talker, _ := callReq.Arguments["talker"].(string)
+		sender, _ := callReq.Arguments["sender"].(string)
+		top := StatsTop
+		if v, ok := callReq.Arguments["top"]; ok {
+			top = util.MustAnyToInt(v)
+		}
+		stats, err := s.db.GetStats(ctx, start, end, talker, sender, top)
+		if err != nil {
+			return fmt.Errorf("无法获取聊天统计: %v", err)
+		}
+		buf.WriteString(stats.PlainText())
 	case "current_time":
 		buf.WriteString(time.Now().Local().Format(time.RFC3339))
 	default:
@@ -229,7 +378,7 @@ func (s *Service) toolsCall(session *mcp.Session, req *mcp.Request) error {
 }
 
 // resourcesRead 处理资源读取
-func (s *Service) resourcesRead(session *mcp.Session, req *mcp.Request) error {
+func (s *Service) resourcesRead(ctx context.Context, session *mcp.Session, req *mcp.Request) error {
 	readReq, err := parseParams[mcp.ResourcesReadRequest](req.Params)
 	if err != nil {
 		return fmt.Errorf("解析资源读取参数失败: %v", err)
@@ -243,7 +392,7 @@ func (s *Service) resourcesRead(session *mcp.Session, req *mcp.Request) error {
 	buf := &bytes.Buffer{}
 	switch u.Scheme {
 	case "contact":
-		list, err := s.db.GetContacts(u.Host, 0, 0)
+		list, err := s.db.GetContacts(ctx, u.Host, 0, 0)
 		if err != nil {
 			return fmt.Errorf("无法获取联系人列表: %v", err)
 		}
@@ -252,7 +401,7 @@ func (s *Service) resourcesRead(session *mcp.Session, req *mcp.Request) error {
 			buf.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", contact.UserName, contact.Alias, contact.Remark, contact.NickName))
 		}
 	case "chatroom":
-		list, err := s.db.GetChatRooms(u.Host, 0, 0)
+		list, err := s.db.GetChatRooms(ctx, u.Host, 0, 0)
 		if err != nil {
 			return fmt.Errorf("无法获取群聊列表: %v", err)
 		}
@@ -261,7 +410,7 @@ func (s *Service) resourcesRead(session *mcp.Session, req *mcp.Request) error {
 			buf.WriteString(fmt.Sprintf("%s,%s,%s,%s,%d\n", chatRoom.Name, chatRoom.Remark, chatRoom.NickName, chatRoom.Owner, len(chatRoom.Users)))
 		}
 	case "session":
-		data, err := s.db.GetSessions("", 0, 0)
+		data, err := s.db.GetSessions(ctx, "", 0, 0)
 		if err != nil {
 			return fmt.Errorf("无法获取会话列表: %v", err)
 		}
@@ -276,7 +425,7 @@ func (s *Service) resourcesRead(session *mcp.Session, req *mcp.Request) error {
 		}
 		limit := util.MustAnyToInt(u.Query().Get("limit"))
 		offset := util.MustAnyToInt(u.Query().Get("offset"))
-		messages, err := s.db.GetMessages(start, end, u.Host, "", "", limit, offset)
+		messages, err := s.db.GetMessages(ctx, start, end, u.Host, "", "", limit, offset)
 		if err != nil {
 			return fmt.Errorf("无法获取聊天记录: %v", err)
 		}
@@ -309,6 +458,16 @@ func (s *Service) sendCustomParams(session *mcp.Session, req *mcp.Request, param
 	return nil
 }
 
+// sendResponse 发送完整的响应
+func (s *Service) sendResponse(session *mcp.Session, resp *mcp.Response) error {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("无法序列化响应: %v", err)
+	}
+	session.Write(b)
+	return nil
+}
+
 // parseParams 解析参数
 func parseParams[T any](params interface{}) (*T, error) {
 	if params == nil {
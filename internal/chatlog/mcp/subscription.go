@@ -0,0 +1,103 @@
+package mcp
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/mcp"
+	"github.com/sjzar/chatlog/pkg/util"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// ResourceUpdateWindow 聊天记录资源的时间范围结束于该时间窗口之前时，不会再有新消息，不发送更新通知
+const ResourceUpdateWindow = time.Hour
+
+// 数据库文件分组与受影响的资源 URI scheme
+var callbackSchemes = map[string][]string{
+	"message":  {"chatlog"},
+	"session":  {"session"},
+	"contact":  {"contact"},
+	"chatroom": {"chatroom"},
+}
+
+// setCallbacks 订阅数据库文件变更，自动解密刷新数据库后通知订阅了相关资源的会话
+func (s *Service) setCallbacks() {
+	for name, schemes := range callbackSchemes {
+		s.db.SetCallback(name, func(event fsnotify.Event) error {
+			if !event.Op.Has(fsnotify.Create) {
+				return nil
+			}
+			s.notifyResourcesUpdated(schemes...)
+			return nil
+		})
+	}
+}
+
+// resourcesSubscribe 处理资源订阅
+func (s *Service) resourcesSubscribe(session *mcp.Session, req *mcp.Request) error {
+	subReq, err := parseParams[mcp.ResourcesSubscribeRequest](req.Params)
+	if err != nil {
+		return fmt.Errorf("解析资源订阅参数失败: %v", err)
+	}
+
+	u, err := url.Parse(subReq.URI)
+	if err != nil {
+		return fmt.Errorf("无法解析URI: %v", err)
+	}
+	supported := false
+	for _, schemes := range callbackSchemes {
+		supported = supported || slices.Contains(schemes, u.Scheme)
+	}
+	if !supported {
+		return fmt.Errorf("不支持的URI: %s", subReq.URI)
+	}
+
+	session.Subscribe(subReq.URI)
+	return s.sendCustomParams(session, req, struct{}{})
+}
+
+// resourcesUnsubscribe 处理取消资源订阅
+func (s *Service) resourcesUnsubscribe(session *mcp.Session, req *mcp.Request) error {
+	subReq, err := parseParams[mcp.ResourcesSubscribeRequest](req.Params)
+	if err != nil {
+		return fmt.Errorf("解析资源订阅参数失败: %v", err)
+	}
+	session.Unsubscribe(subReq.URI)
+	return s.sendCustomParams(session, req, struct{}{})
+}
+
+// notifyResourcesUpdated 向订阅了指定 scheme 资源的会话发送更新通知
+func (s *Service) notifyResourcesUpdated(schemes ...string) {
+	m := s.mcp
+	if m == nil {
+		return
+	}
+
+	for _, session := range m.Sessions() {
+		for _, uri := range session.Subscriptions() {
+			u, err := url.Parse(uri)
+			if err != nil || !slices.Contains(schemes, u.Scheme) {
+				continue
+			}
+			if u.Scheme == "chatlog" && !isRecentTimeRange(u) {
+				continue
+			}
+			log.Debug().Msgf("session: %s, resource updated: %s", session.ID(), uri)
+			session.WriteNotification(mcp.NofiticationResourcesUpdated, mcp.ResourcesUpdatedNotification{URI: uri})
+		}
+	}
+}
+
+// isRecentTimeRange 判断聊天记录资源的时间范围是否可能包含新消息
+func isRecentTimeRange(u *url.URL) bool {
+	_, end, ok := util.TimeRangeOf(strings.TrimPrefix(u.Path, "/"))
+	if !ok {
+		return true
+	}
+	return end.After(time.Now().Add(-ResourceUpdateWindow))
+}
@@ -0,0 +1,180 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/mcp"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// WorkerNum 同时处理的请求数量上限
+	WorkerNum = 8
+
+	// SessionQueueCap 单个会话中排队等待的请求数量上限
+	SessionQueueCap = 100
+
+	// RequestTimeout 单个请求的处理超时时间，不含排队等待的时间
+	RequestTimeout = 2 * time.Minute
+)
+
+var (
+	ErrRequestTimeout     = errors.New("请求处理超时")
+	ErrDuplicateRequestID = errors.New("请求 ID 与未完成的请求重复")
+)
+
+// scheduler 并发处理 MCP 请求
+// 不同会话的请求并发处理，总并发数不超过 WorkerNum
+// 同一会话的请求按到达顺序依次处理，超时从开始处理时计算，未完成的请求 ID 不能重复
+// ping 和 notifications/cancelled 不排队，直接处理
+type scheduler struct {
+	handler func(ctx context.Context, session *mcp.Session, req *mcp.Request)
+
+	sem chan struct{}
+
+	mu      sync.Mutex
+	queues  map[*mcp.Session][]*task
+	running map[string]*task
+}
+
+type task struct {
+	key     string
+	session *mcp.Session
+	req     *mcp.Request
+	ctx     context.Context
+	cancel  context.CancelFunc
+	finish  func() // 处理结束后通知投递方
+}
+
+func newScheduler(handler func(ctx context.Context, session *mcp.Session, req *mcp.Request)) *scheduler {
+	return &scheduler{
+		handler: handler,
+		sem:     make(chan struct{}, WorkerNum),
+		queues:  make(map[*mcp.Session][]*task),
+		running: make(map[string]*task),
+	}
+}
+
+// taskKey 会话内唯一的请求标识
+func taskKey(session *mcp.Session, id interface{}) string {
+	return session.ID() + "/" + mcp.IDKey(id)
+}
+
+func (s *scheduler) dispatch(p mcp.ProcessCtx) {
+	switch p.Request.Method {
+	case mcp.NotificationCancelled:
+		s.cancel(p.Session, p.Request)
+		p.Finish()
+		return
+	case mcp.MethodPing:
+		s.handler(context.Background(), p.Session, p.Request)
+		p.Finish()
+		return
+	}
+
+	t := &task{
+		session: p.Session,
+		req:     p.Request,
+		finish:  p.Finish,
+	}
+	// 超时从开始处理时计算，排队期间只能被取消
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+
+	// 写入响应可能阻塞，不能持有 s.mu
+	if err := s.enqueue(t); err != nil {
+		t.cancel()
+		if p.Request.ID != nil {
+			p.Session.WriteError(p.Request, err)
+		}
+		p.Finish()
+	}
+}
+
+// enqueue 将请求加入会话的队列，队列已满或请求 ID 与未完成的请求重复时返回错误
+func (s *scheduler) enqueue(t *task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue, ok := s.queues[t.session]
+	if len(queue) >= SessionQueueCap {
+		return mcp.ErrTooManyRequests
+	}
+
+	// 排队中的请求也可以被取消
+	if t.req.ID != nil {
+		t.key = taskKey(t.session, t.req.ID)
+		if _, ok := s.running[t.key]; ok {
+			t.key = ""
+			return ErrDuplicateRequestID
+		}
+		s.running[t.key] = t
+	}
+	s.queues[t.session] = append(queue, t)
+	if !ok {
+		go s.run(t.session)
+	}
+	return nil
+}
+
+// run 依次处理一个会话中的请求，队列为空时退出
+func (s *scheduler) run(session *mcp.Session) {
+	for {
+		s.mu.Lock()
+		queue := s.queues[session]
+		if len(queue) == 0 {
+			delete(s.queues, session)
+			s.mu.Unlock()
+			return
+		}
+		t := queue[0]
+		s.queues[session] = queue[1:]
+		s.mu.Unlock()
+
+		s.sem <- struct{}{}
+		// 排队期间被取消的请求不再处理
+		if t.ctx.Err() == nil {
+			ctx, cancel := context.WithTimeout(t.ctx, RequestTimeout)
+			s.handler(ctx, t.session, t.req)
+			cancel()
+		}
+		<-s.sem
+
+		t.cancel()
+		if t.key != "" {
+			s.mu.Lock()
+			delete(s.running, t.key)
+			s.mu.Unlock()
+		}
+		t.finish()
+	}
+}
+
+func (s *scheduler) cancel(session *mcp.Session, req *mcp.Request) {
+	n, err := parseParams[mcp.CancelledNotification](req.Params)
+	if err != nil || n.RequestID == nil {
+		return
+	}
+
+	s.mu.Lock()
+	t, ok := s.running[taskKey(session, n.RequestID)]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	log.Debug().Msgf("session: %s, cancel request: %v, reason: %s", session.ID(), n.RequestID, n.Reason)
+	t.cancel()
+}
+
+// stop 取消所有未完成的请求
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.running {
+		t.cancel()
+	}
+}
@@ -2,19 +2,26 @@ package wechat
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
 
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
 	"github.com/sjzar/chatlog/internal/chatlog/ctx"
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/wechat"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/internal/wechatdb/datasource/dbm"
 	"github.com/sjzar/chatlog/pkg/filemonitor"
 	"github.com/sjzar/chatlog/pkg/util"
 )
@@ -30,6 +37,10 @@ type Service struct {
 	pendingActions map[string]bool
 	mutex          sync.Mutex
 	fm             *filemonitor.FileMonitor
+
+	// 自动解密时各数据文件上次解密的页面状态，用于增量解密
+	pageStates   map[string]*common.PageState
+	decryptMutex sync.Mutex
 }
 
 func NewService(ctx *ctx.Context) *Service {
@@ -37,6 +48,7 @@ func NewService(ctx *ctx.Context) *Service {
 		ctx:            ctx,
 		lastEvents:     make(map[string]time.Time),
 		pendingActions: make(map[string]bool),
+		pageStates:     make(map[string]*common.PageState),
 	}
 }
 
@@ -61,7 +73,8 @@ func (s *Service) GetDataKey(info *wechat.Account) (string, error) {
 }
 
 func (s *Service) StartAutoDecrypt() error {
-	dbGroup, err := filemonitor.NewFileGroup("wechat", s.ctx.DataDir, `.*\.db$`, []string{"fts"})
+	// 新消息先写入 WAL 文件，同时监听 -wal 文件的变化
+	dbGroup, err := filemonitor.NewFileGroup("wechat", s.ctx.DataDir, `.*\.db(-wal)?$`, []string{"fts"})
 	if err != nil {
 		return err
 	}
@@ -91,13 +104,16 @@ func (s *Service) DecryptFileCallback(event fsnotify.Event) error {
 		return nil
 	}
 
+	// WAL 文件的变化同样触发对应数据库文件的解密
+	dbFile := strings.TrimSuffix(event.Name, "-wal")
+
 	s.mutex.Lock()
-	s.lastEvents[event.Name] = time.Now()
+	s.lastEvents[dbFile] = time.Now()
 
-	if !s.pendingActions[event.Name] {
-		s.pendingActions[event.Name] = true
+	if !s.pendingActions[dbFile] {
+		s.pendingActions[dbFile] = true
 		s.mutex.Unlock()
-		go s.waitAndProcess(event.Name)
+		go s.waitAndProcess(dbFile)
 	} else {
 		s.mutex.Unlock()
 	}
@@ -120,7 +136,7 @@ func (s *Service) waitAndProcess(dbFile string) {
 			s.mutex.Unlock()
 
 			log.Debug().Msgf("Processing file: %s", dbFile)
-			s.DecryptDBFile(dbFile)
+			s.DecryptChangedDBFile(dbFile)
 			return
 		}
 		s.mutex.Unlock()
@@ -156,18 +172,167 @@ func (s *Service) DecryptDBFile(dbFile string) error {
 			if data, err := os.ReadFile(dbFile); err == nil {
 				outputFile.Write(data)
 			}
+			// 未加密的 WAL 同样需要重放，第 1 页去掉文件头以与解密结果一致
+			if _, err := common.ReplayWAL(context.Background(), dbFile+"-wal", decryptor.GetPageSize(), outputFile, func(page []byte, pageNum int64) ([]byte, error) {
+				if pageNum == 0 {
+					return page[common.SaltSize:], nil
+				}
+				return page, nil
+			}); err != nil {
+				log.Err(err).Msgf("failed to replay WAL of %s", dbFile)
+			}
 			return nil
 		}
 		log.Err(err).Msgf("failed to decrypt %s", dbFile)
 		return err
 	}
 
-	log.Debug().Msgf("Decrypted %s to %s", dbFile, output)
+	// 最近的消息可能尚未写回数据库文件，重放 WAL 中已提交的页面
+	// WAL 重放失败时保留数据库文件的解密结果
+	pages, err := decryptor.DecryptWAL(context.Background(), dbFile, s.ctx.DataKey, outputFile)
+	if err != nil {
+		log.Err(err).Msgf("failed to decrypt WAL of %s", dbFile)
+	}
+
+	log.Debug().Msgf("Decrypted %s to %s, %d WAL pages replayed", dbFile, output, pages)
 
 	return nil
 }
 
-func (s *Service) DecryptDBFiles() error {
+// DecryptChangedDBFile 增量解密数据文件，用于自动解密
+// 只解密密文与上次不同的页面并原地更新工作目录中的文件，首次解密、盐值变化或页数减少时完整解密后替换
+func (s *Service) DecryptChangedDBFile(dbFile string) error {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	decryptor, err := decrypt.NewDecryptor(s.ctx.Platform, s.ctx.Version)
+	if err != nil {
+		return err
+	}
+
+	output := filepath.Join(s.ctx.WorkDir, dbFile[len(s.ctx.DataDir):])
+
+	s.mutex.Lock()
+	prev := s.pageStates[dbFile]
+	delete(s.pageStates, dbFile)
+	s.mutex.Unlock()
+
+	if prev != nil {
+		if _, err := os.Stat(output); err == nil {
+			state, err := s.patchDBFile(decryptor, dbFile, output, prev)
+			if err == nil {
+				s.mutex.Lock()
+				s.pageStates[dbFile] = state
+				s.mutex.Unlock()
+				return nil
+			}
+			if err != errors.ErrPageStateStale {
+				log.Debug().Err(err).Msgf("failed to patch %s, fallback to full decryption", output)
+			}
+		}
+	}
+
+	state, err := s.rewriteDBFile(decryptor, dbFile, output)
+	if err != nil {
+		// 未加密的数据文件直接复制
+		if err == errors.ErrAlreadyDecrypted {
+			return s.DecryptDBFile(dbFile)
+		}
+		log.Err(err).Msgf("failed to decrypt %s", dbFile)
+		return err
+	}
+	s.mutex.Lock()
+	s.pageStates[dbFile] = state
+	s.mutex.Unlock()
+	return nil
+}
+
+// patchDBFile 只解密变化的页面并原地写入已有的输出文件，随后重放 WAL
+// 写入期间关闭并阻止查询服务对输出文件的连接，避免读到新旧混合的页面
+func (s *Service) patchDBFile(decryptor decrypt.Decryptor, dbFile, output string, prev *common.PageState) (*common.PageState, error) {
+	dbm.LockFile(output)
+	defer dbm.UnlockFile(output)
+
+	outputFile, err := os.OpenFile(output, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer outputFile.Close()
+
+	state, changed, err := decryptor.DecryptChanged(context.Background(), dbFile, s.ctx.DataKey, outputFile, prev)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := decryptor.DecryptWAL(context.Background(), dbFile, s.ctx.DataKey, outputFile)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("Patched %s, %d pages changed, %d WAL pages replayed", output, changed, pages)
+	return state, nil
+}
+
+// rewriteDBFile 完整解密到临时文件后替换输出文件，失败时保留原输出文件
+func (s *Service) rewriteDBFile(decryptor decrypt.Decryptor, dbFile, output string) (*common.PageState, error) {
+	if err := util.PrepareDir(filepath.Dir(output)); err != nil {
+		return nil, err
+	}
+
+	outputTemp := output + ".tmp"
+	outputFile, err := os.Create(outputTemp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %v", err)
+	}
+
+	state, _, err := decryptor.DecryptChanged(context.Background(), dbFile, s.ctx.DataKey, outputFile, nil)
+	if err == nil {
+		if _, err := decryptor.DecryptWAL(context.Background(), dbFile, s.ctx.DataKey, outputFile); err != nil {
+			log.Err(err).Msgf("failed to decrypt WAL of %s", dbFile)
+		}
+	}
+	outputFile.Close()
+	if err != nil {
+		os.Remove(outputTemp)
+		return nil, err
+	}
+
+	if err := os.Rename(outputTemp, output); err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("Decrypted %s to %s", dbFile, output)
+	return state, nil
+}
+
+// DecryptProgress 批量解密的进度
+type DecryptProgress struct {
+	Total     int    // 数据文件数量
+	Done      int    // 已处理的文件数量，包括跳过和失败的文件
+	Skipped   int    // 未变化而跳过的文件数量
+	Failed    int    // 解密失败的文件数量
+	TotalSize int64  // 数据文件总大小
+	DoneSize  int64  // 已处理的文件大小
+	Current   string // 最近处理完成的文件
+}
+
+func (p *DecryptProgress) String() string {
+	return fmt.Sprintf("%d/%d 个文件 (%s/%s)，跳过 %d 个未变化的文件，失败 %d 个",
+		p.Done, p.Total, util.ByteCountSI(p.DoneSize), util.ByteCountSI(p.TotalSize), p.Skipped, p.Failed)
+}
+
+// decryptResult 单个数据文件的解密结果
+type decryptResult struct {
+	path    string
+	file    conf.File
+	skipped bool
+	err     error
+}
+
+// DecryptDBFiles 使用 workers 个 goroutine 并行解密数据目录中的数据库文件，workers 小于等于 0 时使用 CPU 核数
+// 每个文件解密完成后记录文件的大小、修改时间和盐值，再次解密时跳过未变化的文件
+// progress 不为空时，每处理完一个文件调用一次
+func (s *Service) DecryptDBFiles(workers int, progress func(*DecryptProgress)) error {
 	dbGroup, err := filemonitor.NewFileGroup("wechat", s.ctx.DataDir, `.*\.db$`, []string{"fts"})
 	if err != nil {
 		return err
@@ -178,12 +343,115 @@ func (s *Service) DecryptDBFiles() error {
 		return err
 	}
 
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	p := &DecryptProgress{Total: len(dbFiles)}
+	sizes := make(map[string]int64, len(dbFiles))
 	for _, dbFile := range dbFiles {
-		if err := s.DecryptDBFile(dbFile); err != nil {
-			log.Debug().Msgf("DecryptDBFile %s failed: %v", dbFile, err)
-			continue
+		if info, err := os.Stat(dbFile); err == nil {
+			sizes[dbFile] = info.Size()
+			p.TotalSize += info.Size()
+		}
+	}
+
+	jobs := make(chan string)
+	results := make(chan *decryptResult)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dbFile := range jobs {
+				results <- s.decryptIfChanged(dbFile)
+			}
+		}()
+	}
+	go func() {
+		for _, dbFile := range dbFiles {
+			jobs <- dbFile
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// 由单个 goroutine 汇总结果并保存配置
+	for r := range results {
+		p.Done++
+		p.DoneSize += sizes[r.path]
+		p.Current = r.path
+		switch {
+		case r.err != nil:
+			p.Failed++
+			log.Debug().Msgf("DecryptDBFile %s failed: %v", r.path, r.err)
+		case r.skipped:
+			p.Skipped++
+		default:
+			s.ctx.SetFile(r.file)
+		}
+		if progress != nil {
+			progress(p)
 		}
 	}
 
 	return nil
 }
+
+// decryptIfChanged 解密单个数据文件，文件与上次解密时相同且输出文件存在时跳过
+func (s *Service) decryptIfChanged(dbFile string) *decryptResult {
+	r := &decryptResult{path: dbFile}
+
+	file, err := s.fileInfo(dbFile)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.file = file
+
+	if last, ok := s.ctx.GetFile(file.Path); ok && last == file {
+		output := filepath.Join(s.ctx.WorkDir, file.Path)
+		if _, err := os.Stat(output); err == nil {
+			r.skipped = true
+			return r
+		}
+	}
+
+	r.err = s.DecryptDBFile(dbFile)
+	return r
+}
+
+// fileInfo 读取数据文件的大小、修改时间和盐值，以及 WAL 文件的大小和修改时间
+func (s *Service) fileInfo(dbFile string) (conf.File, error) {
+	rel, err := filepath.Rel(s.ctx.DataDir, dbFile)
+	if err != nil {
+		return conf.File{}, err
+	}
+
+	f, err := os.Open(dbFile)
+	if err != nil {
+		return conf.File{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return conf.File{}, err
+	}
+
+	salt := make([]byte, common.SaltSize)
+	n, _ := io.ReadFull(f, salt)
+
+	file := conf.File{
+		Path:         filepath.ToSlash(rel),
+		ModifiedTime: info.ModTime().Unix(),
+		Size:         info.Size(),
+		Salt:         hex.EncodeToString(salt[:n]),
+	}
+	if walInfo, err := os.Stat(dbFile + "-wal"); err == nil {
+		file.WALModifiedTime = walInfo.ModTime().Unix()
+		file.WALSize = walInfo.Size()
+	}
+	return file, nil
+}
@@ -0,0 +1,164 @@
+package wechat
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/pkg/filemonitor"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+// MaxIntegrityErrors integrity_check 最多返回的错误数量
+const MaxIntegrityErrors = 20
+
+// VerifyReport 单个数据文件的校验结果
+type VerifyReport struct {
+	Path      string               // 相对数据目录的路径
+	Result    *common.VerifyResult // 逐页 HMAC 校验结果，未加密的文件为空
+	Salvaged  bool                 // 是否将校验失败的页面以全零写入输出文件
+	Integrity []string             // 解密结果的 PRAGMA integrity_check 输出，完整时为 ["ok"]，未解密时为空
+	Err       error
+}
+
+// OK 数据文件的 HMAC 和解密结果是否均校验通过
+func (r *VerifyReport) OK() bool {
+	if r.Err != nil || (r.Result != nil && len(r.Result.BadPages) > 0) {
+		return false
+	}
+	return len(r.Integrity) == 1 && r.Integrity[0] == "ok"
+}
+
+// VerifyDBFiles 逐个校验数据目录中的数据库文件
+// 先逐页校验加密文件的 HMAC，再对工作目录中的解密结果执行 PRAGMA integrity_check
+// salvage 为 true 时重新解密每个文件，校验失败的页面以全零写入，而不是放弃整个文件
+// progress 不为空时，每处理完一个文件调用一次
+func (s *Service) VerifyDBFiles(salvage bool, progress func(done int, total int, report *VerifyReport)) ([]*VerifyReport, error) {
+	decryptor, err := decrypt.NewDecryptor(s.ctx.Platform, s.ctx.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	dbGroup, err := filemonitor.NewFileGroup("wechat", s.ctx.DataDir, `.*\.db$`, []string{"fts"})
+	if err != nil {
+		return nil, err
+	}
+
+	dbFiles, err := dbGroup.List()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*VerifyReport, 0, len(dbFiles))
+	for i, dbFile := range dbFiles {
+		report := s.verifyDBFile(decryptor, dbFile, salvage)
+		reports = append(reports, report)
+		if progress != nil {
+			progress(i+1, len(dbFiles), report)
+		}
+	}
+	return reports, nil
+}
+
+// verifyDBFile 校验单个数据文件及其解密结果
+func (s *Service) verifyDBFile(decryptor decrypt.Decryptor, dbFile string, salvage bool) *VerifyReport {
+	rel, err := filepath.Rel(s.ctx.DataDir, dbFile)
+	if err != nil {
+		return &VerifyReport{Path: dbFile, Err: err}
+	}
+	report := &VerifyReport{Path: filepath.ToSlash(rel)}
+	output := filepath.Join(s.ctx.WorkDir, rel)
+
+	if salvage {
+		report.Result, err = s.salvageDBFile(decryptor, dbFile, output)
+		report.Salvaged = err == nil && len(report.Result.BadPages) > 0
+	} else {
+		report.Result, err = decryptor.Verify(context.Background(), dbFile, s.ctx.DataKey, nil)
+	}
+	switch {
+	case err == errors.ErrAlreadyDecrypted:
+		// 未加密的数据文件没有 HMAC，只检查解密结果
+	case err != nil:
+		report.Err = err
+		return report
+	}
+
+	if _, err := os.Stat(output); err != nil {
+		return report
+	}
+	// 损坏严重时 SQLite 无法完成检查，直接返回错误，同样作为完整性检查的结果
+	report.Integrity, err = integrityCheck(output)
+	if err != nil {
+		report.Integrity = []string{err.Error()}
+	}
+	return report
+}
+
+// salvageDBFile 重新解密数据文件到工作目录，校验失败的页面以全零写入，随后尽量重放 WAL
+func (s *Service) salvageDBFile(decryptor decrypt.Decryptor, dbFile, output string) (*common.VerifyResult, error) {
+	if err := util.PrepareDir(filepath.Dir(output)); err != nil {
+		return nil, err
+	}
+
+	outputTemp := output + ".tmp"
+	outputFile, err := os.Create(outputTemp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %v", err)
+	}
+
+	result, err := decryptor.Verify(context.Background(), dbFile, s.ctx.DataKey, outputFile)
+	if err == nil {
+		if _, err := decryptor.DecryptWAL(context.Background(), dbFile, s.ctx.DataKey, outputFile); err != nil {
+			log.Err(err).Msgf("failed to decrypt WAL of %s", dbFile)
+		}
+	}
+	outputFile.Close()
+	if err != nil {
+		os.Remove(outputTemp)
+		return nil, err
+	}
+
+	if err := os.Rename(outputTemp, output); err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("Salvaged %s to %s, %d bad pages", dbFile, output, len(result.BadPages))
+	return result, nil
+}
+
+// integrityCheck 以只读方式打开解密后的数据库并执行 PRAGMA integrity_check
+func integrityCheck(path string) ([]string, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(fmt.Sprintf("PRAGMA integrity_check(%d)", MaxIntegrityErrors))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []string
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, strings.TrimSpace(message))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
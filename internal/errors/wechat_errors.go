@@ -7,6 +7,7 @@ var (
 	ErrDecryptHashVerificationFailed = New(nil, http.StatusBadRequest, "hash verification failed during decryption")
 	ErrDecryptIncorrectKey           = New(nil, http.StatusBadRequest, "incorrect decryption key")
 	ErrDecryptOperationCanceled      = New(nil, http.StatusBadRequest, "decryption operation was canceled")
+	ErrPageStateStale                = New(nil, http.StatusBadRequest, "page state is stale, full decryption required")
 	ErrNoMemoryRegionsFound          = New(nil, http.StatusBadRequest, "no memory regions found")
 	ErrReadMemoryTimeout             = New(nil, http.StatusInternalServerError, "read memory timeout")
 	ErrWeChatOffline                 = New(nil, http.StatusBadRequest, "WeChat is offline")
@@ -20,10 +21,39 @@ func PlatformUnsupported(platform string, version int) *Error {
 	return Newf(nil, http.StatusBadRequest, "unsupported platform: %s v%d", platform, version).WithStack()
 }
 
+func DumpPlatformUnsupported(platform string, version int) *Error {
+	return Newf(nil, http.StatusBadRequest, "key patterns of %s v%d cannot be searched in a memory dump, use brute-force scan instead", platform, version).WithStack()
+}
+
+func DumpMemoryNotFound(path string) *Error {
+	return Newf(nil, http.StatusBadRequest, "memory dump not found in %s", path).WithStack()
+}
+
+func WALPageSizeMismatch(path string, size int, expected int) *Error {
+	return Newf(nil, http.StatusBadRequest, "WAL page size mismatch: %s, got %d, expected %d", path, size, expected).WithStack()
+}
+
+func NotSQLiteFile(path string) *Error {
+	return Newf(nil, http.StatusBadRequest, "not a plain SQLite database: %s", path).WithStack()
+}
+
+func PlainDBLayoutMismatch(path string, pageSize int, reserve int, expectedPageSize int, expectedReserve int) *Error {
+	return Newf(nil, http.StatusBadRequest, "database page layout mismatch: %s, got page size %d reserve %d, expected page size %d reserve %d",
+		path, pageSize, reserve, expectedPageSize, expectedReserve).WithStack()
+}
+
+func SaltSizeInvalid(size int, expected int) *Error {
+	return Newf(nil, http.StatusBadRequest, "invalid salt size: got %d, expected %d", size, expected).WithStack()
+}
+
 func DecryptCreateCipherFailed(cause error) *Error {
 	return New(cause, http.StatusInternalServerError, "failed to create cipher").WithStack()
 }
 
+func EncryptGenerateIVFailed(cause error) *Error {
+	return New(cause, http.StatusInternalServerError, "failed to generate IV").WithStack()
+}
+
 func DecodeKeyFailed(cause error) *Error {
 	return New(cause, http.StatusBadRequest, "failed to decode hex key").WithStack()
 }
@@ -63,3 +93,7 @@ func WeChatAccountNotOnline(name string) *Error {
 func RefreshProcessStatusFailed(cause error) *Error {
 	return New(cause, http.StatusInternalServerError, "failed to refresh process status").WithStack()
 }
+
+func DataDirUnrecognized(dir string) *Error {
+	return Newf(nil, http.StatusBadRequest, "unrecognized WeChat data dir: %s", dir).WithStack()
+}
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -10,6 +11,8 @@ var (
 	ErrKeyEmpty        = New(nil, http.StatusBadRequest, "key empty").WithStack()
 	ErrMediaNotFound   = New(nil, http.StatusNotFound, "media not found").WithStack()
 	ErrKeyLengthMust32 = New(nil, http.StatusBadRequest, "key length must be 32 bytes").WithStack()
+	ErrKeywordEmpty    = New(nil, http.StatusBadRequest, "keyword empty").WithStack()
+	ErrIndexNotReady   = New(nil, http.StatusServiceUnavailable, "search index not ready").WithStack()
 )
 
 // 数据库初始化相关错误
@@ -64,3 +67,11 @@ func InitCacheFailed(cause error) *Error {
 func FileGroupNotFound(name string) *Error {
 	return Newf(nil, http.StatusNotFound, "file group not found: %s", name).WithStack()
 }
+
+func IndexInitFailed(cause error) *Error {
+	return New(cause, http.StatusInternalServerError, "search index init failed").WithStack()
+}
+
+func AmbiguousName(key string, candidates []string) *Error {
+	return Newf(nil, http.StatusBadRequest, "ambiguous name %s, candidates: %s", key, strings.Join(candidates, ", ")).WithStack()
+}
@@ -3,9 +3,35 @@ package mcp
 const (
 	MethodInitialize = "initialize"
 	MethodPing       = "ping"
-	ProtocolVersion  = "2024-11-05"
+
+	// Client => Server
+	NotificationInitialized = "notifications/initialized"
+
+	ProtocolVersion20241105 = "2024-11-05"
+	ProtocolVersion20250326 = "2025-03-26"
+
+	// ProtocolVersion 服务端支持的最新协议版本
+	ProtocolVersion = ProtocolVersion20250326
 )
 
+// SupportedProtocolVersions 服务端支持的协议版本，按从新到旧排列
+var SupportedProtocolVersions = []string{
+	ProtocolVersion20250326,
+	ProtocolVersion20241105,
+}
+
+// NegotiateProtocolVersion 协商协议版本
+// 客户端请求的版本受支持时原样返回，否则返回服务端支持的最新版本，由客户端决定是否断开
+// Document: https://modelcontextprotocol.io/specification/2025-03-26/basic/lifecycle#version-negotiation
+func NegotiateProtocolVersion(version string) string {
+	for _, v := range SupportedProtocolVersions {
+		if v == version {
+			return v
+		}
+	}
+	return ProtocolVersion
+}
+
 //	{
 //		"method": "initialize",
 //		"params": {
@@ -73,6 +99,6 @@ type ServerInfo struct {
 var DefaultCapabilities = M{
 	"experimental": M{},
 	"prompts":      M{"listChanged": false},
-	"resources":    M{"subscribe": false, "listChanged": false},
+	"resources":    M{"subscribe": true, "listChanged": false},
 	"tools":        M{"listChanged": false},
 }
@@ -60,3 +60,25 @@ type Notification struct {
 	Method  string      `json:"method"`
 	Params  interface{} `json:"params,omitempty"`
 }
+
+const (
+	// Client <=> Server
+	NotificationCancelled = "notifications/cancelled"
+)
+
+// CancelledNotification 取消一个正在处理的请求
+//
+//	{
+//		jsonrpc: "2.0",
+//		method: "notifications/cancelled",
+//		params: {
+//			requestId: "123",
+//			reason: "User requested cancellation"
+//		}
+//	}
+//
+// Document: https://modelcontextprotocol.io/specification/2025-03-26/basic/utilities/cancellation
+type CancelledNotification struct {
+	RequestID interface{} `json:"requestId"`
+	Reason    string      `json:"reason,omitempty"`
+}
@@ -19,13 +19,17 @@ type MCP struct {
 	sessionMu sync.Mutex
 
 	ProcessChan chan ProcessCtx
+	done        chan struct{}
 }
 
 func NewMCP() *MCP {
-	return &MCP{
+	m := &MCP{
 		sessions:    make(map[string]*Session),
 		ProcessChan: make(chan ProcessCtx, ProcessChanCap),
+		done:        make(chan struct{}),
 	}
+	go m.sweepStreamable()
+	return m
 }
 
 func (m *MCP) HandleSSE(c *gin.Context) {
@@ -50,6 +54,17 @@ func (m *MCP) GetSession(id string) *Session {
 	return m.sessions[id]
 }
 
+// Sessions 返回当前所有会话
+func (m *MCP) Sessions() []*Session {
+	m.sessionMu.Lock()
+	defer m.sessionMu.Unlock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
 func (m *MCP) HandleMessages(c *gin.Context) {
 
 	// panic("xxx")
@@ -98,10 +113,21 @@ func (m *MCP) HandleMessages(c *gin.Context) {
 }
 
 func (m *MCP) Close() {
+	close(m.done)
 	close(m.ProcessChan)
 }
 
 type ProcessCtx struct {
 	Session *Session
 	Request *Request
+
+	// Done 请求处理结束 (已回复、被拒绝或被取消) 后调用，可以为空
+	Done func()
+}
+
+// Finish 通知投递方请求已处理结束
+func (p ProcessCtx) Finish() {
+	if p.Done != nil {
+		p.Done()
+	}
 }
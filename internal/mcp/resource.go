@@ -66,6 +66,32 @@ type ResourcesReadRequest struct {
 	URI string `json:"uri"`
 }
 
+// Subscriptions
+// Request
+//
+//	{
+//		method: "resources/subscribe",
+//		params: {
+//			uri: "session://recent"
+//		}
+//	}
+//
+// Notification
+//
+//	{
+//		method: "notifications/resources/updated",
+//		params: {
+//			uri: "session://recent"
+//		}
+//	}
+type ResourcesSubscribeRequest struct {
+	URI string `json:"uri"`
+}
+
+type ResourcesUpdatedNotification struct {
+	URI string `json:"uri"`
+}
+
 type ReadingResourceContent struct {
 	URI      string `json:"uri"`
 	MimeType string `json:"mimeType,omitempty"`
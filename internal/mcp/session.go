@@ -3,6 +3,9 @@ package mcp
 import (
 	"encoding/json"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,6 +14,13 @@ type Session struct {
 	id string
 	w  io.Writer
 	c  *ClientInfo
+
+	// 订阅的资源 URI
+	subs  map[string]bool
+	subMu sync.Mutex
+
+	// 最近一次收到请求的时间 (UnixNano)，用于清理空闲的会话
+	lastActive atomic.Int64
 }
 
 func NewSession(c *gin.Context, id string) *Session {
@@ -20,6 +30,15 @@ func NewSession(c *gin.Context, id string) *Session {
 	}
 }
 
+func (s *Session) ID() string {
+	return s.id
+}
+
+// touch 记录会话的活动时间
+func (s *Session) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
 func (s *Session) Write(p []byte) (n int, err error) {
 	return s.w.Write(p)
 }
@@ -43,6 +62,46 @@ func (s *Session) WriteResponse(req *Request, data interface{}) error {
 	return nil
 }
 
+func (s *Session) WriteNotification(method string, params interface{}) error {
+	n := Notification{
+		JsonRPC: JsonRPCVersion,
+		Method:  method,
+		Params:  params,
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	s.Write(b)
+	return nil
+}
+
 func (s *Session) SaveClientInfo(c *ClientInfo) {
 	s.c = c
 }
+
+func (s *Session) Subscribe(uri string) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	if s.subs == nil {
+		s.subs = make(map[string]bool)
+	}
+	s.subs[uri] = true
+}
+
+func (s *Session) Unsubscribe(uri string) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	delete(s.subs, uri)
+}
+
+// Subscriptions 返回当前订阅的资源 URI
+func (s *Session) Subscriptions() []string {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	uris := make([]string, 0, len(s.subs))
+	for uri := range s.subs {
+		uris = append(uris, uri)
+	}
+	return uris
+}
@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,24 +17,35 @@ const (
 type SSEWriter struct {
 	id string
 	c  *gin.Context
+	mu sync.Mutex
 }
 
 func NewSSEWriter(c *gin.Context, id string) *SSEWriter {
-	c.Writer.Header().Set("Content-Type", SSEContentType)
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-	c.Writer.Flush()
+	w := newSSEWriter(c, id)
+	w.WriteEndpoing()
+	go w.ping()
+	return w
+}
 
+// newSSEWriter 仅设置 SSE 响应头，不发送 endpoint 事件
+// Streamable HTTP 传输直接复用 POST/GET 请求的响应流，不需要 endpoint
+func newSSEWriter(c *gin.Context, id string) *SSEWriter {
 	w := &SSEWriter{
 		id: id,
 		c:  c,
 	}
-	w.WriteEndpoing()
-	go w.ping()
+	w.writeHeader()
 	return w
 }
 
+func (w *SSEWriter) writeHeader() {
+	w.c.Writer.Header().Set("Content-Type", SSEContentType)
+	w.c.Writer.Header().Set("Cache-Control", "no-cache")
+	w.c.Writer.Header().Set("Connection", "keep-alive")
+	w.c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	w.c.Writer.Flush()
+}
+
 func (w *SSEWriter) Write(p []byte) (n int, err error) {
 	w.WriteMessage(string(p))
 	return len(p), nil
@@ -44,6 +56,8 @@ func (w *SSEWriter) WriteMessage(data string) {
 }
 
 func (w *SSEWriter) WriteEvent(event string, data string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	w.c.Writer.WriteString(fmt.Sprintf("event: %s\n", event))
 	w.c.Writer.WriteString(fmt.Sprintf("data: %s\n\n", data))
 	w.c.Writer.Flush()
@@ -64,6 +78,8 @@ func (w *SSEWriter) ping() {
 // event: endpoint
 // data: /message?sessionId=285d67ee-1c17-40d9-ab03-173d5ff48419
 func (w *SSEWriter) WriteEndpoing() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	w.c.Writer.WriteString(fmt.Sprintf("event: endpoint\n"))
 	w.c.Writer.WriteString(fmt.Sprintf("data: /message?sessionId=%s\n\n", w.id))
 	w.c.Writer.Flush()
@@ -72,6 +88,8 @@ func (w *SSEWriter) WriteEndpoing() {
 // WritePing
 // : ping - 2025-03-16 06:41:51.280928+00:00
 func (w *SSEWriter) writePing() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	w.c.Writer.WriteString(fmt.Sprintf(": ping - %s\n\n", time.Now().Format("2006-01-02 15:04:05.999999-07:00")))
 }
 
@@ -1 +1,95 @@
 package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	StdioSessionID = "stdio"
+
+	// StdioMaxLineSize 单条 JSON-RPC 消息的最大长度
+	StdioMaxLineSize = 16 * 1024 * 1024
+)
+
+// StdioWriter
+// stdio 传输中每条消息占一行，以 \n 分隔，消息内不能包含换行
+// Document: https://modelcontextprotocol.io/docs/concepts/transports#standard-input%2Foutput-stdio
+type StdioWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func NewStdioWriter(w io.Writer) *StdioWriter {
+	return &StdioWriter{w: w}
+}
+
+func (w *StdioWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n, err = w.w.Write(p); err != nil {
+		return n, err
+	}
+	if _, err = w.w.Write([]byte{'\n'}); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// ServeStdio 从 r 中逐行读取 JSON-RPC 请求，投递到 ProcessChan，响应写入 w
+// r 读取结束 (EOF) 后等待已投递的请求处理完毕并写出响应再返回
+func (m *MCP) ServeStdio(r io.Reader, w io.Writer) error {
+	writer := NewStdioWriter(w)
+	session := &Session{
+		id: StdioSessionID,
+		w:  writer,
+	}
+
+	m.sessionMu.Lock()
+	m.sessions[StdioSessionID] = session
+	m.sessionMu.Unlock()
+
+	defer func() {
+		m.sessionMu.Lock()
+		delete(m.sessions, StdioSessionID)
+		m.sessionMu.Unlock()
+	}()
+
+	// 已投递但尚未处理结束的请求
+	var pending sync.WaitGroup
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), StdioMaxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			b, _ := json.Marshal(ErrParseError.JsonRPC())
+			writer.Write(b)
+			continue
+		}
+
+		log.Debug().Msgf("session: %s, request: %s", StdioSessionID, req)
+		// stdio 只有一个客户端，阻塞等待即可，不需要返回 429
+		pending.Add(1)
+		m.ProcessChan <- ProcessCtx{Session: session, Request: &req, Done: pending.Done}
+	}
+	err := scanner.Err()
+
+	// 客户端关闭 stdin 后仍在等待已发送请求的响应，停止服务前需要全部写出
+	pending.Wait()
+	if f, ok := w.(interface{ Flush() error }); ok {
+		if ferr := f.Flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
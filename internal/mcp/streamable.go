@@ -0,0 +1,384 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Streamable HTTP 传输 (2025-03-26)
+// 所有交互都在同一个 endpoint 上完成:
+//   POST   /mcp 发送请求，响应以 application/json 或 text/event-stream 返回
+//   GET    /mcp 打开 SSE 流，接收服务端主动发送的消息
+//   DELETE /mcp 结束会话
+// Document: https://modelcontextprotocol.io/specification/2025-03-26/basic/transports#streamable-http
+
+const (
+	HeaderSessionID = "Mcp-Session-Id"
+
+	JSONContentType = "application/json"
+
+	// StreamableSessionTTL 会话超过此时间没有请求且没有打开的 SSE 流时被清理，其资源订阅随之取消
+	StreamableSessionTTL = 30 * time.Minute
+
+	// MaxStreamableSessions 最多保留的会话数量，达到上限时清理最久没有请求的空闲会话
+	MaxStreamableSessions = 1000
+
+	// StreamableSweepInterval 检查空闲会话的间隔
+	StreamableSweepInterval = time.Minute
+)
+
+// StreamableWriter 按请求 ID 将响应分发到对应的 POST 请求
+// 没有等待方的消息 (如服务端通知) 发送到 GET 打开的 SSE 流，没有 SSE 流时丢弃
+type StreamableWriter struct {
+	mu      sync.Mutex
+	pending map[string]chan []byte
+	stream  io.Writer
+}
+
+func NewStreamableWriter() *StreamableWriter {
+	return &StreamableWriter{
+		pending: make(map[string]chan []byte),
+	}
+}
+
+func (w *StreamableWriter) Write(p []byte) (n int, err error) {
+	var msg struct {
+		ID json.RawMessage `json:"id"`
+	}
+	_ = json.Unmarshal(p, &msg)
+
+	// Write 的调用方可能复用 p，这里复制一份
+	b := make([]byte, len(p))
+	copy(b, p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if ch, ok := w.pending[string(msg.ID)]; ok && len(msg.ID) > 0 {
+		delete(w.pending, string(msg.ID))
+		ch <- b
+		return len(p), nil
+	}
+	if w.stream != nil {
+		return w.stream.Write(b)
+	}
+	return len(p), nil
+}
+
+// wait 注册一个等待响应的请求 ID
+func (w *StreamableWriter) wait(id interface{}) (string, chan []byte) {
+	key := IDKey(id)
+	ch := make(chan []byte, 1)
+	w.mu.Lock()
+	w.pending[key] = ch
+	w.mu.Unlock()
+	return key, ch
+}
+
+func (w *StreamableWriter) cancel(key string) {
+	w.mu.Lock()
+	delete(w.pending, key)
+	w.mu.Unlock()
+}
+
+func (w *StreamableWriter) streaming() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stream != nil
+}
+
+func (w *StreamableWriter) setStream(stream io.Writer) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if stream != nil && w.stream != nil {
+		return false
+	}
+	w.stream = stream
+	return true
+}
+
+// IDKey 将请求 ID 转换为与响应中 "id" 字段一致的 JSON 表示，用于按 ID 匹配请求
+func IDKey(id interface{}) string {
+	b, _ := json.Marshal(id)
+	return string(b)
+}
+
+// HandleStreamable 处理 /mcp endpoint 的请求
+func (m *MCP) HandleStreamable(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodPost:
+		m.handleStreamablePost(c)
+	case http.MethodGet:
+		m.handleStreamableGet(c)
+	case http.MethodDelete:
+		m.handleStreamableDelete(c)
+	default:
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *MCP) handleStreamablePost(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrInvalidRequest.JsonRPC())
+		return
+	}
+
+	// 支持 JSON-RPC 批量请求
+	var reqs []*Request
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+	if batch {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		var req Request
+		err = json.Unmarshal(body, &req)
+		reqs = []*Request{&req}
+	}
+	if err != nil || len(reqs) == 0 {
+		c.JSON(http.StatusBadRequest, ErrParseError.JsonRPC())
+		return
+	}
+
+	session, ok := m.streamableSession(c, reqs)
+	if !ok {
+		return
+	}
+	w := session.w.(*StreamableWriter)
+
+	// 客户端发来的响应 (没有 method) 和通知 (没有 id) 不需要回复
+	keys := make([]string, 0, len(reqs))
+	chans := make([]chan []byte, 0, len(reqs))
+	for _, req := range reqs {
+		if req.Method == "" || req.ID == nil {
+			continue
+		}
+		key, ch := w.wait(req.ID)
+		keys = append(keys, key)
+		chans = append(chans, ch)
+	}
+
+	for i, req := range reqs {
+		if req.Method == "" {
+			continue
+		}
+		log.Debug().Msgf("session: %s, request: %s", session.id, req)
+		select {
+		case m.ProcessChan <- ProcessCtx{Session: session, Request: req}:
+		default:
+			// 已投递的请求会继续处理，其响应没有接收方时被丢弃
+			for _, key := range keys {
+				w.cancel(key)
+			}
+			log.Debug().Msgf("session: %s, drop %d requests", session.id, len(reqs)-i)
+			c.JSON(http.StatusTooManyRequests, ErrTooManyRequests.JsonRPC())
+			return
+		}
+	}
+
+	if len(chans) == 0 {
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	// 客户端接受 text/event-stream 时，每个响应完成后立即以 SSE 事件返回
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		sse := newSSEWriter(c, session.id)
+		for i, ch := range chans {
+			select {
+			case b := <-ch:
+				sse.WriteMessage(string(b))
+			case <-c.Request.Context().Done():
+				for _, key := range keys[i:] {
+					w.cancel(key)
+				}
+				return
+			}
+		}
+		return
+	}
+
+	resps := make([]json.RawMessage, 0, len(chans))
+	for i, ch := range chans {
+		select {
+		case b := <-ch:
+			resps = append(resps, b)
+		case <-c.Request.Context().Done():
+			for _, key := range keys[i:] {
+				w.cancel(key)
+			}
+			return
+		}
+	}
+
+	if batch {
+		c.JSON(http.StatusOK, resps)
+		return
+	}
+	c.Data(http.StatusOK, JSONContentType, resps[0])
+}
+
+// streamableSession 获取请求对应的会话，initialize 请求会创建新会话
+func (m *MCP) streamableSession(c *gin.Context, reqs []*Request) (*Session, bool) {
+	for _, req := range reqs {
+		if req.Method != MethodInitialize {
+			continue
+		}
+		if len(reqs) != 1 {
+			// initialize 请求不能包含在批量请求中
+			c.JSON(http.StatusBadRequest, ErrInvalidRequest.JsonRPC())
+			return nil, false
+		}
+		id := uuid.New().String()
+		session := &Session{
+			id: id,
+			w:  NewStreamableWriter(),
+		}
+		session.touch()
+		m.sessionMu.Lock()
+		ok := m.evictStreamable(time.Now(), MaxStreamableSessions-1)
+		if ok {
+			m.sessions[id] = session
+		}
+		m.sessionMu.Unlock()
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, ErrTooManyRequests.JsonRPC())
+			return nil, false
+		}
+		c.Header(HeaderSessionID, id)
+		return session, true
+	}
+
+	sessionID := c.GetHeader(HeaderSessionID)
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, ErrInvalidSessionID.JsonRPC())
+		return nil, false
+	}
+	session := m.GetSession(sessionID)
+	if session == nil {
+		c.JSON(http.StatusNotFound, ErrSessionNotFound.JsonRPC())
+		return nil, false
+	}
+	if _, ok := session.w.(*StreamableWriter); !ok {
+		c.JSON(http.StatusBadRequest, ErrInvalidSessionID.JsonRPC())
+		return nil, false
+	}
+	session.touch()
+	return session, true
+}
+
+// handleStreamableGet 打开 SSE 流，用于接收服务端通知，每个会话只允许一个
+func (m *MCP) handleStreamableGet(c *gin.Context) {
+	if !strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+	session := m.GetSession(c.GetHeader(HeaderSessionID))
+	if session == nil {
+		c.JSON(http.StatusNotFound, ErrSessionNotFound.JsonRPC())
+		return
+	}
+	w, ok := session.w.(*StreamableWriter)
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrInvalidSessionID.JsonRPC())
+		return
+	}
+
+	sse := &SSEWriter{id: session.id, c: c}
+	if !w.setStream(sse) {
+		c.JSON(http.StatusConflict, ErrInvalidRequest.JsonRPC())
+		return
+	}
+	// SSE 流关闭后重新开始计算空闲时间
+	defer session.touch()
+	defer w.setStream(nil)
+
+	sse.writeHeader()
+	go sse.ping()
+	<-c.Request.Context().Done()
+}
+
+func (m *MCP) handleStreamableDelete(c *gin.Context) {
+	sessionID := c.GetHeader(HeaderSessionID)
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, ErrInvalidSessionID.JsonRPC())
+		return
+	}
+
+	m.sessionMu.Lock()
+	_, ok := m.sessions[sessionID]
+	delete(m.sessions, sessionID)
+	m.sessionMu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrSessionNotFound.JsonRPC())
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// streamableIdle 返回 streamable 会话没有请求的时间，SSE 流打开期间和其他传输的会话返回 0
+func streamableIdle(s *Session, now time.Time) time.Duration {
+	w, ok := s.w.(*StreamableWriter)
+	if !ok || w.streaming() {
+		return 0
+	}
+	return now.Sub(time.Unix(0, s.lastActive.Load()))
+}
+
+// evictStreamable 清理空闲超时的会话，并在会话数量超过 limit 时依次清理最久没有请求的空闲会话
+// 调用方需持有 sessionMu，仍超过 limit 时返回 false
+func (m *MCP) evictStreamable(now time.Time, limit int) bool {
+	count := 0
+	for id, s := range m.sessions {
+		idle := streamableIdle(s, now)
+		if idle > StreamableSessionTTL {
+			delete(m.sessions, id)
+			log.Debug().Msgf("session: %s, expired after %s idle", id, idle)
+			continue
+		}
+		if _, ok := s.w.(*StreamableWriter); ok {
+			count++
+		}
+	}
+
+	for ; count > limit; count-- {
+		var oldest string
+		var oldestIdle time.Duration
+		for id, s := range m.sessions {
+			if idle := streamableIdle(s, now); idle > oldestIdle {
+				oldest, oldestIdle = id, idle
+			}
+		}
+		if oldest == "" {
+			return false
+		}
+		delete(m.sessions, oldest)
+		log.Debug().Msgf("session: %s, evicted after %s idle", oldest, oldestIdle)
+	}
+	return true
+}
+
+// sweepStreamable 定期清理空闲超时的会话，直到 MCP 关闭
+func (m *MCP) sweepStreamable() {
+	ticker := time.NewTicker(StreamableSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.sessionMu.Lock()
+			m.evictStreamable(now, MaxStreamableSessions)
+			m.sessionMu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	CandidateContact  = "contact"
+	CandidateChatRoom = "chatroom"
+	CandidateMember   = "member"
+)
+
+// Candidate 按名称查找到的联系人、群聊或群成员
+type Candidate struct {
+	UserName    string `json:"userName"`
+	DisplayName string `json:"displayName"`
+	Kind        string `json:"kind"`    // contact 联系人; chatroom 群聊; member 群成员
+	Field       string `json:"field"`   // 匹配的字段
+	Matched     string `json:"matched"` // 匹配的字段值
+	Score       int    `json:"score"`   // 匹配程度，越高越优先
+}
+
+func (c *Candidate) String() string {
+	if c.DisplayName == "" {
+		return c.UserName
+	}
+	return fmt.Sprintf("%s(%s)", c.DisplayName, c.UserName)
+}
+
+// CandidatesPlainText 候选列表的文本格式，每行一个候选
+func CandidatesPlainText(candidates []*Candidate) string {
+	if len(candidates) == 0 {
+		return "没有匹配的联系人或群聊\n"
+	}
+	buf := strings.Builder{}
+	for _, c := range candidates {
+		buf.WriteString(fmt.Sprintf("%s [%s] %s: %s\n", c.String(), c.Kind, c.Field, c.Matched))
+	}
+	return buf.String()
+}
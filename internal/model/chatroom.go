@@ -1,6 +1,9 @@
 package model
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/sjzar/chatlog/internal/model/wxproto"
 
 	"google.golang.org/protobuf/proto"
@@ -113,3 +116,67 @@ func (c *ChatRoom) DisplayName() string {
 	}
 	return ""
 }
+
+// ChatRoomDetail 群聊详情，包括完整的成员列表
+type ChatRoomDetail struct {
+	Name      string `json:"name"`
+	Remark    string `json:"remark"`
+	NickName  string `json:"nickName"`
+	Owner     string `json:"owner"`
+	OwnerName string `json:"ownerName"`
+
+	// 自己在群里的信息，无法确定时为空
+	SelfUserName    string `json:"selfUserName"`
+	SelfDisplayName string `json:"selfDisplayName"`
+
+	Members []*ChatRoomMember `json:"members"`
+}
+
+// ChatRoomMember 群聊成员
+type ChatRoomMember struct {
+	UserName    string `json:"userName"`
+	DisplayName string `json:"displayName"` // 群昵称
+	Alias       string `json:"alias"`
+	Remark      string `json:"remark"`
+	NickName    string `json:"nickName"`
+	IsFriend    bool   `json:"isFriend"`
+	IsOwner     bool   `json:"isOwner"`
+	IsSelf      bool   `json:"isSelf"`
+}
+
+// Name 成员的显示名称，依次使用群昵称、备注、昵称
+func (m *ChatRoomMember) Name() string {
+	switch {
+	case m.DisplayName != "":
+		return m.DisplayName
+	case m.Remark != "":
+		return m.Remark
+	case m.NickName != "":
+		return m.NickName
+	}
+	return m.UserName
+}
+
+func (c *ChatRoomDetail) PlainText() string {
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("Name: %s\n", c.Name))
+	buf.WriteString(fmt.Sprintf("Remark: %s\n", c.Remark))
+	buf.WriteString(fmt.Sprintf("NickName: %s\n", c.NickName))
+	buf.WriteString(fmt.Sprintf("Owner: %s(%s)\n", c.OwnerName, c.Owner))
+	if c.SelfUserName != "" {
+		buf.WriteString(fmt.Sprintf("我的群昵称: %s\n", c.SelfDisplayName))
+	}
+	buf.WriteString(fmt.Sprintf("\n成员 %d 人:\n", len(c.Members)))
+	buf.WriteString("UserName,DisplayName,Remark,NickName,IsFriend\n")
+	for _, m := range c.Members {
+		name := m.UserName
+		switch {
+		case m.IsSelf:
+			name += "(我)"
+		case m.IsOwner:
+			name += "(群主)"
+		}
+		buf.WriteString(fmt.Sprintf("%s,%s,%s,%s,%t\n", name, m.DisplayName, m.Remark, m.NickName, m.IsFriend))
+	}
+	return buf.String()
+}
@@ -1,11 +1,22 @@
 package model
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Contact struct {
 	UserName string `json:"userName"`
 	Alias    string `json:"alias"`
 	Remark   string `json:"remark"`
 	NickName string `json:"nickName"`
 	IsFriend bool   `json:"isFriend"`
+
+	// 拼音仅用于按拼音查找联系人，不对外输出
+	QuanPin         string `json:"-"` // 昵称全拼
+	PYInitial       string `json:"-"` // 昵称拼音首字母
+	RemarkQuanPin   string `json:"-"` // 备注全拼
+	RemarkPYInitial string `json:"-"` // 备注拼音首字母
 }
 
 // CREATE TABLE Contact(
@@ -47,6 +58,11 @@ type ContactV3 struct {
 	Remark    string `json:"Remark"`
 	NickName  string `json:"NickName"`
 	Reserved1 int    `json:"Reserved1"` // 1 自己好友或自己加入的群聊; 0 群聊成员(非好友)
+
+	QuanPin         string `json:"QuanPin"`
+	PYInitial       string `json:"PYInitial"`
+	RemarkQuanPin   string `json:"RemarkQuanPin"`
+	RemarkPYInitial string `json:"RemarkPYInitial"`
 }
 
 func (c *ContactV3) Wrap() *Contact {
@@ -56,6 +72,11 @@ func (c *ContactV3) Wrap() *Contact {
 		Remark:   c.Remark,
 		NickName: c.NickName,
 		IsFriend: c.Reserved1 == 1,
+
+		QuanPin:         c.QuanPin,
+		PYInitial:       c.PYInitial,
+		RemarkQuanPin:   c.RemarkQuanPin,
+		RemarkPYInitial: c.RemarkPYInitial,
 	}
 }
 
@@ -68,3 +89,39 @@ func (c *Contact) DisplayName() string {
 	}
 	return ""
 }
+
+// ContactDetail 联系人详情，包括与联系人共同所在的群聊
+type ContactDetail struct {
+	*Contact
+	ChatRooms []*ContactChatRoom `json:"chatRooms"`
+}
+
+// ContactChatRoom 联系人所在的群聊
+type ContactChatRoom struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"` // 群聊名称
+	UserCount   int    `json:"userCount"`
+	MemberName  string `json:"memberName"` // 联系人在群里的显示名称
+	IsOwner     bool   `json:"isOwner"`
+}
+
+func (c *ContactDetail) PlainText() string {
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("UserName: %s\n", c.UserName))
+	buf.WriteString(fmt.Sprintf("Alias: %s\n", c.Alias))
+	buf.WriteString(fmt.Sprintf("Remark: %s\n", c.Remark))
+	buf.WriteString(fmt.Sprintf("NickName: %s\n", c.NickName))
+	buf.WriteString(fmt.Sprintf("IsFriend: %t\n", c.IsFriend))
+	buf.WriteString(fmt.Sprintf("\n共同群聊 %d 个:\n", len(c.ChatRooms)))
+	for _, room := range c.ChatRooms {
+		buf.WriteString(fmt.Sprintf("%s(%s) %d人", room.DisplayName, room.Name, room.UserCount))
+		if room.MemberName != "" {
+			buf.WriteString(fmt.Sprintf(" 群昵称: %s", room.MemberName))
+		}
+		if room.IsOwner {
+			buf.WriteString(" 群主")
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
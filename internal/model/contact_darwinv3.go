@@ -40,6 +40,11 @@ type ContactDarwinV3 struct {
 	M_nsRemark    string `json:"m_nsRemark"`
 	M_uiSex       int    `json:"m_uiSex"`
 	M_nsAliasName string `json:"m_nsAliasName"`
+
+	M_nsFullPY        string `json:"m_nsFullPY"`
+	M_nsShortPY       string `json:"m_nsShortPY"`
+	M_nsRemarkPYFull  string `json:"m_nsRemarkPYFull"`
+	M_nsRemarkPYShort string `json:"m_nsRemarkPYShort"`
 }
 
 func (c *ContactDarwinV3) Wrap() *Contact {
@@ -49,5 +54,10 @@ func (c *ContactDarwinV3) Wrap() *Contact {
 		Remark:   c.M_nsRemark,
 		NickName: c.Nickname,
 		IsFriend: true,
+
+		QuanPin:         c.M_nsFullPY,
+		PYInitial:       c.M_nsShortPY,
+		RemarkQuanPin:   c.M_nsRemarkPYFull,
+		RemarkPYInitial: c.M_nsRemarkPYShort,
 	}
 }
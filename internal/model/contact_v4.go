@@ -30,6 +30,11 @@ type ContactV4 struct {
 	Remark    string `json:"remark"`
 	NickName  string `json:"nick_name"`
 	LocalType int    `json:"local_type"` // 2 群聊; 3 群聊成员(非好友); 5,6 企业微信;
+
+	QuanPin             string `json:"quan_pin"`
+	PinYinInitial       string `json:"pin_yin_initial"`
+	RemarkQuanPin       string `json:"remark_quan_pin"`
+	RemarkPinYinInitial string `json:"remark_pin_yin_initial"`
 }
 
 func (c *ContactV4) Wrap() *Contact {
@@ -39,5 +44,10 @@ func (c *ContactV4) Wrap() *Contact {
 		Remark:   c.Remark,
 		NickName: c.NickName,
 		IsFriend: c.LocalType != 3,
+
+		QuanPin:         c.QuanPin,
+		PYInitial:       c.PinYinInitial,
+		RemarkQuanPin:   c.RemarkQuanPin,
+		RemarkPYInitial: c.RemarkPinYinInitial,
 	}
 }
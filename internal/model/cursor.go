@@ -0,0 +1,60 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Cursor 消息分页游标，指向上一页最后一条消息
+// 消息按 Seq、Talker 排序，下一页从游标之后的消息开始，新消息不会影响已返回的分页
+type Cursor struct {
+	Seq    int64  `json:"s"`           // 最后一条消息的 Seq
+	Talker string `json:"t,omitempty"` // 最后一条消息的聊天对象
+	Shard  int64  `json:"d,omitempty"` // 最后一条消息所在数据库分片的开始时间 (Unix 秒)，更早开始的分片无需再查询
+}
+
+// NewCursor 创建指向指定消息的游标
+func NewCursor(m *Message, shard int64) *Cursor {
+	return &Cursor{
+		Seq:    m.Seq,
+		Talker: m.Talker,
+		Shard:  shard,
+	}
+}
+
+// ParseCursor 解析游标字符串，空字符串表示从头开始，返回 nil
+func ParseCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// String 编码为不透明的游标字符串
+func (c *Cursor) String() string {
+	if c == nil {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Before 判断消息是否在游标之后，即是否属于下一页
+// 游标为 nil 时所有消息都属于下一页
+func (c *Cursor) Before(m *Message) bool {
+	if c == nil {
+		return true
+	}
+	if m.Seq != c.Seq {
+		return m.Seq > c.Seq
+	}
+	return m.Talker > c.Talker
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"encoding/xml"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -379,3 +380,46 @@ func (m *Message) PlainTextContent() string {
 		return fmt.Sprintf("Type: %d Content: %s", m.Type, content)
 	}
 }
+
+// TalkerCount 单个聊天中的消息数量
+type TalkerCount struct {
+	Talker     string `json:"talker"`
+	TalkerName string `json:"talkerName"`
+	Count      int    `json:"count"`
+}
+
+func (t *TalkerCount) String() string {
+	if t.TalkerName != "" {
+		return fmt.Sprintf("%s(%s): %d", t.TalkerName, t.Talker, t.Count)
+	}
+	return fmt.Sprintf("%s: %d", t.Talker, t.Count)
+}
+
+// CountByTalker 按聊天统计消息数量，结果按数量降序排列
+func CountByTalker(messages []*Message) []*TalkerCount {
+	counts := make(map[string]*TalkerCount)
+	list := make([]*TalkerCount, 0)
+	for _, m := range messages {
+		c, ok := counts[m.Talker]
+		if !ok {
+			c = &TalkerCount{Talker: m.Talker}
+			counts[m.Talker] = c
+			list = append(list, c)
+		}
+		if c.TalkerName == "" {
+			switch {
+			case m.TalkerName != "":
+				c.TalkerName = m.TalkerName
+			case !m.IsChatRoom && m.Sender == m.Talker:
+				// 私聊中对方发送的消息，发送人即为聊天对象
+				c.TalkerName = m.SenderName
+			}
+		}
+		c.Count++
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Count > list[j].Count
+	})
+	return list
+}
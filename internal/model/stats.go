@@ -0,0 +1,375 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxResponseLatency 统计回复时间时，间隔超过该时长的消息视为新的对话，不计入回复时间
+const MaxResponseLatency = 12 * time.Hour
+
+var weekdayNames = []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// Stats 聊天统计
+type Stats struct {
+	Total     int             `json:"total"`
+	FirstTime time.Time       `json:"firstTime"`
+	LastTime  time.Time       `json:"lastTime"`
+	Talkers   []*TalkerCount  `json:"talkers,omitempty"` // 各聊天的消息数量，仅在统计多个聊天时返回
+	Senders   []*SenderCount  `json:"senders"`
+	Types     []*TypeCount    `json:"types"`
+	Days      []*DayCount     `json:"days"`
+	Hours     [24]int         `json:"hours"`
+	Heatmap   [7][24]int      `json:"heatmap"` // 星期（0 为周日）× 小时
+	Latency   []*LatencyStats `json:"latency"`
+}
+
+// SenderCount 发送者的消息数量
+type SenderCount struct {
+	Sender     string `json:"sender"`
+	SenderName string `json:"senderName"`
+	IsSelf     bool   `json:"isSelf"`
+	Count      int    `json:"count"`
+}
+
+// TypeCount 消息类型的消息数量
+type TypeCount struct {
+	Type    int64  `json:"type"`
+	SubType int64  `json:"subType"`
+	Name    string `json:"name"`
+	Count   int    `json:"count"`
+}
+
+// DayCount 每日消息数量
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// LatencyStats 发送者回复其他人消息所用的时间，单位为秒
+type LatencyStats struct {
+	Sender     string `json:"sender"`
+	SenderName string `json:"senderName"`
+	IsSelf     bool   `json:"isSelf"`
+	Count      int    `json:"count"`
+	Average    int64  `json:"average"`
+	Median     int64  `json:"median"`
+	P90        int64  `json:"p90"`
+}
+
+// StatsBuilder 逐条累计消息，生成聊天统计，无需保留原始消息
+type StatsBuilder struct {
+	stats     *Stats
+	talkers   map[string]*TalkerCount
+	senders   map[string]*SenderCount
+	types     map[[2]int64]*TypeCount
+	days      map[string]*DayCount
+	latencies map[string][]int64
+	last      map[string]*Message // 各聊天的上一条消息
+}
+
+func NewStatsBuilder() *StatsBuilder {
+	return &StatsBuilder{
+		stats:     &Stats{},
+		talkers:   make(map[string]*TalkerCount),
+		senders:   make(map[string]*SenderCount),
+		types:     make(map[[2]int64]*TypeCount),
+		days:      make(map[string]*DayCount),
+		latencies: make(map[string][]int64),
+		last:      make(map[string]*Message),
+	}
+}
+
+// Add 累计一条消息，同一聊天的消息需按时间顺序添加，不同聊天之间的顺序不影响结果
+func (b *StatsBuilder) Add(m *Message) {
+	s := b.stats
+	s.Total++
+	if s.FirstTime.IsZero() || m.Time.Before(s.FirstTime) {
+		s.FirstTime = m.Time
+	}
+	if m.Time.After(s.LastTime) {
+		s.LastTime = m.Time
+	}
+
+	tc, ok := b.talkers[m.Talker]
+	if !ok {
+		tc = &TalkerCount{Talker: m.Talker}
+		b.talkers[m.Talker] = tc
+	}
+	if tc.TalkerName == "" {
+		tc.TalkerName = m.TalkerName
+	}
+	tc.Count++
+
+	typeKey := [2]int64{m.Type, m.SubType}
+	typ, ok := b.types[typeKey]
+	if !ok {
+		typ = &TypeCount{Type: m.Type, SubType: m.SubType, Name: TypeName(m.Type, m.SubType)}
+		b.types[typeKey] = typ
+	}
+	typ.Count++
+
+	date := m.Time.Format("2006-01-02")
+	day, ok := b.days[date]
+	if !ok {
+		day = &DayCount{Date: date}
+		b.days[date] = day
+	}
+	day.Count++
+	s.Hours[m.Time.Hour()]++
+	s.Heatmap[m.Time.Weekday()][m.Time.Hour()]++
+
+	// 系统消息没有发送者
+	if m.Type == 10000 || m.Sender == "" {
+		return
+	}
+
+	sc, ok := b.senders[m.Sender]
+	if !ok {
+		sc = &SenderCount{Sender: m.Sender, IsSelf: m.IsSelf}
+		b.senders[m.Sender] = sc
+	}
+	if sc.SenderName == "" {
+		sc.SenderName = m.SenderName
+	}
+	sc.Count++
+
+	// 同一聊天中发送者与上一条消息不同时，视为对上一条消息的回复
+	if last, ok := b.last[m.Talker]; ok && last.Sender != m.Sender {
+		if d := m.Time.Sub(last.Time); d >= 0 && d <= MaxResponseLatency {
+			b.latencies[m.Sender] = append(b.latencies[m.Sender], int64(d.Seconds()))
+		}
+	}
+	b.last[m.Talker] = &Message{Sender: m.Sender, Time: m.Time}
+}
+
+// Build 生成统计结果，top 大于 0 时只保留消息数量最多的 top 个发送者和聊天
+func (b *StatsBuilder) Build(top int) *Stats {
+	s := b.stats
+
+	if len(b.talkers) > 1 {
+		for _, tc := range b.talkers {
+			s.Talkers = append(s.Talkers, tc)
+		}
+		sort.Slice(s.Talkers, func(i, j int) bool {
+			if s.Talkers[i].Count != s.Talkers[j].Count {
+				return s.Talkers[i].Count > s.Talkers[j].Count
+			}
+			return s.Talkers[i].Talker < s.Talkers[j].Talker
+		})
+		if top > 0 && len(s.Talkers) > top {
+			s.Talkers = s.Talkers[:top]
+		}
+	}
+
+	s.Senders = make([]*SenderCount, 0, len(b.senders))
+	for _, sc := range b.senders {
+		s.Senders = append(s.Senders, sc)
+	}
+	sort.Slice(s.Senders, func(i, j int) bool {
+		if s.Senders[i].Count != s.Senders[j].Count {
+			return s.Senders[i].Count > s.Senders[j].Count
+		}
+		return s.Senders[i].Sender < s.Senders[j].Sender
+	})
+	if top > 0 && len(s.Senders) > top {
+		s.Senders = s.Senders[:top]
+	}
+
+	s.Types = make([]*TypeCount, 0, len(b.types))
+	for _, typ := range b.types {
+		s.Types = append(s.Types, typ)
+	}
+	sort.Slice(s.Types, func(i, j int) bool {
+		if s.Types[i].Count != s.Types[j].Count {
+			return s.Types[i].Count > s.Types[j].Count
+		}
+		if s.Types[i].Type != s.Types[j].Type {
+			return s.Types[i].Type < s.Types[j].Type
+		}
+		return s.Types[i].SubType < s.Types[j].SubType
+	})
+
+	s.Days = make([]*DayCount, 0, len(b.days))
+	for _, day := range b.days {
+		s.Days = append(s.Days, day)
+	}
+	sort.Slice(s.Days, func(i, j int) bool {
+		return s.Days[i].Date < s.Days[j].Date
+	})
+
+	s.Latency = make([]*LatencyStats, 0, len(b.latencies))
+	for sender, latencies := range b.latencies {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var sum int64
+		for _, l := range latencies {
+			sum += l
+		}
+		ls := &LatencyStats{
+			Sender:  sender,
+			Count:   len(latencies),
+			Average: sum / int64(len(latencies)),
+			Median:  latencies[len(latencies)/2],
+			P90:     latencies[len(latencies)*9/10],
+		}
+		if sc, ok := b.senders[sender]; ok {
+			ls.SenderName, ls.IsSelf = sc.SenderName, sc.IsSelf
+		}
+		s.Latency = append(s.Latency, ls)
+	}
+	sort.Slice(s.Latency, func(i, j int) bool {
+		if s.Latency[i].Count != s.Latency[j].Count {
+			return s.Latency[i].Count > s.Latency[j].Count
+		}
+		return s.Latency[i].Sender < s.Latency[j].Sender
+	})
+	if top > 0 && len(s.Latency) > top {
+		s.Latency = s.Latency[:top]
+	}
+
+	return s
+}
+
+// PlainText 统计结果的文本摘要，每日消息数量超过 62 天时按月汇总
+func (s *Stats) PlainText() string {
+	buf := strings.Builder{}
+	if s.Total == 0 {
+		buf.WriteString("没有消息\n")
+		return buf.String()
+	}
+
+	buf.WriteString(fmt.Sprintf("共 %d 条消息，%s ~ %s\n", s.Total, s.FirstTime.Format("2006-01-02 15:04:05"), s.LastTime.Format("2006-01-02 15:04:05")))
+
+	if len(s.Talkers) > 0 {
+		buf.WriteString("\n聊天:\n")
+		for _, tc := range s.Talkers {
+			buf.WriteString(tc.String())
+			buf.WriteString("\n")
+		}
+	}
+
+	buf.WriteString("\n发送者:\n")
+	for _, sc := range s.Senders {
+		buf.WriteString(fmt.Sprintf("%s: %d (%.1f%%)\n", displayName(sc.SenderName, sc.Sender, sc.IsSelf), sc.Count, float64(sc.Count)*100/float64(s.Total)))
+	}
+
+	buf.WriteString("\n消息类型:\n")
+	for _, typ := range s.Types {
+		buf.WriteString(fmt.Sprintf("%s: %d\n", typ.Name, typ.Count))
+	}
+
+	if len(s.Days) > 62 {
+		buf.WriteString("\n每月消息:\n")
+		month, count := "", 0
+		for _, day := range s.Days {
+			if m := day.Date[:7]; m != month {
+				if month != "" {
+					buf.WriteString(fmt.Sprintf("%s: %d\n", month, count))
+				}
+				month, count = m, 0
+			}
+			count += day.Count
+		}
+		buf.WriteString(fmt.Sprintf("%s: %d\n", month, count))
+	} else {
+		buf.WriteString("\n每日消息:\n")
+		for _, day := range s.Days {
+			buf.WriteString(fmt.Sprintf("%s: %d\n", day.Date, day.Count))
+		}
+	}
+
+	buf.WriteString("\n时段分布:\n")
+	for hour, count := range s.Hours {
+		if count > 0 {
+			buf.WriteString(fmt.Sprintf("%02d时: %d\n", hour, count))
+		}
+	}
+
+	weekday, hour, busiest := 0, 0, 0
+	for w := range s.Heatmap {
+		for h, count := range s.Heatmap[w] {
+			if count > busiest {
+				weekday, hour, busiest = w, h, count
+			}
+		}
+	}
+	buf.WriteString(fmt.Sprintf("最活跃时段: %s %02d时 (%d 条)\n", weekdayNames[weekday], hour, busiest))
+
+	if len(s.Latency) > 0 {
+		buf.WriteString("\n回复时间:\n")
+		for _, ls := range s.Latency {
+			buf.WriteString(fmt.Sprintf("%s: 回复 %d 次，平均 %s，中位数 %s，P90 %s\n",
+				displayName(ls.SenderName, ls.Sender, ls.IsSelf), ls.Count,
+				time.Duration(ls.Average)*time.Second, time.Duration(ls.Median)*time.Second, time.Duration(ls.P90)*time.Second))
+		}
+	}
+
+	return buf.String()
+}
+
+func displayName(name, id string, isSelf bool) string {
+	if isSelf && name == "" {
+		name = "我"
+	}
+	if name == "" {
+		return id
+	}
+	return fmt.Sprintf("%s(%s)", name, id)
+}
+
+// TypeName 消息类型的名称
+func TypeName(_type, subType int64) string {
+	switch _type {
+	case 1:
+		return "文本"
+	case 3:
+		return "图片"
+	case 34:
+		return "语音"
+	case 42:
+		return "名片"
+	case 43:
+		return "视频"
+	case 47:
+		return "动画表情"
+	case 48:
+		return "位置"
+	case 49:
+		switch subType {
+		case 5:
+			return "链接"
+		case 6:
+			return "文件"
+		case 8:
+			return "GIF表情"
+		case 19:
+			return "合并转发"
+		case 33, 36:
+			return "小程序"
+		case 51, 63:
+			return "视频号"
+		case 57:
+			return "引用"
+		case 62:
+			return "拍一拍"
+		case 87:
+			return "群公告"
+		case 2000:
+			return "转账"
+		case 2001:
+			return "红包"
+		case 2003:
+			return "红包封面"
+		default:
+			return fmt.Sprintf("分享(%d)", subType)
+		}
+	case 50:
+		return "语音通话"
+	case 10000:
+		return "系统消息"
+	default:
+		return fmt.Sprintf("其他(%d)", _type)
+	}
+}
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"context"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// Codec 各版本解密器共用的数据库加解密流程
+// 各版本只在页面大小、保留字节数、HMAC 算法和密钥派生方式上不同，由解密器创建时指定
+type Codec struct {
+	Name     string           // 版本名称，同时用于区分派生密钥缓存
+	PageSize int              // 页面大小
+	Reserve  int              // 每页末尾的保留字节数，依次存放 IV 和 HMAC
+	HMACSize int              // HMAC 长度
+	HashFunc func() hash.Hash // HMAC 和 PBKDF2 使用的哈希算法
+	Derive   DeriveFunc       // 由原始密钥和盐值派生加密密钥和 MAC 密钥
+}
+
+// deriveKeys 派生加密密钥和 MAC 密钥，结果按原始密钥和盐值缓存
+func (c *Codec) deriveKeys(key []byte, salt []byte) ([]byte, []byte) {
+	return DeriveKeys(c.Name, key, salt, c.Derive)
+}
+
+// lookupKeys 派生加密密钥和 MAC 密钥，优先使用缓存，未命中时直接派生且不放入缓存
+// 用于尚未验证的密钥，避免错误的密钥挤占缓存
+func (c *Codec) lookupKeys(key []byte, salt []byte) ([]byte, []byte) {
+	if encKey, macKey, ok := CachedKeys(c.Name, key, salt); ok {
+		return encKey, macKey
+	}
+	return c.Derive(key, salt)
+}
+
+func (c *Codec) decryptPage(encKey, macKey []byte) PageFunc {
+	return func(page []byte, pageNum int64) ([]byte, error) {
+		return DecryptPage(page, encKey, macKey, pageNum, c.HashFunc, c.HMACSize, c.Reserve, c.PageSize)
+	}
+}
+
+// Validate 验证密钥是否有效
+func (c *Codec) Validate(page1 []byte, key []byte) bool {
+	if len(page1) < c.PageSize || len(key) != KeySize {
+		return false
+	}
+
+	// 候选密钥大多无效，未命中缓存时直接派生，验证通过后才放入缓存
+	salt := page1[:SaltSize]
+	var encKey, macKey []byte
+	cached := false
+	derive := func(key []byte, salt []byte) ([]byte, []byte) {
+		encKey, macKey, cached = CachedKeys(c.Name, key, salt)
+		if !cached {
+			encKey, macKey = c.Derive(key, salt)
+		}
+		return encKey, macKey
+	}
+	if !ValidateKey(page1, key, salt, c.HashFunc, c.HMACSize, c.Reserve, c.PageSize, derive) {
+		return false
+	}
+	if !cached {
+		CacheKeys(c.Name, key, salt, encKey, macKey)
+	}
+	return true
+}
+
+// openEncrypted 解码并验证密钥，返回数据库文件的基本信息和派生的密钥
+func (c *Codec) openEncrypted(dbfile string, hexKey string) (*DBFile, []byte, []byte, error) {
+	// 解码密钥
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, nil, nil, errors.DecodeKeyFailed(err)
+	}
+
+	// 打开数据库文件并读取基本信息
+	dbInfo, err := OpenDBFile(dbfile, c.PageSize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 验证密钥
+	if !c.Validate(dbInfo.FirstPage, key) {
+		return nil, nil, nil, errors.ErrDecryptIncorrectKey
+	}
+
+	// 计算密钥
+	encKey, macKey := c.deriveKeys(key, dbInfo.Salt)
+	return dbInfo, encKey, macKey, nil
+}
+
+// Decrypt 解密数据库
+func (c *Codec) Decrypt(ctx context.Context, dbfile string, hexKey string, output io.Writer) error {
+	dbInfo, encKey, macKey, err := c.openEncrypted(dbfile, hexKey)
+	if err != nil {
+		return err
+	}
+
+	// 打开数据库文件
+	dbFile, err := os.Open(dbfile)
+	if err != nil {
+		return errors.OpenFileFailed(dbfile, err)
+	}
+	defer dbFile.Close()
+
+	// 写入 SQLite 头
+	_, err = output.Write([]byte(SQLiteHeader))
+	if err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+
+	// 逐页解密，页面较多时并行解密
+	return ProcessPages(ctx, dbFile, dbInfo.TotalPages, c.PageSize, output, c.decryptPage(encKey, macKey))
+}
+
+// DecryptWAL 解密 WAL 文件中已提交的页面并写回已解密的数据库，返回重放的页面数量
+func (c *Codec) DecryptWAL(ctx context.Context, dbfile string, hexKey string, output *os.File) (int, error) {
+	// WAL 与数据库文件使用相同的盐值和密钥
+	_, encKey, macKey, err := c.openEncrypted(dbfile, hexKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return ReplayWAL(ctx, dbfile+"-wal", c.PageSize, output, c.decryptPage(encKey, macKey))
+}
+
+// DecryptChanged 增量解密数据库，只解密 HMAC 与上次不同的页面并写入 output 的对应位置
+// prev 为空时解密全部页面，返回本次的页面状态和解密的页面数量
+func (c *Codec) DecryptChanged(ctx context.Context, dbfile string, hexKey string, output *os.File, prev *PageState) (*PageState, int, error) {
+	dbInfo, encKey, macKey, err := c.openEncrypted(dbfile, hexKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 打开数据库文件
+	dbFile, err := os.Open(dbfile)
+	if err != nil {
+		return nil, 0, errors.OpenFileFailed(dbfile, err)
+	}
+	defer dbFile.Close()
+
+	return DecryptChangedPages(ctx, dbFile, dbInfo, c.PageSize, c.Reserve, output, prev, c.decryptPage(encKey, macKey))
+}
+
+// Encrypt 使用原始密钥和盐值将明文数据库重新加密，是 Decrypt 的逆操作
+// 明文数据库的页面大小和保留字节数需与当前版本一致，输出可被微信和 Decrypt 读取
+func (c *Codec) Encrypt(ctx context.Context, dbfile string, hexKey string, salt []byte, output io.Writer) error {
+	// 解码密钥
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return errors.DecodeKeyFailed(err)
+	}
+	if len(key) != KeySize {
+		return errors.ErrDecryptIncorrectKey
+	}
+	if len(salt) != SaltSize {
+		return errors.SaltSizeInvalid(len(salt), SaltSize)
+	}
+
+	// 打开明文数据库文件并检查页面布局
+	dbInfo, err := OpenPlainDBFile(dbfile, c.PageSize, c.Reserve)
+	if err != nil {
+		return err
+	}
+
+	// 计算密钥，盐值由调用方指定，无法验证密钥，不放入缓存
+	encKey, macKey := c.lookupKeys(key, salt)
+
+	// 打开数据库文件
+	dbFile, err := os.Open(dbfile)
+	if err != nil {
+		return errors.OpenFileFailed(dbfile, err)
+	}
+	defer dbFile.Close()
+
+	// 写入盐值，替代第一页的 SQLite 头
+	if _, err := output.Write(salt); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+
+	// 逐页加密，页面较多时并行加密
+	return ProcessPages(ctx, dbFile, dbInfo.TotalPages, c.PageSize, output, func(page []byte, pageNum int64) ([]byte, error) {
+		return EncryptPage(page, encKey, macKey, pageNum, c.HashFunc, c.HMACSize, c.Reserve, c.PageSize)
+	})
+}
+
+// Verify 逐页校验数据库的 HMAC，返回校验失败的页面
+// output 不为空时同时解密，校验失败的页面以全零写入，用于从部分损坏的数据库中恢复数据
+func (c *Codec) Verify(ctx context.Context, dbfile string, hexKey string, output io.Writer) (*VerifyResult, error) {
+	// 解码密钥
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, errors.DecodeKeyFailed(err)
+	}
+	if len(key) != KeySize {
+		return nil, errors.ErrDecryptIncorrectKey
+	}
+
+	// 打开数据库文件并读取基本信息，第一页校验失败时同样逐页校验
+	dbInfo, err := OpenDBFile(dbfile, c.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// 计算密钥，第一页验证通过时才放入缓存
+	encKey, macKey := c.lookupKeys(key, dbInfo.Salt)
+	derived := func([]byte, []byte) ([]byte, []byte) { return encKey, macKey }
+	if ValidateKey(dbInfo.FirstPage, key, dbInfo.Salt, c.HashFunc, c.HMACSize, c.Reserve, c.PageSize, derived) {
+		CacheKeys(c.Name, key, dbInfo.Salt, encKey, macKey)
+	}
+
+	// 打开数据库文件
+	dbFile, err := os.Open(dbfile)
+	if err != nil {
+		return nil, errors.OpenFileFailed(dbfile, err)
+	}
+	defer dbFile.Close()
+
+	return VerifyPages(ctx, dbFile, dbInfo.TotalPages, c.PageSize, output, func(page []byte, pageNum int64) bool {
+		return VerifyPage(page, macKey, pageNum, c.HashFunc, c.HMACSize, c.Reserve, c.PageSize)
+	}, c.decryptPage(encKey, macKey))
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCodecCachesOnlyVerifiedKeys(t *testing.T) {
+	const pageSize, reserve = 1024, IVSize + 32
+	c := &Codec{
+		Name:     "codec_test",
+		PageSize: pageSize,
+		Reserve:  reserve,
+		HMACSize: 32,
+		HashFunc: sha256.New,
+		Derive: func(key []byte, salt []byte) ([]byte, []byte) {
+			encKey := sha256.Sum256(append(append([]byte(nil), key...), salt...))
+			macKey := sha256.Sum256(encKey[:])
+			return encKey[:], macKey[:]
+		},
+	}
+
+	// 两页的明文数据库，只需要文件头中的页面大小和保留字节数
+	plain := bytes.Repeat([]byte{0x5a}, 2*pageSize)
+	copy(plain, SQLiteHeader)
+	binary.BigEndian.PutUint16(plain[16:18], pageSize)
+	plain[20] = reserve
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain.db")
+	if err := os.WriteFile(plainPath, plain, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := bytes.Repeat([]byte{1}, KeySize)
+	wrongKey := bytes.Repeat([]byte{2}, KeySize)
+	salt := bytes.Repeat([]byte{3}, SaltSize)
+	cached := func(key []byte) bool {
+		_, _, ok := CachedKeys(c.Name, key, salt)
+		return ok
+	}
+
+	var encrypted bytes.Buffer
+	if err := c.Encrypt(context.Background(), plainPath, hex.EncodeToString(key), salt, &encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if cached(key) {
+		t.Error("Encrypt() cached the derived keys")
+	}
+	encPath := filepath.Join(dir, "encrypted.db")
+	if err := os.WriteFile(encPath, encrypted.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.Verify(context.Background(), encPath, hex.EncodeToString(wrongKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.AllBad() {
+		t.Errorf("Verify(wrong key) = %+v, want all pages bad", result)
+	}
+	if cached(wrongKey) {
+		t.Error("Verify(wrong key) cached the derived keys")
+	}
+
+	result, err = c.Verify(context.Background(), encPath, hex.EncodeToString(key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CheckedPages != 2 || len(result.BadPages) != 0 {
+		t.Errorf("Verify(key) = %+v, want 2 good pages", result)
+	}
+	if !cached(key) {
+		t.Error("Verify(key) did not cache the verified keys")
+	}
+}
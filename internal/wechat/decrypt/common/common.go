@@ -97,7 +97,8 @@ func ValidateKey(page1 []byte, key []byte, salt []byte, hashFunc func() hash.Has
 	return hmac.Equal(calculatedMAC, storedMAC)
 }
 
-func DecryptPage(pageBuf []byte, encKey []byte, macKey []byte, pageNum int64, hashFunc func() hash.Hash, hmacSize int, reserve int, pageSize int) ([]byte, error) {
+// VerifyPage 校验页面的 HMAC，pageNum 从 0 开始
+func VerifyPage(pageBuf []byte, macKey []byte, pageNum int64, hashFunc func() hash.Hash, hmacSize int, reserve int, pageSize int) bool {
 	offset := 0
 	if pageNum == 0 {
 		offset = SaltSize
@@ -115,7 +116,16 @@ func DecryptPage(pageBuf []byte, encKey []byte, macKey []byte, pageNum int64, ha
 	hashMacStartOffset := pageSize - reserve + IVSize
 	hashMacEndOffset := hashMacStartOffset + hmacSize
 
-	if !bytes.Equal(hashMac, pageBuf[hashMacStartOffset:hashMacEndOffset]) {
+	return bytes.Equal(hashMac, pageBuf[hashMacStartOffset:hashMacEndOffset])
+}
+
+func DecryptPage(pageBuf []byte, encKey []byte, macKey []byte, pageNum int64, hashFunc func() hash.Hash, hmacSize int, reserve int, pageSize int) ([]byte, error) {
+	offset := 0
+	if pageNum == 0 {
+		offset = SaltSize
+	}
+
+	if !VerifyPage(pageBuf, macKey, pageNum, hashFunc, hmacSize, reserve, pageSize) {
 		return nil, errors.ErrDecryptHashVerificationFailed
 	}
 
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// OpenPlainDBFile 打开待加密的明文数据库文件并读取基本信息
+// 文件的页面大小和保留字节数需与目标版本一致，保留区域用于存放加密后的 IV 和 HMAC
+// 由本工具解密的数据库保留了原始的页面布局，可直接重新加密
+func OpenPlainDBFile(dbPath string, pageSize int, reserve int) (*DBFile, error) {
+	fp, err := os.Open(dbPath)
+	if err != nil {
+		return nil, errors.OpenFileFailed(dbPath, err)
+	}
+	defer fp.Close()
+
+	fileInfo, err := fp.Stat()
+	if err != nil {
+		return nil, errors.StatFileFailed(dbPath, err)
+	}
+
+	buffer := make([]byte, pageSize)
+	n, err := io.ReadFull(fp, buffer)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, errors.IncompleteRead(fmt.Errorf("read %d bytes, expected %d", n, pageSize))
+		}
+		return nil, errors.ReadFileFailed(dbPath, err)
+	}
+
+	if !bytes.Equal(buffer[:len(SQLiteHeader)], []byte(SQLiteHeader)) {
+		return nil, errors.NotSQLiteFile(dbPath)
+	}
+
+	// SQLite 文件头偏移 16 处为大端序的页面大小，1 表示 65536；偏移 20 处为每页的保留字节数
+	filePageSize := int(binary.BigEndian.Uint16(buffer[16:18]))
+	if filePageSize == 1 {
+		filePageSize = 65536
+	}
+	fileReserve := int(buffer[20])
+	if filePageSize != pageSize || fileReserve != reserve {
+		return nil, errors.PlainDBLayoutMismatch(dbPath, filePageSize, fileReserve, pageSize, reserve)
+	}
+
+	return &DBFile{
+		Path:       dbPath,
+		FirstPage:  buffer,
+		TotalPages: fileInfo.Size() / int64(pageSize),
+	}, nil
+}
+
+// EncryptPage 加密单个明文页面，是 DecryptPage 的逆操作
+// 每个页面使用随机 IV，保留区域依次存放 IV 和 HMAC，其余字节置零
+// 第一页返回的数据不含盐值，调用方需先写入盐值
+func EncryptPage(pageBuf []byte, encKey []byte, macKey []byte, pageNum int64, hashFunc func() hash.Hash, hmacSize int, reserve int, pageSize int) ([]byte, error) {
+	offset := 0
+	if pageNum == 0 {
+		offset = SaltSize
+	}
+
+	encrypted := make([]byte, pageSize-offset)
+	copy(encrypted, pageBuf[offset:pageSize-reserve])
+
+	ivOffset := pageSize - reserve - offset
+	iv := encrypted[ivOffset : ivOffset+IVSize]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errors.EncryptGenerateIVFailed(err)
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, errors.DecryptCreateCipherFailed(err)
+	}
+	mode := cipher.NewCBCEncrypter(block, iv)
+	mode.CryptBlocks(encrypted[:ivOffset], encrypted[:ivOffset])
+
+	mac := hmac.New(hashFunc, macKey)
+	mac.Write(encrypted[:ivOffset+IVSize])
+
+	pageNoBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(pageNoBytes, uint32(pageNum+1))
+	mac.Write(pageNoBytes)
+
+	copy(encrypted[ivOffset+IVSize:ivOffset+IVSize+hmacSize], mac.Sum(nil))
+
+	return encrypted, nil
+}
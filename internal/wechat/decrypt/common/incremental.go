@@ -0,0 +1,93 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// PageState 上次解密时数据库文件的盐值和各页面的 HMAC 摘要，用于增量解密
+// 页面每次写入都会使用新的 IV，密文变化时 HMAC 必然变化
+type PageState struct {
+	Salt []byte
+	MACs []uint64 // 各页面 HMAC 的前 8 字节，全零页面为 0
+}
+
+// DecryptChangedPages 解密数据库文件中的页面并写入 output 的对应位置
+// prev 为空时解密全部页面，output 应为新建的空文件；否则只解密 HMAC 与 prev 不同的页面，原地更新 output
+// 盐值变化或页数减少时无法增量更新，返回 ErrPageStateStale，调用方需重新完整解密
+// 返回本次的页面状态和解密的页面数量
+func DecryptChangedPages(ctx context.Context, input *os.File, dbInfo *DBFile, pageSize int, reserve int, output *os.File, prev *PageState, decrypt PageFunc) (*PageState, int, error) {
+	if prev != nil && (!bytes.Equal(prev.Salt, dbInfo.Salt) || dbInfo.TotalPages < int64(len(prev.MACs))) {
+		return nil, 0, errors.ErrPageStateStale
+	}
+
+	macOffset := pageSize - reserve + IVSize
+	state := &PageState{
+		Salt: append([]byte(nil), dbInfo.Salt...),
+		MACs: make([]uint64, dbInfo.TotalPages),
+	}
+
+	// 首次解密时页面较多，使用并行解密并在解密时记录 HMAC
+	if prev == nil {
+		if _, err := output.Write([]byte(SQLiteHeader)); err != nil {
+			return nil, 0, errors.WriteOutputFailed(err)
+		}
+		err := ProcessPages(ctx, input, dbInfo.TotalPages, pageSize, output, func(page []byte, pageNum int64) ([]byte, error) {
+			state.MACs[pageNum] = binary.LittleEndian.Uint64(page[macOffset:])
+			return decrypt(page, pageNum)
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		return state, int(dbInfo.TotalPages), nil
+	}
+
+	changed := 0
+	buf := make([]byte, BatchPages*pageSize)
+	for start := int64(0); start < dbInfo.TotalPages; start += BatchPages {
+		if ctx.Err() != nil {
+			return nil, changed, errors.ErrDecryptOperationCanceled
+		}
+
+		n, err := io.ReadFull(input, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, changed, errors.ReadFileFailed(input.Name(), err)
+		}
+
+		for i := 0; i+pageSize <= n; i += pageSize {
+			pageNum := start + int64(i/pageSize)
+			page := buf[i : i+pageSize]
+			if !IsZeroPage(page) {
+				state.MACs[pageNum] = binary.LittleEndian.Uint64(page[macOffset:])
+			}
+			if pageNum < int64(len(prev.MACs)) && prev.MACs[pageNum] == state.MACs[pageNum] {
+				continue
+			}
+
+			out := page
+			if !IsZeroPage(page) {
+				if out, err = decrypt(page, pageNum); err != nil {
+					return nil, changed, err
+				}
+				if pageNum == 0 {
+					out = append([]byte(SQLiteHeader), out...)
+				}
+			}
+			if _, err := output.WriteAt(out, pageNum*int64(pageSize)); err != nil {
+				return nil, changed, errors.WriteOutputFailed(err)
+			}
+			changed++
+		}
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	return state, changed, nil
+}
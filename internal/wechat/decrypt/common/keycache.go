@@ -0,0 +1,110 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// MaxCachedKeys 派生密钥缓存的容量，超出时淘汰最久未使用的条目
+// 同一账号的数据库共用原始密钥但盐值各不相同，容量需大于账号中的数据库数量
+const MaxCachedKeys = 256
+
+// DeriveFunc 由原始密钥和盐值派生加密密钥和 MAC 密钥
+type DeriveFunc func(key []byte, salt []byte) ([]byte, []byte)
+
+type keyCacheKey struct {
+	name string
+	key  [KeySize]byte
+	salt [SaltSize]byte
+}
+
+type keyCacheEntry struct {
+	cacheKey keyCacheKey
+	encKey   []byte
+	macKey   []byte
+}
+
+var keyCache = struct {
+	mu    sync.RWMutex
+	items map[keyCacheKey]*list.Element
+	lru   *list.List
+}{
+	items: make(map[keyCacheKey]*list.Element),
+	lru:   list.New(),
+}
+
+// DeriveKeys 返回由原始密钥和盐值派生的加密密钥和 MAC 密钥，结果按 (name, key, salt) 缓存
+// 派生需要数十万次 PBKDF2 迭代，缓存后同一数据库的重复验证和解密无需重新派生
+// name 用于区分派生方式不同的解密器，返回的密钥由缓存共享，调用方不可修改
+// 调用方需确保密钥已验证有效，未验证的候选密钥应使用 CachedKeys 和 CacheKeys
+func DeriveKeys(name string, key []byte, salt []byte, derive DeriveFunc) ([]byte, []byte) {
+	if len(key) != KeySize || len(salt) != SaltSize {
+		return derive(key, salt)
+	}
+
+	k := keyCacheKey{name: name, key: [KeySize]byte(key), salt: [SaltSize]byte(salt)}
+
+	keyCache.mu.Lock()
+	if elem, ok := keyCache.items[k]; ok {
+		keyCache.lru.MoveToFront(elem)
+		entry := elem.Value.(*keyCacheEntry)
+		keyCache.mu.Unlock()
+		return entry.encKey, entry.macKey
+	}
+	keyCache.mu.Unlock()
+
+	// 派生耗时较长，不持有锁，并发派生同一密钥时结果相同
+	encKey, macKey := derive(key, salt)
+	return storeKeys(k, encKey, macKey)
+}
+
+// CachedKeys 查询缓存中的派生密钥，只持有读锁且不调整淘汰顺序
+// 用于验证候选密钥，暴力扫描时大量 goroutine 并发验证不会相互等待
+func CachedKeys(name string, key []byte, salt []byte) ([]byte, []byte, bool) {
+	if len(key) != KeySize || len(salt) != SaltSize {
+		return nil, nil, false
+	}
+
+	k := keyCacheKey{name: name, key: [KeySize]byte(key), salt: [SaltSize]byte(salt)}
+
+	keyCache.mu.RLock()
+	defer keyCache.mu.RUnlock()
+	if elem, ok := keyCache.items[k]; ok {
+		entry := elem.Value.(*keyCacheEntry)
+		return entry.encKey, entry.macKey, true
+	}
+	return nil, nil, false
+}
+
+// CacheKeys 缓存已验证有效的密钥的派生结果
+// 验证失败的候选密钥不应缓存，否则暴力扫描会将有效密钥挤出缓存
+func CacheKeys(name string, key []byte, salt []byte, encKey []byte, macKey []byte) {
+	if len(key) != KeySize || len(salt) != SaltSize {
+		return
+	}
+	storeKeys(keyCacheKey{name: name, key: [KeySize]byte(key), salt: [SaltSize]byte(salt)}, encKey, macKey)
+}
+
+// storeKeys 将派生结果放入缓存，已存在时返回缓存中的结果
+func storeKeys(k keyCacheKey, encKey []byte, macKey []byte) ([]byte, []byte) {
+	entry := &keyCacheEntry{
+		cacheKey: k,
+		encKey:   append([]byte(nil), encKey...),
+		macKey:   append([]byte(nil), macKey...),
+	}
+
+	keyCache.mu.Lock()
+	defer keyCache.mu.Unlock()
+	if elem, ok := keyCache.items[k]; ok {
+		keyCache.lru.MoveToFront(elem)
+		entry = elem.Value.(*keyCacheEntry)
+		return entry.encKey, entry.macKey
+	}
+	keyCache.items[k] = keyCache.lru.PushFront(entry)
+	if keyCache.lru.Len() > MaxCachedKeys {
+		oldest := keyCache.lru.Back()
+		keyCache.lru.Remove(oldest)
+		delete(keyCache.items, oldest.Value.(*keyCacheEntry).cacheKey)
+	}
+	return entry.encKey, entry.macKey
+}
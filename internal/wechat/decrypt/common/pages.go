@@ -0,0 +1,145 @@
+package common
+
+import (
+	"context"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+const (
+	// ParallelPages 页数超过该值时并行处理页面
+	ParallelPages = 4096
+
+	// BatchPages 每批读取和处理的页数
+	BatchPages = 256
+)
+
+// PageFunc 处理单个页面并返回写入输出的数据，pageNum 从 0 开始
+type PageFunc func(page []byte, pageNum int64) ([]byte, error)
+
+// pageBatch 一批连续的页面，处理完成后关闭 done
+type pageBatch struct {
+	start int64
+	data  []byte
+	out   [][]byte
+	err   error
+	done  chan struct{}
+}
+
+// ProcessPages 从 input 当前位置逐页读取并交给 process 处理，按页面顺序将结果写入 output，全零页面原样写入
+// 解密、加密和校验共用该流程；页数超过 ParallelPages 时将页面分批交给多个 goroutine 并行处理，文件末尾不完整的页面会被忽略
+func ProcessPages(ctx context.Context, input *os.File, totalPages int64, pageSize int, output io.Writer, process PageFunc) error {
+	workers := runtime.NumCPU()
+	if totalPages <= ParallelPages {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *pageBatch)
+	queue := make(chan *pageBatch, workers*2)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for b := range jobs {
+				b.process(pageSize, process)
+				close(b.done)
+			}
+		}()
+	}
+
+	// 按顺序读取页面，同时放入写入队列和处理任务
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+		for start := int64(0); start < totalPages; start += BatchPages {
+			buf := make([]byte, min(BatchPages, totalPages-start)*int64(pageSize))
+			n, err := io.ReadFull(input, buf)
+			b := &pageBatch{
+				start: start,
+				data:  buf[:n/pageSize*pageSize],
+				done:  make(chan struct{}),
+			}
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				b.err = errors.ReadFileFailed(input.Name(), err)
+				close(b.done)
+				select {
+				case queue <- b:
+				case <-ctx.Done():
+				}
+				return
+			}
+			if len(b.data) == 0 {
+				return
+			}
+
+			select {
+			case queue <- b:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- b:
+			case <-ctx.Done():
+				return
+			}
+
+			if n < len(buf) {
+				return
+			}
+		}
+	}()
+
+	for b := range queue {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return errors.ErrDecryptOperationCanceled
+		}
+		if b.err != nil {
+			return b.err
+		}
+		for _, page := range b.out {
+			if _, err := output.Write(page); err != nil {
+				return errors.WriteOutputFailed(err)
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return errors.ErrDecryptOperationCanceled
+	}
+	return nil
+}
+
+func (b *pageBatch) process(pageSize int, process PageFunc) {
+	count := len(b.data) / pageSize
+	b.out = make([][]byte, count)
+	for i := 0; i < count; i++ {
+		page := b.data[i*pageSize : (i+1)*pageSize]
+		if IsZeroPage(page) {
+			b.out[i] = page
+			continue
+		}
+		out, err := process(page, b.start+int64(i))
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.out[i] = out
+	}
+}
+
+// IsZeroPage 判断页面是否全为零，全零页面为未使用的页面，无需处理
+func IsZeroPage(page []byte) bool {
+	for _, b := range page {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"context"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// VerifyResult 数据库文件逐页校验 HMAC 的结果
+type VerifyResult struct {
+	TotalPages   int64   // 文件的页数
+	CheckedPages int64   // 校验的页数，全零页面为未使用的页面，不参与校验
+	BadPages     []int64 // HMAC 校验失败的页号，与 SQLite 一致从 1 开始，升序排列
+}
+
+// AllBad 是否全部页面校验失败，通常意味着密钥或版本错误，而不是文件损坏
+func (r *VerifyResult) AllBad() bool {
+	return r.CheckedPages > 0 && int64(len(r.BadPages)) == r.CheckedPages
+}
+
+// VerifyPages 从 input 当前位置逐页校验 HMAC，记录校验失败的页面
+// output 为空时只校验不解密；否则写入 SQLite 头和解密后的页面，校验失败的页面以全零写入，不中断解密
+func VerifyPages(ctx context.Context, input *os.File, totalPages int64, pageSize int, output io.Writer, verify func(page []byte, pageNum int64) bool, decrypt PageFunc) (*VerifyResult, error) {
+	result := &VerifyResult{TotalPages: totalPages}
+	mu := sync.Mutex{}
+
+	salvage := output != nil
+	if !salvage {
+		output = io.Discard
+	} else if _, err := output.Write([]byte(SQLiteHeader)); err != nil {
+		return nil, errors.WriteOutputFailed(err)
+	}
+
+	// ProcessPages 不会将全零页面交给 PageFunc
+	err := ProcessPages(ctx, input, totalPages, pageSize, output, func(page []byte, pageNum int64) ([]byte, error) {
+		ok := verify(page, pageNum)
+		mu.Lock()
+		result.CheckedPages++
+		if !ok {
+			result.BadPages = append(result.BadPages, pageNum+1)
+		}
+		mu.Unlock()
+
+		switch {
+		case !salvage:
+			return nil, nil
+		case !ok && pageNum == 0:
+			return make([]byte, pageSize-SaltSize), nil
+		case !ok:
+			return make([]byte, pageSize), nil
+		}
+		return decrypt(page, pageNum)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(result.BadPages)
+	return result, nil
+}
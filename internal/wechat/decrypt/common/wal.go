@@ -0,0 +1,138 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+const (
+	WALHeaderSize      = 32
+	WALFrameHeaderSize = 24
+
+	// WAL 文件头中的魔数，最低位表示校验和使用大端序
+	walMagicLE = 0x377f0682
+	walMagicBE = 0x377f0683
+)
+
+// ReplayWAL 将 WAL 文件中已提交的事务逐页解密后写回已解密的数据库 output
+// WAL 文件头和帧头未加密，帧中的页面与数据库文件使用相同的密钥和页面布局
+// 只重放盐值和校验和有效且已提交的帧，遇到第一个无效帧时停止，WAL 文件不存在时直接返回
+// decrypt 的 pageNum 从 0 开始，第 1 页的解密结果不包含文件头，写入时补齐 SQLite 头
+// 返回重放的页面数量
+func ReplayWAL(ctx context.Context, walPath string, pageSize int, output *os.File, decrypt PageFunc) (int, error) {
+	f, err := os.Open(walPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.OpenFileFailed(walPath, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, WALFrameHeaderSize+pageSize)
+	header := make([]byte, WALHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		// 空的或不完整的 WAL 文件中没有可重放的帧
+		return 0, nil
+	}
+
+	var order binary.ByteOrder
+	switch binary.BigEndian.Uint32(header[0:4]) {
+	case walMagicLE:
+		order = binary.LittleEndian
+	case walMagicBE:
+		order = binary.BigEndian
+	default:
+		return 0, nil
+	}
+	if size := int(binary.BigEndian.Uint32(header[8:12])); size != pageSize {
+		return 0, errors.WALPageSizeMismatch(walPath, size, pageSize)
+	}
+	s1, s2 := walChecksum(order, header[:24], 0, 0)
+	if s1 != binary.BigEndian.Uint32(header[24:28]) || s2 != binary.BigEndian.Uint32(header[28:32]) {
+		return 0, nil
+	}
+	salt := header[16:24]
+
+	// 当前事务中尚未提交的页面，同一页面只保留最后一次写入
+	pending := make(map[uint32][]byte)
+	frames := 0
+	frame := make([]byte, WALFrameHeaderSize+pageSize)
+	for {
+		if ctx.Err() != nil {
+			return frames, errors.ErrDecryptOperationCanceled
+		}
+		if _, err := io.ReadFull(r, frame); err != nil {
+			break
+		}
+
+		pgno := binary.BigEndian.Uint32(frame[0:4])
+		commit := binary.BigEndian.Uint32(frame[4:8])
+		if pgno == 0 || string(frame[8:16]) != string(salt) {
+			break
+		}
+		s1, s2 = walChecksum(order, frame[:8], s1, s2)
+		s1, s2 = walChecksum(order, frame[WALFrameHeaderSize:], s1, s2)
+		if s1 != binary.BigEndian.Uint32(frame[16:20]) || s2 != binary.BigEndian.Uint32(frame[20:24]) {
+			break
+		}
+
+		pending[pgno] = append([]byte(nil), frame[WALFrameHeaderSize:]...)
+		if commit == 0 {
+			continue
+		}
+
+		if err := writeWALPages(output, pending, pageSize, decrypt); err != nil {
+			return frames, err
+		}
+		if err := output.Truncate(int64(commit) * int64(pageSize)); err != nil {
+			return frames, errors.WriteOutputFailed(err)
+		}
+		frames += len(pending)
+		pending = make(map[uint32][]byte)
+	}
+
+	return frames, nil
+}
+
+// writeWALPages 解密一个事务中的页面并按页号写入 output
+func writeWALPages(output *os.File, pages map[uint32][]byte, pageSize int, decrypt PageFunc) error {
+	pgnos := make([]uint32, 0, len(pages))
+	for pgno := range pages {
+		pgnos = append(pgnos, pgno)
+	}
+	sort.Slice(pgnos, func(i, j int) bool { return pgnos[i] < pgnos[j] })
+
+	for _, pgno := range pgnos {
+		page := pages[pgno]
+		if !IsZeroPage(page) {
+			out, err := decrypt(page, int64(pgno-1))
+			if err != nil {
+				return err
+			}
+			if pgno == 1 {
+				out = append([]byte(SQLiteHeader), out...)
+			}
+			page = out
+		}
+		if _, err := output.WriteAt(page, int64(pgno-1)*int64(pageSize)); err != nil {
+			return errors.WriteOutputFailed(err)
+		}
+	}
+	return nil
+}
+
+// walChecksum 计算 WAL 的累积校验和，data 长度需为 8 的倍数
+func walChecksum(order binary.ByteOrder, data []byte, s1, s2 uint32) (uint32, uint32) {
+	for i := 0; i+8 <= len(data); i += 8 {
+		s1 += order.Uint32(data[i:]) + s2
+		s2 += order.Uint32(data[i+4:]) + s1
+	}
+	return s1, s2
+}
@@ -0,0 +1,262 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testWALPageSize = 512
+
+var testWALSalt = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+// testFrame WAL 中的一帧，页面内容全部填充为 fill
+type testFrame struct {
+	pgno    uint32
+	commit  uint32 // 非零表示事务提交，值为提交后数据库的页数
+	fill    byte
+	badSum  bool   // 写入错误的校验和
+	salt    []byte // 为空时使用文件头中的盐值
+	partial bool   // 只写入一半，模拟写入中断的末尾帧
+}
+
+// buildWAL 按 SQLite 的 WAL 格式生成文件内容，magic 决定校验和的字节序
+func buildWAL(magic uint32, pageSize int, frames []testFrame) []byte {
+	order := binary.ByteOrder(binary.LittleEndian)
+	if magic == walMagicBE {
+		order = binary.BigEndian
+	}
+
+	header := make([]byte, WALHeaderSize)
+	binary.BigEndian.PutUint32(header[0:4], magic)
+	binary.BigEndian.PutUint32(header[4:8], 3007000)
+	binary.BigEndian.PutUint32(header[8:12], uint32(pageSize))
+	copy(header[16:24], testWALSalt)
+	s1, s2 := walChecksum(order, header[:24], 0, 0)
+	binary.BigEndian.PutUint32(header[24:28], s1)
+	binary.BigEndian.PutUint32(header[28:32], s2)
+
+	wal := header
+	for _, f := range frames {
+		frame := make([]byte, WALFrameHeaderSize+pageSize)
+		binary.BigEndian.PutUint32(frame[0:4], f.pgno)
+		binary.BigEndian.PutUint32(frame[4:8], f.commit)
+		salt := testWALSalt
+		if f.salt != nil {
+			salt = f.salt
+		}
+		copy(frame[8:16], salt)
+		for i := WALFrameHeaderSize; i < len(frame); i++ {
+			frame[i] = f.fill
+		}
+
+		s1, s2 = walChecksum(order, frame[:8], s1, s2)
+		s1, s2 = walChecksum(order, frame[WALFrameHeaderSize:], s1, s2)
+		binary.BigEndian.PutUint32(frame[16:20], s1)
+		binary.BigEndian.PutUint32(frame[20:24], s2)
+		if f.badSum {
+			frame[20] ^= 0xff
+		}
+		if f.partial {
+			frame = frame[:len(frame)/2]
+		}
+		wal = append(wal, frame...)
+	}
+	return wal
+}
+
+func TestReplayWAL(t *testing.T) {
+	tests := []struct {
+		name      string
+		magic     uint32
+		pageSize  int
+		frames    []testFrame
+		wantPages int
+		want      []byte // 重放后各页面的填充值
+		wantErr   bool
+	}{
+		{
+			name:  "committed then uncommitted transaction",
+			magic: walMagicLE,
+			frames: []testFrame{
+				{pgno: 2, fill: 'a'},
+				{pgno: 3, fill: 'b', commit: 4},
+				{pgno: 2, fill: 'x'},
+				{pgno: 4, fill: 'y'},
+			},
+			wantPages: 2,
+			want:      []byte{'o', 'a', 'b', 'o'},
+		},
+		{
+			name:  "committed, bad frame and uncommitted transactions",
+			magic: walMagicLE,
+			frames: []testFrame{
+				{pgno: 2, fill: 'a'},
+				{pgno: 3, fill: 'b', commit: 4},
+				{pgno: 4, fill: 'c', commit: 4, badSum: true},
+				{pgno: 2, fill: 'x'},
+			},
+			wantPages: 2,
+			want:      []byte{'o', 'a', 'b', 'o'},
+		},
+		{
+			name:  "big-endian checksum",
+			magic: walMagicBE,
+			frames: []testFrame{
+				{pgno: 3, fill: 'a', commit: 4},
+			},
+			wantPages: 1,
+			want:      []byte{'o', 'o', 'a', 'o'},
+		},
+		{
+			name:  "later page write in transaction wins",
+			magic: walMagicLE,
+			frames: []testFrame{
+				{pgno: 2, fill: 'a'},
+				{pgno: 2, fill: 'b', commit: 4},
+			},
+			wantPages: 1,
+			want:      []byte{'o', 'b', 'o', 'o'},
+		},
+		{
+			name:  "stop at bad checksum",
+			magic: walMagicLE,
+			frames: []testFrame{
+				{pgno: 2, fill: 'a', commit: 4},
+				{pgno: 3, fill: 'b', commit: 4, badSum: true},
+				{pgno: 4, fill: 'c', commit: 4},
+			},
+			wantPages: 1,
+			want:      []byte{'o', 'a', 'o', 'o'},
+		},
+		{
+			name:  "stop at salt mismatch",
+			magic: walMagicLE,
+			frames: []testFrame{
+				{pgno: 2, fill: 'a', commit: 4},
+				{pgno: 3, fill: 'b', commit: 4, salt: []byte{8, 7, 6, 5, 4, 3, 2, 1}},
+			},
+			wantPages: 1,
+			want:      []byte{'o', 'a', 'o', 'o'},
+		},
+		{
+			name:  "torn trailing frame",
+			magic: walMagicLE,
+			frames: []testFrame{
+				{pgno: 2, fill: 'a', commit: 4},
+				{pgno: 3, fill: 'b', commit: 4, partial: true},
+			},
+			wantPages: 1,
+			want:      []byte{'o', 'a', 'o', 'o'},
+		},
+		{
+			name:  "commit grows and truncates database",
+			magic: walMagicLE,
+			frames: []testFrame{
+				{pgno: 5, fill: 'a', commit: 5},
+				{pgno: 2, fill: 'b', commit: 2},
+			},
+			wantPages: 2,
+			want:      []byte{'o', 'b'},
+		},
+		{
+			name:  "first page keeps SQLite header",
+			magic: walMagicLE,
+			frames: []testFrame{
+				{pgno: 1, fill: 'a', commit: 4},
+			},
+			wantPages: 1,
+			want:      []byte{'a', 'o', 'o', 'o'},
+		},
+		{
+			name:      "bad magic",
+			magic:     0x12345678,
+			frames:    []testFrame{{pgno: 2, fill: 'a', commit: 4}},
+			wantPages: 0,
+			want:      []byte{'o', 'o', 'o', 'o'},
+		},
+		{
+			name:     "page size mismatch",
+			magic:    walMagicLE,
+			pageSize: 2 * testWALPageSize,
+			frames:   []testFrame{{pgno: 2, fill: 'a', commit: 4}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			walPageSize := tt.pageSize
+			if walPageSize == 0 {
+				walPageSize = testWALPageSize
+			}
+			walPath := filepath.Join(dir, "test.db-wal")
+			if err := os.WriteFile(walPath, buildWAL(tt.magic, walPageSize, tt.frames), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := os.Create(filepath.Join(dir, "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer output.Close()
+			if _, err := output.Write(bytes.Repeat([]byte{'o'}, 4*testWALPageSize)); err != nil {
+				t.Fatal(err)
+			}
+
+			// 未加密的页面原样写回，第 1 页去掉文件头，由 ReplayWAL 补齐 SQLite 头
+			pages, err := ReplayWAL(context.Background(), walPath, testWALPageSize, output, func(page []byte, pageNum int64) ([]byte, error) {
+				if pageNum == 0 {
+					return page[SaltSize:], nil
+				}
+				return page, nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReplayWAL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if pages != tt.wantPages {
+				t.Errorf("ReplayWAL() pages = %d, want %d", pages, tt.wantPages)
+			}
+
+			got, err := os.ReadFile(output.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want)*testWALPageSize {
+				t.Fatalf("output size = %d, want %d", len(got), len(tt.want)*testWALPageSize)
+			}
+			for i, fill := range tt.want {
+				page := got[i*testWALPageSize : (i+1)*testWALPageSize]
+				want := bytes.Repeat([]byte{fill}, testWALPageSize)
+				if i == 0 && fill != 'o' {
+					copy(want, SQLiteHeader)
+				}
+				if !bytes.Equal(page, want) {
+					t.Errorf("page %d = %q..., want fill %q", i+1, page[:20], fill)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayWALMissing(t *testing.T) {
+	output, err := os.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+
+	pages, err := ReplayWAL(context.Background(), output.Name()+"-wal", testWALPageSize, output, func(page []byte, pageNum int64) ([]byte, error) {
+		return page, nil
+	})
+	if err != nil || pages != 0 {
+		t.Fatalf("ReplayWAL() = %d, %v, want 0, nil", pages, err)
+	}
+}
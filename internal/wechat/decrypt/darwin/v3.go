@@ -3,12 +3,10 @@ package darwin
 import (
 	"context"
 	"crypto/sha1"
-	"encoding/hex"
 	"hash"
 	"io"
 	"os"
 
-	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
 
 	"golang.org/x/crypto/pbkdf2"
@@ -28,6 +26,8 @@ type V3Decryptor struct {
 	reserve  int
 	pageSize int
 	version  string
+
+	codec *common.Codec
 }
 
 // NewV3Decryptor 创建 macOS V3 解密器
@@ -39,18 +39,27 @@ func NewV3Decryptor() *V3Decryptor {
 		reserve = ((reserve / common.AESBlockSize) + 1) * common.AESBlockSize
 	}
 
-	return &V3Decryptor{
+	d := &V3Decryptor{
 		hmacSize: hmacSize,
 		hashFunc: hashFunc,
 		reserve:  reserve,
 		pageSize: V3PageSize,
 		version:  "macOS v3",
 	}
+	d.codec = &common.Codec{
+		Name:     d.version,
+		PageSize: d.pageSize,
+		Reserve:  d.reserve,
+		HMACSize: d.hmacSize,
+		HashFunc: d.hashFunc,
+		Derive:   d.derive,
+	}
+	return d
 }
 
-// deriveKeys 派生 MAC 密钥
+// derive 派生 MAC 密钥
 // 注意：macOS V3 版本直接使用提供的密钥作为加密密钥，不进行 PBKDF2 派生
-func (d *V3Decryptor) deriveKeys(key []byte, salt []byte) ([]byte, []byte) {
+func (d *V3Decryptor) derive(key []byte, salt []byte) ([]byte, []byte) {
 	// 对于 macOS V3，直接使用密钥作为加密密钥
 	encKey := key
 
@@ -63,105 +72,32 @@ func (d *V3Decryptor) deriveKeys(key []byte, salt []byte) ([]byte, []byte) {
 
 // Validate 验证密钥是否有效
 func (d *V3Decryptor) Validate(page1 []byte, key []byte) bool {
-	if len(page1) < d.pageSize || len(key) != common.KeySize {
-		return false
-	}
-
-	salt := page1[:common.SaltSize]
-	return common.ValidateKey(page1, key, salt, d.hashFunc, d.hmacSize, d.reserve, d.pageSize, d.deriveKeys)
+	return d.codec.Validate(page1, key)
 }
 
 // Decrypt 解密数据库
 func (d *V3Decryptor) Decrypt(ctx context.Context, dbfile string, hexKey string, output io.Writer) error {
-	// 解码密钥
-	key, err := hex.DecodeString(hexKey)
-	if err != nil {
-		return errors.DecodeKeyFailed(err)
-	}
-
-	// 打开数据库文件并读取基本信息
-	dbInfo, err := common.OpenDBFile(dbfile, d.pageSize)
-	if err != nil {
-		return err
-	}
-
-	// 验证密钥
-	if !d.Validate(dbInfo.FirstPage, key) {
-		return errors.ErrDecryptIncorrectKey
-	}
-
-	// 计算密钥
-	encKey, macKey := d.deriveKeys(key, dbInfo.Salt)
+	return d.codec.Decrypt(ctx, dbfile, hexKey, output)
+}
 
-	// 打开数据库文件
-	dbFile, err := os.Open(dbfile)
-	if err != nil {
-		return errors.OpenFileFailed(dbfile, err)
-	}
-	defer dbFile.Close()
+// DecryptWAL 解密 WAL 文件中已提交的页面并写回已解密的数据库，返回重放的页面数量
+func (d *V3Decryptor) DecryptWAL(ctx context.Context, dbfile string, hexKey string, output *os.File) (int, error) {
+	return d.codec.DecryptWAL(ctx, dbfile, hexKey, output)
+}
 
-	// 写入 SQLite 头
-	_, err = output.Write([]byte(common.SQLiteHeader))
-	if err != nil {
-		return errors.WriteOutputFailed(err)
-	}
+// DecryptChanged 增量解密数据库，只解密 HMAC 与上次不同的页面并写入 output 的对应位置
+func (d *V3Decryptor) DecryptChanged(ctx context.Context, dbfile string, hexKey string, output *os.File, prev *common.PageState) (*common.PageState, int, error) {
+	return d.codec.DecryptChanged(ctx, dbfile, hexKey, output, prev)
+}
 
-	// 处理每一页
-	pageBuf := make([]byte, d.pageSize)
-
-	for curPage := int64(0); curPage < dbInfo.TotalPages; curPage++ {
-		// 检查是否取消
-		select {
-		case <-ctx.Done():
-			return errors.ErrDecryptOperationCanceled
-		default:
-			// 继续处理
-		}
-
-		// 读取一页
-		n, err := io.ReadFull(dbFile, pageBuf)
-		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				// 处理最后一部分页面
-				if n > 0 {
-					break
-				}
-			}
-			return errors.ReadFileFailed(dbfile, err)
-		}
-
-		// 检查页面是否全为零
-		allZeros := true
-		for _, b := range pageBuf {
-			if b != 0 {
-				allZeros = false
-				break
-			}
-		}
-
-		if allZeros {
-			// 写入零页面
-			_, err = output.Write(pageBuf)
-			if err != nil {
-				return errors.WriteOutputFailed(err)
-			}
-			continue
-		}
-
-		// 解密页面
-		decryptedData, err := common.DecryptPage(pageBuf, encKey, macKey, curPage, d.hashFunc, d.hmacSize, d.reserve, d.pageSize)
-		if err != nil {
-			return err
-		}
-
-		// 写入解密后的页面
-		_, err = output.Write(decryptedData)
-		if err != nil {
-			return errors.WriteOutputFailed(err)
-		}
-	}
+// Encrypt 使用原始密钥和盐值将明文数据库重新加密，是 Decrypt 的逆操作
+func (d *V3Decryptor) Encrypt(ctx context.Context, dbfile string, hexKey string, salt []byte, output io.Writer) error {
+	return d.codec.Encrypt(ctx, dbfile, hexKey, salt, output)
+}
 
-	return nil
+// Verify 逐页校验数据库的 HMAC，output 不为空时同时解密，校验失败的页面以全零写入
+func (d *V3Decryptor) Verify(ctx context.Context, dbfile string, hexKey string, output io.Writer) (*common.VerifyResult, error) {
+	return d.codec.Verify(ctx, dbfile, hexKey, output)
 }
 
 // GetPageSize 返回页面大小
@@ -3,8 +3,10 @@ package decrypt
 import (
 	"context"
 	"io"
+	"os"
 
 	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt/darwin"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt/windows"
 )
@@ -14,6 +16,18 @@ type Decryptor interface {
 	// Decrypt 解密数据库
 	Decrypt(ctx context.Context, dbfile string, key string, output io.Writer) error
 
+	// DecryptWAL 将数据库 WAL 文件中已提交的页面解密后写回已解密的数据库，返回重放的页面数量
+	DecryptWAL(ctx context.Context, dbfile string, key string, output *os.File) (int, error)
+
+	// DecryptChanged 增量解密数据库，只解密 HMAC 与上次不同的页面并原地写入 output，prev 为空时解密全部页面
+	DecryptChanged(ctx context.Context, dbfile string, key string, output *os.File, prev *common.PageState) (*common.PageState, int, error)
+
+	// Encrypt 使用原始密钥和盐值将明文数据库重新加密为微信可读取的数据库
+	Encrypt(ctx context.Context, dbfile string, key string, salt []byte, output io.Writer) error
+
+	// Verify 逐页校验数据库的 HMAC，output 不为空时同时解密，校验失败的页面以全零写入
+	Verify(ctx context.Context, dbfile string, key string, output io.Writer) (*common.VerifyResult, error)
+
 	// Validate 验证密钥是否有效
 	Validate(page1 []byte, key []byte) bool
 
@@ -0,0 +1,112 @@
+package decrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := make([]byte, common.KeySize)
+	salt := make([]byte, common.SaltSize)
+	rand.Read(key)
+	rand.Read(salt)
+	hexKey := hex.EncodeToString(key)
+
+	tests := []struct {
+		platform string
+		version  int
+	}{
+		{"windows", 3},
+		{"windows", 4},
+		{"darwin", 3},
+		{"darwin", 4},
+	}
+
+	for _, tt := range tests {
+		d, err := NewDecryptor(tt.platform, tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(d.GetVersion(), func(t *testing.T) {
+			pageSize, reserve := d.GetPageSize(), d.GetReserve()
+			dir := t.TempDir()
+
+			// 构造页面布局与目标版本一致的明文数据库，第三页为全零页面
+			plain := make([]byte, 5*pageSize)
+			rand.Read(plain)
+			copy(plain, common.SQLiteHeader)
+			binary.BigEndian.PutUint16(plain[16:18], uint16(pageSize))
+			plain[20] = byte(reserve)
+			clear(plain[2*pageSize : 3*pageSize])
+			plainPath := filepath.Join(dir, "plain.db")
+			if err := os.WriteFile(plainPath, plain, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var encrypted bytes.Buffer
+			if err := d.Encrypt(context.Background(), plainPath, hexKey, salt, &encrypted); err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if encrypted.Len() != len(plain) {
+				t.Fatalf("encrypted size = %d, want %d", encrypted.Len(), len(plain))
+			}
+			if !bytes.Equal(encrypted.Bytes()[:common.SaltSize], salt) {
+				t.Fatalf("encrypted salt = %x, want %x", encrypted.Bytes()[:common.SaltSize], salt)
+			}
+			if !d.Validate(encrypted.Bytes()[:pageSize], key) {
+				t.Fatal("Validate() = false on encrypted database")
+			}
+			encryptedPath := filepath.Join(dir, "encrypted.db")
+			if err := os.WriteFile(encryptedPath, encrypted.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var decrypted bytes.Buffer
+			if err := d.Decrypt(context.Background(), encryptedPath, hexKey, &decrypted); err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if decrypted.Len() != len(plain) {
+				t.Fatalf("decrypted size = %d, want %d", decrypted.Len(), len(plain))
+			}
+
+			// 保留区域存放的是 IV 和 HMAC，只比较页面的数据区域
+			for i := 0; i < len(plain); i += pageSize {
+				got := decrypted.Bytes()[i : i+pageSize-reserve]
+				want := plain[i : i+pageSize-reserve]
+				if !bytes.Equal(got, want) {
+					t.Errorf("page %d differs after round trip", i/pageSize)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptLayoutMismatch(t *testing.T) {
+	d, err := NewDecryptor("windows", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 页面大小正确但保留字节数为 0 的普通 SQLite 数据库
+	plain := make([]byte, 2*d.GetPageSize())
+	copy(plain, common.SQLiteHeader)
+	binary.BigEndian.PutUint16(plain[16:18], uint16(d.GetPageSize()))
+	plainPath := filepath.Join(t.TempDir(), "plain.db")
+	if err := os.WriteFile(plainPath, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := hex.EncodeToString(make([]byte, common.KeySize))
+	err = d.Encrypt(context.Background(), plainPath, key, make([]byte, common.SaltSize), &bytes.Buffer{})
+	if err == nil {
+		t.Fatal("Encrypt() error = nil, want page layout mismatch")
+	}
+}
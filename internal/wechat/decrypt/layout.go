@@ -0,0 +1,145 @@
+package decrypt
+
+import (
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// PlatformAuto 根据数据目录自动识别平台和版本
+const PlatformAuto = "auto"
+
+// layout 各平台、版本数据目录中的标志数据库文件
+// 标志文件同时用于识别数据目录和验证密钥，解密后的工作目录保持相同的目录结构
+type layout struct {
+	platform string
+	version  int
+	dbFile   string
+}
+
+var layouts = []layout{
+	{"windows", 4, "db_storage/message/message_0.db"},
+	{"darwin", 4, "db_storage/message/message_0.db"},
+	{"windows", 3, "Msg/Misc.db"},
+	{"darwin", 3, "Message/msg_0.db"},
+}
+
+// Detect 识别数据目录所属的平台和版本
+// 先根据目录结构筛选候选，再用密钥验证候选的标志数据库；目录结构无法识别时，使用目录中找到的第一个数据库逐个验证各版本的解密器
+// key 为空或数据库已解密时只根据目录结构识别
+func Detect(dir string, hexKey string) (string, int, error) {
+	if hexKey == "" {
+		return DetectDataDir(dir)
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return "", 0, errors.DecodeKeyFailed(err)
+	}
+
+	candidates := sortLayouts(matchLayouts(dir))
+	if len(candidates) > 0 {
+		for _, l := range candidates {
+			validator, err := NewValidator(l.platform, l.version, dir)
+			if err == errors.ErrAlreadyDecrypted {
+				return DetectDataDir(dir)
+			}
+			if err == nil && validator.Validate(key) {
+				return l.platform, l.version, nil
+			}
+		}
+		return "", 0, errors.ErrDecryptIncorrectKey
+	}
+
+	dbFile := findDBFile(dir)
+	if dbFile == "" {
+		return "", 0, errors.DataDirUnrecognized(dir)
+	}
+	if platform, version, err := detectFile(dbFile, key); err == nil {
+		return platform, version, nil
+	}
+	return "", 0, errors.DataDirUnrecognized(dir)
+}
+
+// DetectFile 使用密钥逐个验证各版本的解密器，识别加密数据库文件所属的平台和版本
+func DetectFile(dbFile string, hexKey string) (string, int, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return "", 0, errors.DecodeKeyFailed(err)
+	}
+	return detectFile(dbFile, key)
+}
+
+func detectFile(dbFile string, key []byte) (string, int, error) {
+	for _, l := range sortLayouts(layouts) {
+		validator, err := NewValidatorWithFile(l.platform, l.version, dbFile)
+		if err == errors.ErrAlreadyDecrypted {
+			return "", 0, err
+		}
+		if err != nil {
+			// 页面大小不同的版本可能读取失败，继续尝试其他版本
+			continue
+		}
+		if validator.Validate(key) {
+			return l.platform, l.version, nil
+		}
+	}
+	return "", 0, errors.ErrDecryptIncorrectKey
+}
+
+// DetectDataDir 根据目录结构识别数据目录所属的平台和版本，无需运行中的微信进程
+// 4.0 版本各平台的目录结构和数据库格式相同，优先返回当前平台，其余平台返回 windows
+func DetectDataDir(dir string) (string, int, error) {
+	matched := sortLayouts(matchLayouts(dir))
+	if len(matched) == 0 {
+		return "", 0, errors.DataDirUnrecognized(dir)
+	}
+	return matched[0].platform, matched[0].version, nil
+}
+
+// matchLayouts 返回标志数据库存在的目录结构
+func matchLayouts(dir string) []layout {
+	var matched []layout
+	for _, l := range layouts {
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(l.dbFile))); err == nil && !info.IsDir() {
+			matched = append(matched, l)
+		}
+	}
+	return matched
+}
+
+// sortLayouts 将当前平台的目录结构排在同版本的其他平台之前
+func sortLayouts(list []layout) []layout {
+	sorted := make([]layout, 0, len(list))
+	for _, l := range list {
+		if l.platform == runtime.GOOS {
+			sorted = append(sorted, l)
+		}
+	}
+	for _, l := range list {
+		if l.platform != runtime.GOOS {
+			sorted = append(sorted, l)
+		}
+	}
+	return sorted
+}
+
+// findDBFile 返回目录中找到的第一个数据库文件，跳过全文索引数据库
+func findDBFile(dir string) string {
+	found := ""
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".db") || strings.Contains(d.Name(), "fts") {
+			return nil
+		}
+		found = path
+		return fs.SkipAll
+	})
+	return found
+}
@@ -17,7 +17,7 @@ type Validator struct {
 // NewValidator 创建一个仅用于验证的验证器
 func NewValidator(platform string, version int, dataDir string) (*Validator, error) {
 	dbFile := GetSimpleDBFile(platform, version)
-	dbPath := filepath.Join(dataDir + "/" + dbFile)
+	dbPath := filepath.Join(dataDir, dbFile)
 	return NewValidatorWithFile(platform, version, dbPath)
 }
 
@@ -44,17 +44,22 @@ func (v *Validator) Validate(key []byte) bool {
 	return v.decryptor.Validate(v.dbFile.FirstPage, key)
 }
 
+// GetPlatform 返回验证器对应的平台
+func (v *Validator) GetPlatform() string {
+	return v.platform
+}
+
+// GetVersion 返回验证器对应的版本
+func (v *Validator) GetVersion() int {
+	return v.version
+}
+
+// GetSimpleDBFile 返回用于验证密钥的数据库文件相对数据目录的路径
 func GetSimpleDBFile(platform string, version int) string {
-	switch {
-	case platform == "windows" && version == 3:
-		return "Msg\\Misc.db"
-	case platform == "windows" && version == 4:
-		return "db_storage\\message\\message_0.db"
-	case platform == "darwin" && version == 3:
-		return "Message/msg_0.db"
-	case platform == "darwin" && version == 4:
-		return "db_storage/message/message_0.db"
+	for _, l := range layouts {
+		if l.platform == platform && l.version == version {
+			return filepath.FromSlash(l.dbFile)
+		}
 	}
 	return ""
-
 }
@@ -0,0 +1,167 @@
+package darwin
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+const (
+	MaxWorkers        = 8
+	MinChunkSize      = 1 * 1024 * 1024 // 1MB
+	ChunkOverlapBytes = 1024            // Greater than all offsets
+	ChunkMultiplier   = 2               // Number of chunks = MaxWorkers * ChunkMultiplier
+)
+
+// SearchFunc searches a memory chunk for a valid key
+type SearchFunc func(ctx context.Context, memory []byte) (string, bool)
+
+// SearchMemory splits memory into overlapping chunks and searches them with parallel workers.
+// It is used for both live process memory and offline memory dumps.
+func SearchMemory(ctx context.Context, memory []byte, search SearchFunc) (string, error) {
+	// Create context to control all goroutines
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Create channels for memory data and results
+	memoryChannel := make(chan []byte, 100)
+	resultChannel := make(chan string, 1)
+
+	// Determine number of worker goroutines
+	workerCount := runtime.NumCPU()
+	if workerCount < 2 {
+		workerCount = 2
+	}
+	if workerCount > MaxWorkers {
+		workerCount = MaxWorkers
+	}
+	log.Debug().Msgf("Starting %d workers for key search", workerCount)
+
+	// Start consumer goroutines
+	var workerWaitGroup sync.WaitGroup
+	workerWaitGroup.Add(workerCount)
+	for index := 0; index < workerCount; index++ {
+		go func() {
+			defer workerWaitGroup.Done()
+			worker(searchCtx, search, memoryChannel, resultChannel)
+		}()
+	}
+
+	// Start producer goroutine
+	var producerWaitGroup sync.WaitGroup
+	producerWaitGroup.Add(1)
+	go func() {
+		defer producerWaitGroup.Done()
+		defer close(memoryChannel) // Close channel when producer is done
+		sendChunks(searchCtx, memory, memoryChannel)
+	}()
+
+	// Wait for producer and consumers to complete
+	go func() {
+		producerWaitGroup.Wait()
+		workerWaitGroup.Wait()
+		close(resultChannel)
+	}()
+
+	// Wait for result
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case result, ok := <-resultChannel:
+		if ok && result != "" {
+			return result, nil
+		}
+	}
+
+	return "", errors.ErrNoValidKey
+}
+
+// sendChunks splits memory into chunks and sends them from end to beginning
+func sendChunks(ctx context.Context, memory []byte, memoryChannel chan<- []byte) {
+	totalSize := len(memory)
+	log.Debug().Msgf("Read memory region, size: %d bytes", totalSize)
+
+	// If memory is small enough, process it as a single chunk
+	if totalSize <= MinChunkSize {
+		select {
+		case memoryChannel <- memory:
+			log.Debug().Msg("Memory sent as a single chunk for analysis")
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	chunkCount := MaxWorkers * ChunkMultiplier
+
+	// Calculate chunk size based on fixed chunk count
+	chunkSize := totalSize / chunkCount
+	if chunkSize < MinChunkSize {
+		// Reduce number of chunks if each would be too small
+		chunkCount = totalSize / MinChunkSize
+		if chunkCount == 0 {
+			chunkCount = 1
+		}
+		chunkSize = totalSize / chunkCount
+	}
+
+	// Process memory in chunks from end to beginning
+	for i := chunkCount - 1; i >= 0; i-- {
+		// Calculate start and end positions for this chunk
+		start := i * chunkSize
+		end := (i + 1) * chunkSize
+
+		// Ensure the last chunk includes all remaining memory
+		if i == chunkCount-1 {
+			end = totalSize
+		}
+
+		// Add overlap area to catch patterns at chunk boundaries
+		if i > 0 {
+			start -= ChunkOverlapBytes
+			if start < 0 {
+				start = 0
+			}
+		}
+
+		chunk := memory[start:end]
+
+		log.Debug().
+			Int("chunk_index", i+1).
+			Int("total_chunks", chunkCount).
+			Int("chunk_size", len(chunk)).
+			Int("start_offset", start).
+			Int("end_offset", end).
+			Msg("Processing memory chunk")
+
+		select {
+		case memoryChannel <- chunk:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// worker processes memory chunks until a key is found or the channel is closed
+func worker(ctx context.Context, search SearchFunc, memoryChannel <-chan []byte, resultChannel chan<- string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case memory, ok := <-memoryChannel:
+			if !ok {
+				return
+			}
+
+			if key, ok := search(ctx, memory); ok {
+				select {
+				case resultChannel <- key:
+				default:
+				}
+			}
+		}
+	}
+}
@@ -4,24 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
-	"runtime"
-	"sync"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt"
 	"github.com/sjzar/chatlog/internal/wechat/key/darwin/glance"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
 	"github.com/sjzar/chatlog/internal/wechat/model"
 )
 
-const (
-	MaxWorkers        = 8
-	MinChunkSize      = 1 * 1024 * 1024 // 1MB
-	ChunkOverlapBytes = 1024            // Greater than all offsets
-	ChunkMultiplier   = 2               // Number of chunks = MaxWorkers * ChunkMultiplier
-)
-
 var V4KeyPatterns = []KeyPatternInfo{
 	{
 		Pattern: []byte{0x20, 0x66, 0x74, 0x73, 0x35, 0x28, 0x25, 0x00},
@@ -31,6 +23,7 @@ var V4KeyPatterns = []KeyPatternInfo{
 
 type V4Extractor struct {
 	validator   *decrypt.Validator
+	scanner     *scan.Scanner
 	keyPatterns []KeyPatternInfo
 }
 
@@ -54,167 +47,25 @@ func (e *V4Extractor) Extract(ctx context.Context, proc *model.Process) (string,
 		return "", errors.ErrValidatorNotSet
 	}
 
-	// Create context to control all goroutines
-	searchCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	// Create channels for memory data and results
-	memoryChannel := make(chan []byte, 100)
-	resultChannel := make(chan string, 1)
-
-	// Determine number of worker goroutines
-	workerCount := runtime.NumCPU()
-	if workerCount < 2 {
-		workerCount = 2
-	}
-	if workerCount > MaxWorkers {
-		workerCount = MaxWorkers
-	}
-	log.Debug().Msgf("Starting %d workers for V4 key search", workerCount)
-
-	// Start consumer goroutines
-	var workerWaitGroup sync.WaitGroup
-	workerWaitGroup.Add(workerCount)
-	for index := 0; index < workerCount; index++ {
-		go func() {
-			defer workerWaitGroup.Done()
-			e.worker(searchCtx, memoryChannel, resultChannel)
-		}()
-	}
-
-	// Start producer goroutine
-	var producerWaitGroup sync.WaitGroup
-	producerWaitGroup.Add(1)
-	go func() {
-		defer producerWaitGroup.Done()
-		defer close(memoryChannel) // Close channel when producer is done
-		err := e.findMemory(searchCtx, uint32(proc.PID), memoryChannel)
-		if err != nil {
-			log.Err(err).Msg("Failed to read memory")
-		}
-	}()
-
-	// Wait for producer and consumers to complete
-	go func() {
-		producerWaitGroup.Wait()
-		workerWaitGroup.Wait()
-		close(resultChannel)
-	}()
-
-	// Wait for result
-	select {
-	case <-ctx.Done():
-		return "", ctx.Err()
-	case result, ok := <-resultChannel:
-		if ok && result != "" {
-			return result, nil
-		}
-	}
-
-	return "", errors.ErrNoValidKey
-}
-
-// findMemory searches for memory regions using Glance
-func (e *V4Extractor) findMemory(ctx context.Context, pid uint32, memoryChannel chan<- []byte) error {
-	// Initialize a Glance instance to read process memory
-	g := glance.NewGlance(pid)
-
 	// Read memory data
-	memory, err := g.Read()
+	memory, err := glance.NewGlance(uint32(proc.PID)).Read()
 	if err != nil {
-		return err
+		log.Err(err).Msg("Failed to read memory")
+		return "", err
 	}
 
-	totalSize := len(memory)
-	log.Debug().Msgf("Read memory region, size: %d bytes", totalSize)
-
-	// If memory is small enough, process it as a single chunk
-	if totalSize <= MinChunkSize {
-		select {
-		case memoryChannel <- memory:
-			log.Debug().Msg("Memory sent as a single chunk for analysis")
-		case <-ctx.Done():
-			return ctx.Err()
+	key, err := SearchMemory(ctx, memory, e.SearchKey)
+	if err == errors.ErrNoValidKey && e.scanner != nil {
+		// Fall back to brute-force scan when key patterns are not found
+		log.Info().Msg("Key patterns not found, falling back to brute-force scan")
+		if key, ok := e.scanner.Scan(ctx, memory); ok {
+			return key, nil
 		}
-		return nil
-	}
-
-	chunkCount := MaxWorkers * ChunkMultiplier
-
-	// Calculate chunk size based on fixed chunk count
-	chunkSize := totalSize / chunkCount
-	if chunkSize < MinChunkSize {
-		// Reduce number of chunks if each would be too small
-		chunkCount = totalSize / MinChunkSize
-		if chunkCount == 0 {
-			chunkCount = 1
-		}
-		chunkSize = totalSize / chunkCount
-	}
-
-	// Process memory in chunks from end to beginning
-	for i := chunkCount - 1; i >= 0; i-- {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			// Calculate start and end positions for this chunk
-			start := i * chunkSize
-			end := (i + 1) * chunkSize
-
-			// Ensure the last chunk includes all remaining memory
-			if i == chunkCount-1 {
-				end = totalSize
-			}
-
-			// Add overlap area to catch patterns at chunk boundaries
-			if i > 0 {
-				start -= ChunkOverlapBytes
-				if start < 0 {
-					start = 0
-				}
-			}
-
-			chunk := memory[start:end]
-
-			log.Debug().
-				Int("chunk_index", i+1).
-				Int("total_chunks", chunkCount).
-				Int("chunk_size", len(chunk)).
-				Int("start_offset", start).
-				Int("end_offset", end).
-				Msg("Processing memory chunk")
-
-			select {
-			case memoryChannel <- chunk:
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-	}
-
-	return nil
-}
-
-// worker processes memory regions to find V4 version key
-func (e *V4Extractor) worker(ctx context.Context, memoryChannel <-chan []byte, resultChannel chan<- string) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case memory, ok := <-memoryChannel:
-			if !ok {
-				return
-			}
-
-			if key, ok := e.SearchKey(ctx, memory); ok {
-				select {
-				case resultChannel <- key:
-				default:
-				}
-			}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
 		}
 	}
+	return key, err
 }
 
 func (e *V4Extractor) SearchKey(ctx context.Context, memory []byte) (string, bool) {
@@ -275,6 +126,10 @@ func (e *V4Extractor) SetValidate(validator *decrypt.Validator) {
 	e.validator = validator
 }
 
+func (e *V4Extractor) SetScanner(scanner *scan.Scanner) {
+	e.scanner = scanner
+}
+
 type KeyPatternInfo struct {
 	Pattern []byte
 	Offsets []int
@@ -0,0 +1,225 @@
+package key
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/key/darwin"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
+)
+
+const (
+	// DumpRegionSize 读取内存转储时每次读取的大小，多 GB 的内存转储按区域依次搜索，不整体读入内存
+	DumpRegionSize = 64 * 1024 * 1024
+
+	// DumpRegionOverlap 相邻区域重叠的字节数，大于特征串与密钥的最大距离，跨越区域边界的密钥不会遗漏
+	DumpRegionOverlap = darwin.ChunkOverlapBytes
+)
+
+// Dump 离线保存的进程内存转储
+// 可以是 dumpmemory 生成的 .bin 文件，或打包了 .bin 文件和 session 数据库的 .zip 文件
+type Dump struct {
+	path       string
+	size       int64
+	regionSize int // 每次读取的大小，默认为 DumpRegionSize
+
+	// open 打开内存数据，每次搜索都从头读取
+	open func() (io.ReadCloser, error)
+
+	zr        *zip.ReadCloser
+	sessionDB *DumpDB
+}
+
+// DumpDB 内存转储 zip 文件中一并打包的数据库文件
+type DumpDB struct {
+	Name    string
+	Version int // 从文件名中解析的微信主版本号，无法解析时为 0
+
+	file *zip.File
+}
+
+// OpenDump 打开内存转储文件，zip 文件中读取第一个 .bin 文件和 session 数据库
+// dumpmemory 生成的文件名格式为 wechat_<完整版本号>_<PID>_...，从中解析主版本号
+func OpenDump(path string) (*Dump, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.StatFileFailed(path, err)
+		}
+		return &Dump{
+			path:       path,
+			size:       info.Size(),
+			regionSize: DumpRegionSize,
+			open:       func() (io.ReadCloser, error) { return os.Open(path) },
+		}, nil
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, errors.OpenFileFailed(path, err)
+	}
+
+	d := &Dump{path: path, regionSize: DumpRegionSize, zr: zr}
+	for _, f := range zr.File {
+		switch {
+		case strings.HasSuffix(f.Name, ".bin") && d.open == nil:
+			d.size = int64(f.UncompressedSize64)
+			d.open = f.Open
+		case strings.HasSuffix(f.Name, "_session.db"):
+			d.sessionDB = &DumpDB{Name: filepath.Base(f.Name), file: f}
+			if parts := strings.SplitN(d.sessionDB.Name, "_", 3); len(parts) == 3 {
+				d.sessionDB.Version, _ = strconv.Atoi(strings.SplitN(parts[1], ".", 2)[0])
+			}
+		}
+	}
+	if d.open == nil {
+		zr.Close()
+		return nil, errors.DumpMemoryNotFound(path)
+	}
+	return d, nil
+}
+
+// Size 内存数据的大小
+func (d *Dump) Size() int64 {
+	return d.size
+}
+
+// SessionDB zip 文件中一并打包的 session 数据库，没有时返回 nil
+func (d *Dump) SessionDB() *DumpDB {
+	return d.sessionDB
+}
+
+func (d *Dump) Close() error {
+	if d.zr != nil {
+		return d.zr.Close()
+	}
+	return nil
+}
+
+// regions 依次读取内存数据中的各个区域并调用 fn，fn 返回 false 时停止
+// 相邻区域重叠 DumpRegionOverlap 字节，区域的缓冲区会被复用，fn 不能保留 region
+func (d *Dump) regions(ctx context.Context, fn func(region []byte) bool) error {
+	r, err := d.open()
+	if err != nil {
+		return errors.OpenFileFailed(d.path, err)
+	}
+	defer r.Close()
+
+	buf := make([]byte, min(int64(d.regionSize), max(d.size, DumpRegionOverlap+1)))
+	filled := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := io.ReadFull(r, buf[filled:])
+		filled += n
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return errors.ReadFileFailed(d.path, err)
+		}
+		if n > 0 && !fn(buf[:filled]) {
+			return nil
+		}
+		if eof {
+			return nil
+		}
+
+		// 保留区域末尾的重叠部分，与下一个区域一起搜索
+		filled = copy(buf, buf[filled-DumpRegionOverlap:filled])
+	}
+}
+
+// Extract 将数据库文件写入临时文件，用于验证密钥，返回临时文件路径和清理函数
+func (db *DumpDB) Extract() (string, func(), error) {
+	r, err := db.file.Open()
+	if err != nil {
+		return "", nil, errors.OpenFileFailed(db.Name, err)
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp("", "chatlog_*_"+db.Name)
+	if err != nil {
+		return "", nil, errors.OpenFileFailed(db.Name, err)
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	_, err = io.Copy(f, r)
+	f.Close()
+	if err != nil {
+		cleanup()
+		return "", nil, errors.WriteOutputFailed(err)
+	}
+	return f.Name(), cleanup, nil
+}
+
+// SearchDump 在离线保存的进程内存转储中搜索密钥，候选密钥由 validator 验证
+// 按 validator 对应的平台和版本选择特征串，特征串未找到有效密钥且 scanner 不为空时暴力扫描
+// macOS 的密钥紧邻特征串，可在内存转储中分块并行搜索；Windows 的特征串处保存的是指向密钥的指针，
+// 需要读取原进程的内存，内存转储中只能暴力扫描，scanner 为空时返回错误
+// 内存转储按区域依次读取和搜索，与读取进程内存时逐个内存区域搜索的方式一致
+func SearchDump(ctx context.Context, dump *Dump, validator *decrypt.Validator, scanner *scan.Scanner) (string, error) {
+	if validator == nil {
+		return "", errors.ErrValidatorNotSet
+	}
+
+	platform, version := validator.GetPlatform(), validator.GetVersion()
+	var extractor Extractor
+	switch {
+	case platform == "darwin" && version == 3:
+		extractor = darwin.NewV3Extractor()
+	case platform == "darwin" && version == 4:
+		extractor = darwin.NewV4Extractor()
+	case platform == "windows" && (version == 3 || version == 4):
+		if scanner == nil {
+			return "", errors.DumpPlatformUnsupported(platform, version)
+		}
+	default:
+		return "", errors.PlatformUnsupported(platform, version)
+	}
+
+	var key string
+	var searchErr error = errors.ErrNoValidKey
+	if extractor != nil {
+		extractor.SetValidate(validator)
+		err := dump.regions(ctx, func(region []byte) bool {
+			key, searchErr = darwin.SearchMemory(ctx, region, extractor.SearchKey)
+			return searchErr == errors.ErrNoValidKey
+		})
+		if err != nil {
+			return "", err
+		}
+		if searchErr == nil {
+			return key, nil
+		}
+		if searchErr != errors.ErrNoValidKey {
+			return "", searchErr
+		}
+	}
+
+	if scanner != nil {
+		log.Info().Msg("Key patterns not found, falling back to brute-force scan")
+		found := false
+		err := dump.regions(ctx, func(region []byte) bool {
+			key, found = scanner.Scan(ctx, region)
+			return !found && ctx.Err() == nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return key, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+	return "", errors.ErrNoValidKey
+}
@@ -0,0 +1,268 @@
+package key
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/internal/wechat/key/darwin"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
+)
+
+// newTestValidator 使用 key 加密一个只有文件头的数据库，返回验证该数据库的验证器
+func newTestValidator(t *testing.T, platform string, version int, key []byte) *decrypt.Validator {
+	t.Helper()
+	d, err := decrypt.NewDecryptor(platform, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	plain := make([]byte, 2*d.GetPageSize())
+	copy(plain, common.SQLiteHeader)
+	binary.BigEndian.PutUint16(plain[16:18], uint16(d.GetPageSize()))
+	plain[20] = byte(d.GetReserve())
+	plainPath := filepath.Join(dir, "plain.db")
+	if err := os.WriteFile(plainPath, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	salt := make([]byte, common.SaltSize)
+	rand.Read(salt)
+	var encrypted bytes.Buffer
+	if err := d.Encrypt(context.Background(), plainPath, hex.EncodeToString(key), salt, &encrypted); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(dir, "session.db")
+	if err := os.WriteFile(dbPath, encrypted.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	validator, err := decrypt.NewValidatorWithFile(platform, version, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return validator
+}
+
+// plantKey 在随机内存中写入特征串，并在特征串之后 offset 处写入密钥
+func plantKey(memory []byte, at int, pattern darwin.KeyPatternInfo, offset int, key []byte) {
+	copy(memory[at:], pattern.Pattern)
+	copy(memory[at+offset:], key)
+}
+
+// writeDump 将内存数据写入 .bin 文件并打开
+func writeDump(t *testing.T, memory []byte) *Dump {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wechat.bin")
+	if err := os.WriteFile(path, memory, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dump, err := OpenDump(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dump.Close() })
+	return dump
+}
+
+func TestSearchDump(t *testing.T) {
+	key := make([]byte, common.KeySize)
+	rand.Read(key)
+	wantKey := hex.EncodeToString(key)
+
+	tests := []struct {
+		name     string
+		platform string
+		version  int
+		pattern  *darwin.KeyPatternInfo // 为空时不写入特征串
+		offset   int
+		scan     bool
+		size     int // 内存大小，Windows 每个候选需要数万次 PBKDF2 迭代，扫描时使用较小的内存
+		region   int // 每次读取的区域大小，为 0 时使用默认值
+		at       int // 特征串或密钥的位置，为 0 时位于内存中间
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "darwin v3 pattern",
+			platform: "darwin",
+			version:  3,
+			pattern:  &darwin.V3KeyPatterns[0],
+			offset:   darwin.V3KeyPatterns[0].Offsets[0],
+			want:     wantKey,
+		},
+		{
+			name:     "darwin v4 pattern",
+			platform: "darwin",
+			version:  4,
+			pattern:  &darwin.V4KeyPatterns[0],
+			offset:   darwin.V4KeyPatterns[0].Offsets[1],
+			want:     wantKey,
+		},
+		{
+			name:     "darwin v4 pattern across regions",
+			platform: "darwin",
+			version:  4,
+			pattern:  &darwin.V4KeyPatterns[0],
+			offset:   darwin.V4KeyPatterns[0].Offsets[1],
+			region:   8 * 1024,
+			at:       8*1024 - 8,
+			want:     wantKey,
+		},
+		{
+			name:     "darwin v3 without pattern",
+			platform: "darwin",
+			version:  3,
+			wantErr:  true,
+		},
+		{
+			name:     "darwin v3 scan fallback",
+			platform: "darwin",
+			version:  3,
+			scan:     true,
+			want:     wantKey,
+		},
+		{
+			name:     "darwin v3 scan across regions",
+			platform: "darwin",
+			version:  3,
+			scan:     true,
+			region:   8 * 1024,
+			at:       8*1024 - 16,
+			want:     wantKey,
+		},
+		{
+			name:     "windows without scan",
+			platform: "windows",
+			version:  3,
+			pattern:  &darwin.V3KeyPatterns[0],
+			offset:   darwin.V3KeyPatterns[0].Offsets[0],
+			wantErr:  true,
+		},
+		{
+			name:     "windows scan",
+			platform: "windows",
+			version:  3,
+			scan:     true,
+			size:     1024,
+			want:     wantKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := newTestValidator(t, tt.platform, tt.version, key)
+
+			// 密钥写入时按 8 字节对齐，与暴力扫描的对齐方式一致
+			size := tt.size
+			if size == 0 {
+				size = 64 * 1024
+			}
+			memory := make([]byte, size)
+			rand.Read(memory)
+			at := size / 2
+			if tt.at != 0 {
+				at = tt.at
+			}
+			if tt.pattern != nil {
+				plantKey(memory, at, *tt.pattern, tt.offset, key)
+			} else {
+				copy(memory[at:], key)
+			}
+
+			var scanner *scan.Scanner
+			if tt.scan {
+				scanner = scan.NewScanner(validator, nil)
+			}
+
+			dump := writeDump(t, memory)
+			if tt.region != 0 {
+				dump.regionSize = tt.region
+			}
+
+			got, err := SearchDump(context.Background(), dump, validator, scanner)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SearchDump() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SearchDump() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenDumpZip(t *testing.T) {
+	memory := make([]byte, 3*1024)
+	rand.Read(memory)
+	session := []byte("session database")
+
+	path := filepath.Join(t.TempDir(), "wechat_4.0.3.19_1234.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range map[string][]byte{
+		"wechat_4.0.3.19_1234.bin":        memory,
+		"wechat_4.0.3.19_1234_session.db": session,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dump, err := OpenDump(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dump.Close()
+	dump.regionSize = 2 * DumpRegionOverlap
+
+	if dump.Size() != int64(len(memory)) {
+		t.Errorf("Size() = %d, want %d", dump.Size(), len(memory))
+	}
+
+	// 去掉重叠部分后各区域依次拼接为完整的内存数据
+	var got []byte
+	err = dump.regions(context.Background(), func(region []byte) bool {
+		if len(got) > 0 {
+			region = region[DumpRegionOverlap:]
+		}
+		got = append(got, region...)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, memory) {
+		t.Errorf("regions() read %d bytes, want %d bytes of memory", len(got), len(memory))
+	}
+
+	db := dump.SessionDB()
+	if db == nil || db.Version != 4 {
+		t.Fatalf("SessionDB() = %+v, want version 4", db)
+	}
+	dbPath, cleanup, err := db.Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if data, _ := os.ReadFile(dbPath); !bytes.Equal(data, session) {
+		t.Errorf("Extract() = %q, want %q", data, session)
+	}
+}
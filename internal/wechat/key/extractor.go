@@ -6,6 +6,7 @@ import (
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt"
 	"github.com/sjzar/chatlog/internal/wechat/key/darwin"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
 	"github.com/sjzar/chatlog/internal/wechat/key/windows"
 	"github.com/sjzar/chatlog/internal/wechat/model"
 )
@@ -19,6 +20,9 @@ type Extractor interface {
 	SearchKey(ctx context.Context, memory []byte) (string, bool)
 
 	SetValidate(validator *decrypt.Validator)
+
+	// SetScanner 设置暴力扫描器，特征串搜索失败时逐个验证内存中的候选密钥
+	SetScanner(scanner *scan.Scanner)
 }
 
 // NewExtractor 创建适合当前平台的密钥提取器
@@ -0,0 +1,229 @@
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+const (
+	KeySize = 32
+
+	// DefaultAlign 候选窗口的对齐字节数，密钥通常位于堆上按 8 字节对齐的位置
+	DefaultAlign = 8
+
+	// MinDistinctBytes 随机密钥中不同字节值的最少数量，32 字节随机数据平均约有 28 个不同的字节值
+	// 指针、字符串和填充数据的不同字节值较少，无需验证
+	MinDistinctBytes = 20
+
+	// ChunkSize 每个 goroutine 一次扫描的内存大小
+	ChunkSize = 4 * 1024 * 1024
+
+	// ProgressInterval 进度回调的间隔
+	ProgressInterval = time.Second
+
+	// DedupSlots 候选去重表的槽位数，去重表大小固定为 DedupSlots*KeySize 字节
+	// 槽位冲突时覆盖旧候选，被覆盖的候选再次出现时会重复验证，不影响结果
+	DedupSlots = 1 << 16
+
+	// dedupLocks 去重表的分段锁数量
+	dedupLocks = 64
+)
+
+// Progress 暴力扫描的进度
+type Progress struct {
+	Total      int64 // 待扫描的字节数，分区域扫描时随扫描累加
+	Scanned    int64 // 已扫描的字节数
+	Candidates int64 // 已验证的候选密钥数量
+	Elapsed    time.Duration
+}
+
+func (p *Progress) String() string {
+	percent := 0.0
+	if p.Total > 0 {
+		percent = float64(p.Scanned) * 100 / float64(p.Total)
+	}
+	return fmt.Sprintf("%s/%s (%.1f%%)，已验证 %d 个候选密钥，用时 %s",
+		util.ByteCountSI(p.Scanned), util.ByteCountSI(p.Total), percent, p.Candidates, p.Elapsed.Truncate(time.Second))
+}
+
+// Scanner 在内存中滑动 32 字节窗口，逐个验证对齐的候选密钥
+// 用于密钥特征串随微信版本更新失效时的兜底，不依赖特征串和偏移量，但耗时较长
+// 候选窗口会先按字节分布过滤并去重，每个候选仍需一次密钥派生和 HMAC 计算
+type Scanner struct {
+	validator *decrypt.Validator
+	progress  func(*Progress)
+	align     int
+	workers   int
+
+	start      time.Time
+	total      atomic.Int64
+	scanned    atomic.Int64
+	candidates atomic.Int64
+	tried      *dedup
+}
+
+// NewScanner 创建暴力扫描器，progress 不为空时定期回调扫描进度
+func NewScanner(validator *decrypt.Validator, progress func(*Progress)) *Scanner {
+	return &Scanner{
+		validator: validator,
+		progress:  progress,
+		align:     DefaultAlign,
+		workers:   runtime.NumCPU(),
+		start:     time.Now(),
+		tried:     &dedup{},
+	}
+}
+
+// Scan 并行扫描一段内存，找到有效密钥时返回十六进制密钥
+// 可多次调用以逐个扫描内存区域，已验证过的候选通常不会重复验证，ctx 取消时立即返回
+func (s *Scanner) Scan(ctx context.Context, memory []byte) (string, bool) {
+	if s.validator == nil || len(memory) < KeySize {
+		return "", false
+	}
+	s.total.Add(int64(len(memory)))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan int)
+	result := make(chan string, 1)
+	wg := sync.WaitGroup{}
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range chunks {
+				if key, ok := s.scanChunk(ctx, memory, start); ok {
+					select {
+					case result <- key:
+					default:
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(chunks)
+		for start := 0; start < len(memory); start += ChunkSize {
+			select {
+			case chunks <- start:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			s.report()
+			select {
+			case key := <-result:
+				return key, true
+			default:
+				return "", false
+			}
+		case <-ticker.C:
+			s.report()
+		}
+	}
+}
+
+// scanChunk 扫描从 start 开始的一块内存，窗口起点位于块内，窗口可以跨越块的末尾
+func (s *Scanner) scanChunk(ctx context.Context, memory []byte, start int) (string, bool) {
+	end := min(start+ChunkSize, len(memory))
+	defer s.scanned.Add(int64(end - start))
+
+	for offset := start; offset < end && offset+KeySize <= len(memory); offset += s.align {
+		if offset%(64*1024) == 0 && ctx.Err() != nil {
+			return "", false
+		}
+
+		candidate := memory[offset : offset+KeySize]
+		if !IsKeyCandidate(candidate) {
+			continue
+		}
+		if s.tried.seen(candidate) {
+			continue
+		}
+		s.candidates.Add(1)
+
+		if s.validator.Validate(candidate) {
+			log.Debug().Int("offset", offset).Msg("Key found by scan")
+			return hex.EncodeToString(candidate), true
+		}
+	}
+	return "", false
+}
+
+func (s *Scanner) report() {
+	if s.progress == nil {
+		return
+	}
+	s.progress(&Progress{
+		Total:      s.total.Load(),
+		Scanned:    s.scanned.Load(),
+		Candidates: s.candidates.Load(),
+		Elapsed:    time.Since(s.start),
+	})
+}
+
+// IsKeyCandidate 判断 32 字节数据是否可能是随机生成的密钥
+// 不同字节值过少或全部为可打印字符的数据不是密钥
+func IsKeyCandidate(data []byte) bool {
+	var seen [256]bool
+	distinct, printable := 0, 0
+	for _, b := range data {
+		if !seen[b] {
+			seen[b] = true
+			distinct++
+		}
+		if b >= 0x20 && b < 0x7f {
+			printable++
+		}
+	}
+	return distinct >= MinDistinctBytes && printable < len(data)
+}
+
+// dedup 固定大小的候选去重表，按候选的前 8 字节直接映射到槽位
+// 有损去重仍能过滤大部分重复的候选，且扫描多 GB 的内存转储时去重表也不会增长
+type dedup struct {
+	mu    [dedupLocks]sync.Mutex
+	slots [DedupSlots][KeySize]byte
+}
+
+// seen 判断候选是否已验证过，未验证过时记录候选
+func (d *dedup) seen(candidate []byte) bool {
+	index := binary.LittleEndian.Uint64(candidate) % DedupSlots
+	key := [KeySize]byte(candidate)
+
+	mu := &d.mu[index%dedupLocks]
+	mu.Lock()
+	defer mu.Unlock()
+	if d.slots[index] == key {
+		return true
+	}
+	d.slots[index] = key
+	return false
+}
@@ -0,0 +1,38 @@
+package windows
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sys/windows"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
+)
+
+// scanMemory scans all writable private memory regions with the brute-force scanner
+func scanMemory(ctx context.Context, handle windows.Handle, scanner *scan.Scanner) (string, error) {
+	log.Info().Msg("Key patterns not found, falling back to brute-force scan")
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	memoryChannel := make(chan []byte, 1)
+	go func() {
+		defer close(memoryChannel)
+		if err := findPrivateMemory(searchCtx, handle, memoryChannel); err != nil {
+			log.Err(err).Msg("Failed to find memory regions")
+		}
+	}()
+
+	for memory := range memoryChannel {
+		if key, ok := scanner.Scan(searchCtx, memory); ok {
+			return key, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+
+	return "", errors.ErrNoValidKey
+}
@@ -98,6 +98,11 @@ func (e *V3Extractor) Extract(ctx context.Context, proc *model.Process) (string,
 		}
 	}
 
+	// Fall back to brute-force scan when key patterns are not found
+	if e.scanner != nil {
+		return scanMemory(ctx, handle, e.scanner)
+	}
+
 	return "", errors.ErrNoValidKey
 }
 
@@ -4,10 +4,12 @@ import (
 	"context"
 
 	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
 )
 
 type V4Extractor struct {
 	validator *decrypt.Validator
+	scanner   *scan.Scanner
 }
 
 func NewV4Extractor() *V4Extractor {
@@ -22,3 +24,7 @@ func (e *V4Extractor) SearchKey(ctx context.Context, memory []byte) (string, boo
 func (e *V4Extractor) SetValidate(validator *decrypt.Validator) {
 	e.validator = validator
 }
+
+func (e *V4Extractor) SetScanner(scanner *scan.Scanner) {
+	e.scanner = scanner
+}
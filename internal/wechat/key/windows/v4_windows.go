@@ -66,7 +66,7 @@ func (e *V4Extractor) Extract(ctx context.Context, proc *model.Process) (string,
 	go func() {
 		defer producerWaitGroup.Done()
 		defer close(memoryChannel) // Close channel when producer is done
-		err := e.findMemory(searchCtx, handle, memoryChannel)
+		err := findPrivateMemory(searchCtx, handle, memoryChannel)
 		if err != nil {
 			log.Err(err).Msg("Failed to find memory regions")
 		}
@@ -89,11 +89,16 @@ func (e *V4Extractor) Extract(ctx context.Context, proc *model.Process) (string,
 		}
 	}
 
+	// Fall back to brute-force scan when key patterns are not found
+	if e.scanner != nil {
+		return scanMemory(ctx, handle, e.scanner)
+	}
+
 	return "", errors.ErrNoValidKey
 }
 
-// findMemoryV4 searches for writable memory regions for V4 version
-func (e *V4Extractor) findMemory(ctx context.Context, handle windows.Handle, memoryChannel chan<- []byte) error {
+// findPrivateMemory searches for writable private memory regions, used by V4 key search and brute-force scan
+func findPrivateMemory(ctx context.Context, handle windows.Handle, memoryChannel chan<- []byte) error {
 	// Define search range
 	minAddr := uintptr(0x10000)    // Process space usually starts from 0x10000
 	maxAddr := uintptr(0x7FFFFFFF) // 32-bit process space limit
@@ -7,6 +7,7 @@ import (
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt"
 	"github.com/sjzar/chatlog/internal/wechat/key"
+	"github.com/sjzar/chatlog/internal/wechat/key/scan"
 	"github.com/sjzar/chatlog/internal/wechat/model"
 )
 
@@ -64,6 +65,15 @@ func (a *Account) RefreshStatus() error {
 
 // GetKey 获取账号的密钥
 func (a *Account) GetKey(ctx context.Context) (string, error) {
+	return a.getKey(ctx, false, nil)
+}
+
+// ScanKey 获取账号的密钥，特征串搜索失败时暴力扫描进程内存，progress 不为空时定期回调扫描进度
+func (a *Account) ScanKey(ctx context.Context, progress func(*scan.Progress)) (string, error) {
+	return a.getKey(ctx, true, progress)
+}
+
+func (a *Account) getKey(ctx context.Context, fallback bool, progress func(*scan.Progress)) (string, error) {
 	// 如果已经有密钥，直接返回
 	if a.Key != "" {
 		return a.Key, nil
@@ -96,6 +106,9 @@ func (a *Account) GetKey(ctx context.Context) (string, error) {
 	}
 
 	extractor.SetValidate(validator)
+	if fallback {
+		extractor.SetScanner(scan.NewScanner(validator, progress))
+	}
 
 	// 提取密钥
 	key, err := extractor.Extract(ctx, process)
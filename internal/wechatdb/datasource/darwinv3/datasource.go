@@ -3,6 +3,7 @@ package darwinv3
 import (
 	"context"
 	"crypto/md5"
+	"database/sql"
 	"encoding/hex"
 	"fmt"
 	"regexp"
@@ -17,6 +18,7 @@ import (
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb/datasource/dbm"
+	"github.com/sjzar/chatlog/internal/wechatdb/datasource/msgmerge"
 	"github.com/sjzar/chatlog/pkg/util"
 )
 
@@ -192,14 +194,72 @@ func (ds *DataSource) initChatRoomDb() error {
 }
 
 func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
-	if talker == "" {
-		return nil, errors.ErrTalkerEmpty
+	return ds.getMessages(ctx, startTime, endTime, talker, sender, keyword, nil, limit, offset)
+}
+
+// GetMessagesByCursor 从游标之后开始查询消息，返回下一页的游标，没有更多消息时游标为 nil
+// darwinv3 按聊天对象分库，消息不按时间分片，游标中的分片始终为 0
+func (ds *DataSource) GetMessagesByCursor(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, cursor *model.Cursor, limit int) ([]*model.Message, *model.Cursor, error) {
+	messages, err := ds.getMessages(ctx, startTime, endTime, talker, sender, keyword, cursor, limit, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if limit <= 0 || len(messages) < limit {
+		return messages, nil, nil
+	}
+	return messages, model.NewCursor(messages[len(messages)-1], 0), nil
+}
+
+func (ds *DataSource) getMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, cursor *model.Cursor, limit, offset int) ([]*model.Message, error) {
+	// 需要读取的消息数量，limit <= 0 时读取全部
+	want := 0
+	if limit > 0 {
+		want = offset + limit
 	}
 
-	// 解析talker参数，支持多个talker（以英文逗号分隔）
+	// 通过过滤的消息按 Seq 顺序加入结果，满足数量后停止读取
+	filteredMessages := []*model.Message{}
+	err := ds.walkMessages(ctx, startTime, endTime, talker, sender, keyword, cursor, want, true, func(message *model.Message) bool {
+		filteredMessages = append(filteredMessages, message)
+		return want == 0 || len(filteredMessages) < want
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 处理分页
+	if limit > 0 {
+		if offset >= len(filteredMessages) {
+			return []*model.Message{}, nil
+		}
+		end := offset + limit
+		if end > len(filteredMessages) {
+			end = len(filteredMessages)
+		}
+		return filteredMessages[offset:end], nil
+	}
+
+	return filteredMessages, nil
+}
+
+// WalkMessages 依次读取每个消息表中符合条件的消息，fn 返回 false 时停止，不保留已读取的消息
+// 同一聊天的消息按 Seq 顺序，不同聊天之间不保证顺序
+func (ds *DataSource) WalkMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, fn func(message *model.Message) bool) error {
+	return ds.walkMessages(ctx, startTime, endTime, talker, sender, keyword, nil, 0, false, fn)
+}
+
+// walkMessages 从游标之后按 Seq 顺序读取符合条件的消息并调用 fn，batch 为每个消息表首次读取的数量，<= 0 时使用默认值
+// ordered 为 false 时不归并，依次读取每个消息表，只保证同一消息表中的顺序
+func (ds *DataSource) walkMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, cursor *model.Cursor, batch int, ordered bool, fn func(message *model.Message) bool) error {
+	// 解析talker参数，支持多个talker（以英文逗号分隔），为空时查询所有聊天
 	talkers := util.Str2List(talker, ",")
+	talkerMd5s := make(map[string]string)
 	if len(talkers) == 0 {
-		return nil, errors.ErrTalkerEmpty
+		talkerMd5s = ds.getAllTalkers(ctx)
+	}
+	for _, talkerItem := range talkers {
+		_talkerMd5Bytes := md5.Sum([]byte(talkerItem))
+		talkerMd5s[hex.EncodeToString(_talkerMd5Bytes[:])] = talkerItem
 	}
 
 	// 解析sender参数，支持多个发送者（以英文逗号分隔）
@@ -211,142 +271,267 @@ func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.T
 		var err error
 		regex, err = regexp.Compile(keyword)
 		if err != nil {
-			return nil, errors.QueryFailed("invalid regex pattern", err)
+			return errors.QueryFailed("invalid regex pattern", err)
 		}
 	}
 
-	// 从每个相关数据库中查询消息，并在读取时进行过滤
-	filteredMessages := []*model.Message{}
-
-	// 对每个talker进行查询
-	for _, talkerItem := range talkers {
-		// 检查上下文是否已取消
-		if err := ctx.Err(); err != nil {
-			return nil, err
-		}
+	// 归并各消息表得到全局顺序，不需要时依次读取每个消息表
+	walk := msgmerge.Walk
+	if !ordered {
+		walk = msgmerge.WalkEach
+	}
 
+	// 每个talker的消息表按创建时间分批读取，只读取当前页需要的消息
+	// 同一秒内消息的 Seq 依赖读取顺序，分批时以整秒为界，排序键为 Seq 所在的秒
+	tables := make([]*msgmerge.Table, 0, len(talkerMd5s))
+	for talkerMd5, talkerItem := range talkerMd5s {
 		// 在 darwinv3 中，需要先找到对应的数据库
-		_talkerMd5Bytes := md5.Sum([]byte(talkerItem))
-		talkerMd5 := hex.EncodeToString(_talkerMd5Bytes[:])
 		dbPath, ok := ds.talkerDBMap[talkerMd5]
 		if !ok {
 			// 如果找不到对应的数据库，跳过此talker
 			continue
 		}
 
-		db, err := ds.dbm.OpenDB(dbPath)
-		if err != nil {
-			log.Error().Msgf("数据库 %s 未打开", dbPath)
-			continue
-		}
-
 		tableName := fmt.Sprintf("Chat_%s", talkerMd5)
-
-		// 构建查询条件
-		query := fmt.Sprintf(`
-			SELECT msgCreateTime, msgContent, messageType, mesDes
-			FROM %s 
-			WHERE msgCreateTime >= ? AND msgCreateTime <= ? 
-			ORDER BY msgCreateTime ASC
-		`, tableName)
-
-		// 执行查询
-		rows, err := db.QueryContext(ctx, query, startTime.Unix(), endTime.Unix())
-		if err != nil {
-			// 如果表不存在，跳过此talker
-			if strings.Contains(err.Error(), "no such table") {
-				continue
+		talkerItem := talkerItem
+		table := msgmerge.NewTable(func(ctx context.Context, from int64, n int) ([]*model.Message, error) {
+			// Seq 的前 10 位为创建时间
+			queryStart := startTime.Unix()
+			if from/1000 > queryStart {
+				queryStart = from / 1000
 			}
-			log.Err(err).Msgf("从数据库 %s 查询消息失败", dbPath)
-			continue
+			return ds.queryMessages(ctx, dbPath, tableName, talkerItem, queryStart, endTime.Unix(), n)
+		}, msgmerge.CursorFrom(cursor))
+		table.Key = func(m *model.Message) int64 {
+			return m.Seq / 1000 * 1000
 		}
+		tables = append(tables, table)
+	}
 
-		// 处理查询结果，在读取时进行过滤
-		for rows.Next() {
-			var msg model.MessageDarwinV3
-			err := rows.Scan(
-				&msg.MsgCreateTime,
-				&msg.MsgContent,
-				&msg.MessageType,
-				&msg.MesDes,
-			)
-			if err != nil {
-				rows.Close()
-				log.Err(err).Msgf("扫描消息行失败")
-				continue
-			}
+	// 读取各talker的消息，并在读取时进行过滤
+	return walk(ctx, tables, batch, func(message *model.Message) bool {
+		// 跳过游标之前的消息
+		if !cursor.Before(message) {
+			return true
+		}
 
-			// 将消息包装为通用模型
-			message := msg.Wrap(talkerItem)
-
-			// 应用sender过滤
-			if len(senders) > 0 {
-				senderMatch := false
-				for _, s := range senders {
-					if message.Sender == s {
-						senderMatch = true
-						break
-					}
-				}
-				if !senderMatch {
-					continue // 不匹配sender，跳过此消息
+		// 应用sender过滤
+		if len(senders) > 0 {
+			senderMatch := false
+			for _, s := range senders {
+				if message.Sender == s {
+					senderMatch = true
+					break
 				}
 			}
+			if !senderMatch {
+				return true // 不匹配sender，跳过此消息
+			}
+		}
 
-			// 应用keyword过滤
-			if regex != nil {
-				plainText := message.PlainTextContent()
-				if !regex.MatchString(plainText) {
-					continue // 不匹配keyword，跳过此消息
-				}
+		// 应用keyword过滤
+		if regex != nil {
+			plainText := message.PlainTextContent()
+			if !regex.MatchString(plainText) {
+				return true // 不匹配keyword，跳过此消息
 			}
+		}
 
-			// 通过所有过滤条件，保留此消息
-			filteredMessages = append(filteredMessages, message)
+		return fn(message)
+	})
+}
 
-			// 检查是否已经满足分页处理数量
-			if limit > 0 && len(filteredMessages) >= offset+limit {
-				// 已经获取了足够的消息，可以提前返回
-				rows.Close()
+// queryMessages 按创建时间读取一个聊天从 start 秒开始的至多 limit 条消息，表不存在时返回空结果
+// 消息表中没有可用的序号，使用 创建时间 + 同一秒内的顺序 作为 Seq，start 需为某一秒中第一条消息的读取位置
+func (ds *DataSource) queryMessages(ctx context.Context, dbPath, tableName, talker string, start, end int64, limit int) ([]*model.Message, error) {
+	db, err := ds.dbm.OpenDB(dbPath)
+	if err != nil {
+		log.Error().Msgf("数据库 %s 未打开", dbPath)
+		return nil, nil
+	}
 
-				// 对所有消息按时间排序
-				sort.Slice(filteredMessages, func(i, j int) bool {
-					return filteredMessages[i].Seq < filteredMessages[j].Seq
-				})
+	query := fmt.Sprintf(`
+		SELECT msgCreateTime, msgContent, messageType, mesDes
+		FROM %s 
+		WHERE msgCreateTime >= ? AND msgCreateTime <= ? 
+		ORDER BY msgCreateTime ASC, mesLocalID ASC
+		LIMIT %d
+	`, tableName, limit)
 
-				// 处理分页
-				if offset >= len(filteredMessages) {
-					return []*model.Message{}, nil
-				}
-				end := offset + limit
-				if end > len(filteredMessages) {
-					end = len(filteredMessages)
-				}
-				return filteredMessages[offset:end], nil
-			}
+	rows, err := db.QueryContext(ctx, query, start, end)
+	if err != nil {
+		// 如果表不存在，跳过此talker
+		if strings.Contains(err.Error(), "no such table") {
+			return nil, nil
+		}
+		return nil, errors.QueryFailed(query, err)
+	}
+	defer rows.Close()
+
+	var lastCreateTime, n int64
+	messages := make([]*model.Message, 0, limit)
+	for rows.Next() {
+		var msg model.MessageDarwinV3
+		err := rows.Scan(
+			&msg.MsgCreateTime,
+			&msg.MsgContent,
+			&msg.MessageType,
+			&msg.MesDes,
+		)
+		if err != nil {
+			return nil, errors.ScanRowFailed(err)
+		}
+
+		// 将消息包装为通用模型
+		message := msg.Wrap(talker)
+		if msg.MsgCreateTime != lastCreateTime {
+			lastCreateTime, n = msg.MsgCreateTime, 0
+		}
+		message.Seq = msg.MsgCreateTime*1000 + n
+		n++
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// GetMessageContext 获取聊天中指定消息前后的消息，按 Seq 升序排列
+// 结果包含 Seq 对应的消息 (存在时)
+// 消息表中没有序号，先确定前后消息的时间范围，再按秒读取完整的消息以计算 Seq
+func (ds *DataSource) GetMessageContext(ctx context.Context, talker string, seq int64, before, after int) ([]*model.Message, error) {
+	if talker == "" {
+		return nil, errors.ErrTalkerEmpty
+	}
+
+	_talkerMd5Bytes := md5.Sum([]byte(talker))
+	talkerMd5 := hex.EncodeToString(_talkerMd5Bytes[:])
+	dbPath, ok := ds.talkerDBMap[talkerMd5]
+	if !ok {
+		return []*model.Message{}, nil
+	}
+	db, err := ds.dbm.OpenDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	tableName := fmt.Sprintf("Chat_%s", talkerMd5)
+
+	t := seq / 1000
+	lo, hi := t, t
+	boundary := func(query string, limit int) (int64, error) {
+		var v sql.NullInt64
+		err := db.QueryRowContext(ctx, fmt.Sprintf(query, tableName), t, limit).Scan(&v)
+		if err != nil {
+			return 0, errors.QueryFailed(query, err)
+		}
+		return v.Int64, nil
+	}
+	if before > 0 {
+		v, err := boundary("SELECT MIN(msgCreateTime) FROM (SELECT msgCreateTime FROM %s WHERE msgCreateTime < ? ORDER BY msgCreateTime DESC LIMIT ?)", before)
+		if err != nil {
+			return nil, err
+		}
+		if v > 0 {
+			lo = v
+		}
+	}
+	if after > 0 {
+		v, err := boundary("SELECT MAX(msgCreateTime) FROM (SELECT msgCreateTime FROM %s WHERE msgCreateTime > ? ORDER BY msgCreateTime ASC LIMIT ?)", after)
+		if err != nil {
+			return nil, err
+		}
+		if v > 0 {
+			hi = v
 		}
-		rows.Close()
 	}
 
-	// 对所有消息按时间排序
-	// FIXME 不同 talker 需要使用 Time 排序
-	sort.Slice(filteredMessages, func(i, j int) bool {
-		return filteredMessages[i].Time.Before(filteredMessages[j].Time)
+	query := fmt.Sprintf(`
+		SELECT msgCreateTime, msgContent, messageType, mesDes
+		FROM %s 
+		WHERE msgCreateTime >= ? AND msgCreateTime <= ? 
+		ORDER BY msgCreateTime ASC, mesLocalID ASC
+	`, tableName)
+	rows, err := db.QueryContext(ctx, query, lo, hi)
+	if err != nil {
+		return nil, errors.QueryFailed(query, err)
+	}
+	defer rows.Close()
+
+	messages := make([]*model.Message, 0)
+	var lastCreateTime, n int64
+	for rows.Next() {
+		var msg model.MessageDarwinV3
+		if err := rows.Scan(&msg.MsgCreateTime, &msg.MsgContent, &msg.MessageType, &msg.MesDes); err != nil {
+			return nil, errors.ScanRowFailed(err)
+		}
+		message := msg.Wrap(talker)
+		if msg.MsgCreateTime != lastCreateTime {
+			lastCreateTime, n = msg.MsgCreateTime, 0
+		}
+		message.Seq = msg.MsgCreateTime*1000 + n
+		n++
+		messages = append(messages, message)
+	}
+
+	// 定位 Seq 对应的消息，不存在时定位到其后的第一条消息
+	i := sort.Search(len(messages), func(i int) bool {
+		return messages[i].Seq >= seq
 	})
+	start, end := i-before, i+after
+	if i < len(messages) && messages[i].Seq == seq {
+		end++
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(messages) {
+		end = len(messages)
+	}
+	return messages[start:end], nil
+}
 
-	// 处理分页
-	if limit > 0 {
-		if offset >= len(filteredMessages) {
-			return []*model.Message{}, nil
+// getAllTalkers 获取所有聊天，返回 talker 的 md5 到 talker 的映射
+// 消息表名为 Chat_ 加 talker 的 md5，通过联系人、群聊和会话中的用户名还原 talker
+// 无法还原的消息表使用 md5 作为 talker
+func (ds *DataSource) getAllTalkers(ctx context.Context) map[string]string {
+	queries := []struct {
+		group string
+		query string
+	}{
+		{Contact, "SELECT IFNULL(m_nsUsrName,\"\") FROM WCContact"},
+		{ChatRoom, "SELECT IFNULL(m_nsUsrName,\"\") FROM GroupContact"},
+		{Session, "SELECT IFNULL(m_nsUserName,\"\") FROM SessionAbstract"},
+	}
+
+	md5ToTalker := make(map[string]string)
+	for _, q := range queries {
+		db, err := ds.dbm.GetDB(q.group)
+		if err != nil {
+			continue
 		}
-		end := offset + limit
-		if end > len(filteredMessages) {
-			end = len(filteredMessages)
+		rows, err := db.QueryContext(ctx, q.query)
+		if err != nil {
+			log.Debug().Err(err).Msgf("查询 %s 用户名失败", q.group)
+			continue
 		}
-		return filteredMessages[offset:end], nil
+		for rows.Next() {
+			var userName string
+			if err := rows.Scan(&userName); err != nil || userName == "" {
+				continue
+			}
+			_md5Bytes := md5.Sum([]byte(userName))
+			md5ToTalker[hex.EncodeToString(_md5Bytes[:])] = userName
+		}
+		rows.Close()
 	}
 
-	return filteredMessages, nil
+	talkers := make(map[string]string, len(ds.talkerDBMap))
+	for talkerMd5 := range ds.talkerDBMap {
+		if talker, ok := md5ToTalker[talkerMd5]; ok {
+			talkers[talkerMd5] = talker
+		} else {
+			talkers[talkerMd5] = talkerMd5
+		}
+	}
+	return talkers
 }
 
 // 从表名中提取 talker
@@ -370,13 +555,15 @@ func (ds *DataSource) GetContacts(ctx context.Context, key string, limit, offset
 
 	if key != "" {
 		// 按照关键字查询
-		query = `SELECT IFNULL(m_nsUsrName,""), IFNULL(nickname,""), IFNULL(m_nsRemark,""), m_uiSex, IFNULL(m_nsAliasName,"") 
+		query = `SELECT IFNULL(m_nsUsrName,""), IFNULL(nickname,""), IFNULL(m_nsRemark,""), m_uiSex, IFNULL(m_nsAliasName,""),
+				IFNULL(m_nsFullPY,""), IFNULL(m_nsShortPY,""), IFNULL(m_nsRemarkPYFull,""), IFNULL(m_nsRemarkPYShort,"") 
 				FROM WCContact 
 				WHERE m_nsUsrName = ? OR nickname = ? OR m_nsRemark = ? OR m_nsAliasName = ?`
 		args = []interface{}{key, key, key, key}
 	} else {
 		// 查询所有联系人
-		query = `SELECT IFNULL(m_nsUsrName,""), IFNULL(nickname,""), IFNULL(m_nsRemark,""), m_uiSex, IFNULL(m_nsAliasName,"") 
+		query = `SELECT IFNULL(m_nsUsrName,""), IFNULL(nickname,""), IFNULL(m_nsRemark,""), m_uiSex, IFNULL(m_nsAliasName,""),
+				IFNULL(m_nsFullPY,""), IFNULL(m_nsShortPY,""), IFNULL(m_nsRemarkPYFull,""), IFNULL(m_nsRemarkPYShort,"") 
 				FROM WCContact`
 	}
 
@@ -409,6 +596,10 @@ func (ds *DataSource) GetContacts(ctx context.Context, key string, limit, offset
 			&contactDarwinV3.M_nsRemark,
 			&contactDarwinV3.M_uiSex,
 			&contactDarwinV3.M_nsAliasName,
+			&contactDarwinV3.M_nsFullPY,
+			&contactDarwinV3.M_nsShortPY,
+			&contactDarwinV3.M_nsRemarkPYFull,
+			&contactDarwinV3.M_nsRemarkPYShort,
 		)
 
 		if err != nil {
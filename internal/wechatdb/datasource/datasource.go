@@ -18,6 +18,15 @@ type DataSource interface {
 	// 消息
 	GetMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error)
 
+	// 消息，按游标分页
+	GetMessagesByCursor(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, cursor *model.Cursor, limit int) ([]*model.Message, *model.Cursor, error)
+
+	// 消息，依次读取每个消息表，同一聊天内按 Seq 顺序，fn 返回 false 时停止
+	WalkMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, fn func(message *model.Message) bool) error
+
+	// 消息上下文，指定消息前后的消息
+	GetMessageContext(ctx context.Context, talker string, seq int64, before, after int) ([]*model.Message, error)
+
 	// 联系人
 	GetContacts(ctx context.Context, key string, limit, offset int) ([]*model.Contact, error)
 
@@ -2,6 +2,7 @@ package dbm
 
 import (
 	"database/sql"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
@@ -15,6 +16,9 @@ import (
 	"github.com/sjzar/chatlog/pkg/filemonitor"
 )
 
+// WriteDebounceTime 数据库文件被原地更新时，最后一次写入后等待的时间
+var WriteDebounceTime = 1 * time.Second
+
 type DBManager struct {
 	path    string
 	fm      *filemonitor.FileMonitor
@@ -25,13 +29,15 @@ type DBManager struct {
 }
 
 func NewDBManager(path string) *DBManager {
-	return &DBManager{
+	d := &DBManager{
 		path:    path,
 		fm:      filemonitor.NewFileMonitor(),
 		fgs:     make(map[string]*filemonitor.FileGroup),
 		dbs:     make(map[string]*sql.DB),
 		dbPaths: make(map[string][]string),
 	}
+	register(d)
+	return d
 }
 
 func (d *DBManager) AddGroup(g *Group) error {
@@ -39,7 +45,7 @@ func (d *DBManager) AddGroup(g *Group) error {
 	if err != nil {
 		return err
 	}
-	fg.AddCallback(d.Callback)
+	fg.AddCallback(coalesceWrites(d.Callback))
 	d.fm.AddGroup(fg)
 	d.mutex.Lock()
 	d.fgs[g.Name] = fg
@@ -54,10 +60,40 @@ func (d *DBManager) AddCallback(name string, callback func(event fsnotify.Event)
 	if !ok {
 		return errors.FileGroupNotFound(name)
 	}
-	fg.AddCallback(callback)
+	fg.AddCallback(coalesceWrites(callback))
 	return nil
 }
 
+// coalesceWrites 将原地更新数据库文件产生的连续写入事件合并为一次 Create 事件
+// 回调只需处理 Create 事件，无需区分数据库文件是被替换还是被原地更新
+func coalesceWrites(callback func(event fsnotify.Event) error) func(event fsnotify.Event) error {
+	var mu sync.Mutex
+	timers := make(map[string]*time.Timer)
+	return func(event fsnotify.Event) error {
+		if event.Op.Has(fsnotify.Create) || !event.Op.Has(fsnotify.Write) {
+			return callback(event)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if t, ok := timers[event.Name]; ok {
+			t.Reset(WriteDebounceTime)
+			return nil
+		}
+		timers[event.Name] = time.AfterFunc(WriteDebounceTime, func() {
+			mu.Lock()
+			delete(timers, event.Name)
+			mu.Unlock()
+			if err := callback(fsnotify.Event{Name: event.Name, Op: fsnotify.Create}); err != nil {
+				log.Err(err).Msgf("callback for %s failed", event.Name)
+			}
+		})
+		return nil
+	}
+}
+
+// GetDB 获取文件组中第一个数据库文件的连接
+// 返回的连接会在文件被 LockFile 锁定或重新解密时关闭，调用方不能保存，每次查询前需重新获取
 func (d *DBManager) GetDB(name string) (*sql.DB, error) {
 	dbPaths, err := d.GetDBPath(name)
 	if err != nil {
@@ -66,6 +102,7 @@ func (d *DBManager) GetDB(name string) (*sql.DB, error) {
 	return d.OpenDB(dbPaths[0])
 }
 
+// GetDBs 获取文件组中所有数据库文件的连接，连接的有效期与 GetDB 相同
 func (d *DBManager) GetDBs(name string) ([]*sql.DB, error) {
 	dbPaths, err := d.GetDBPath(name)
 	if err != nil {
@@ -108,7 +145,11 @@ func (d *DBManager) GetDBPath(name string) ([]string, error) {
 	return dbPaths, nil
 }
 
+// OpenDB 获取数据库文件的连接，连接按清理后的路径缓存，连接的有效期与 GetDB 相同
 func (d *DBManager) OpenDB(path string) (*sql.DB, error) {
+	// 与 LockFile 使用相同的路径作为缓存键，否则锁定时无法关闭以其他写法打开的连接
+	path = filepath.Clean(path)
+
 	d.mutex.RLock()
 	db, ok := d.dbs[path]
 	d.mutex.RUnlock()
@@ -129,9 +170,12 @@ func (d *DBManager) OpenDB(path string) (*sql.DB, error) {
 		log.Err(err).Msgf("连接数据库 %s 失败", path)
 		return nil, err
 	}
-	d.mutex.Lock()
-	d.dbs[path] = db
-	d.mutex.Unlock()
+	// 文件正在被原地更新时，等待更新完成后重新打开
+	if ok, wait := d.storeUnlocked(path, db); !ok {
+		db.Close()
+		<-wait
+		return d.OpenDB(path)
+	}
 	return db, nil
 }
 
@@ -140,10 +184,11 @@ func (d *DBManager) Callback(event fsnotify.Event) error {
 		return nil
 	}
 
+	name := filepath.Clean(event.Name)
 	d.mutex.Lock()
-	db, ok := d.dbs[event.Name]
+	db, ok := d.dbs[name]
 	if ok {
-		delete(d.dbs, event.Name)
+		delete(d.dbs, name)
 		go func(db *sql.DB) {
 			time.Sleep(time.Second * 5)
 			db.Close()
@@ -163,6 +208,7 @@ func (d *DBManager) Stop() error {
 }
 
 func (d *DBManager) Close() error {
+	unregister(d)
 	for _, db := range d.dbs {
 		db.Close()
 	}
@@ -0,0 +1,92 @@
+package dbm
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+)
+
+// 工作目录中的数据库文件被原地更新期间，已打开的连接可能读到新旧混合的页面
+// 更新方在写入前调用 LockFile，关闭所有 DBManager 中该文件的连接并阻止重新打开，写入完成后调用 UnlockFile
+var registry = struct {
+	mu       sync.Mutex
+	managers map[*DBManager]struct{}
+	locked   map[string]chan struct{} // 解锁时关闭，唤醒等待打开该文件的调用方
+}{
+	managers: make(map[*DBManager]struct{}),
+	locked:   make(map[string]chan struct{}),
+}
+
+func register(d *DBManager) {
+	registry.mu.Lock()
+	registry.managers[d] = struct{}{}
+	registry.mu.Unlock()
+}
+
+func unregister(d *DBManager) {
+	registry.mu.Lock()
+	delete(registry.managers, d)
+	registry.mu.Unlock()
+}
+
+// LockFile 关闭所有 DBManager 中 path 的连接，并在 UnlockFile 之前阻止重新打开
+// 关闭连接时会等待正在执行的查询完成，同一文件已被锁定时等待其解锁
+// 调用方此前通过 GetDB、OpenDB 获取的连接随之关闭，再使用会返回 sql: database is closed，需重新获取
+func LockFile(path string) {
+	path = filepath.Clean(path)
+
+	registry.mu.Lock()
+	for {
+		ch, ok := registry.locked[path]
+		if !ok {
+			break
+		}
+		registry.mu.Unlock()
+		<-ch
+		registry.mu.Lock()
+	}
+	registry.locked[path] = make(chan struct{})
+	managers := make([]*DBManager, 0, len(registry.managers))
+	for d := range registry.managers {
+		managers = append(managers, d)
+	}
+	registry.mu.Unlock()
+
+	for _, d := range managers {
+		d.mutex.Lock()
+		db, ok := d.dbs[path]
+		delete(d.dbs, path)
+		d.mutex.Unlock()
+		if ok {
+			db.Close()
+		}
+	}
+}
+
+// UnlockFile 解除 LockFile 的锁定，之后的查询会重新打开文件
+func UnlockFile(path string) {
+	path = filepath.Clean(path)
+
+	registry.mu.Lock()
+	ch, ok := registry.locked[path]
+	delete(registry.locked, path)
+	registry.mu.Unlock()
+	if ok {
+		close(ch)
+	}
+}
+
+// storeUnlocked 在 path 未被锁定时缓存连接并返回 true；已被锁定时返回等待解锁的 channel
+// 检查锁定和缓存连接在同一临界区内完成，LockFile 之后不会再缓存该文件的连接
+// path 需已经过 filepath.Clean，与 LockFile 查找连接时使用的路径一致
+func (d *DBManager) storeUnlocked(path string, db *sql.DB) (bool, <-chan struct{}) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if ch, ok := registry.locked[path]; ok {
+		return false, ch
+	}
+	d.mutex.Lock()
+	d.dbs[path] = db
+	d.mutex.Unlock()
+	return true, nil
+}
@@ -0,0 +1,62 @@
+package dbm
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.db")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDBManager(dir)
+	defer d.Close()
+
+	// 以未清理的路径打开，锁定时仍能找到并关闭该连接
+	db, err := d.OpenDB(dir + "/./session.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	LockFile(path)
+	if err := db.Ping(); err == nil {
+		t.Error("connection is still open after LockFile")
+	}
+
+	opened := make(chan *sql.DB)
+	go func() {
+		db, err := d.OpenDB(path)
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- db
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("OpenDB returned while the file is locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	UnlockFile(path)
+	select {
+	case db := <-opened:
+		if db == nil {
+			return
+		}
+		if err := db.Ping(); err != nil {
+			t.Errorf("reopened connection: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OpenDB did not return after UnlockFile")
+	}
+}
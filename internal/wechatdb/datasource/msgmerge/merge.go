@@ -0,0 +1,171 @@
+package msgmerge
+
+import (
+	"container/heap"
+	"context"
+	"math"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+const (
+	// MinBatchSize 每个消息表单次查询的最少消息数量
+	MinBatchSize = 16
+
+	// MaxBatchSize 每个消息表单次查询的最多消息数量，同一排序键的消息多于此数量时仍会完整读取
+	MaxBatchSize = 1000
+)
+
+// QueryFunc 按排序键升序读取排序键不小于 from 的至多 limit 条消息
+// 同一消息表中的消息需按 Seq 升序返回，返回的消息少于 limit 时表示已读取完毕
+type QueryFunc func(ctx context.Context, from int64, limit int) ([]*model.Message, error)
+
+// Table 可以分批读取的单个消息表
+type Table struct {
+	Query QueryFunc
+	From  int64                        // 第一批的起始排序键
+	Key   func(m *model.Message) int64 // 消息的排序键，为空时使用 Seq；多条消息可以有相同的排序键
+
+	buf   []*model.Message
+	limit int
+	done  bool
+}
+
+// NewTable 创建从 from 开始读取的消息表，排序键为消息的 Seq
+func NewTable(query QueryFunc, from int64) *Table {
+	return &Table{Query: query, From: from}
+}
+
+// CursorFrom 游标对应的起始排序键，游标为空时从头读取
+// 游标所指消息的排序键相同的消息会被再次读取，由 Cursor.Before 过滤
+func CursorFrom(cursor *model.Cursor) int64 {
+	if cursor == nil {
+		return math.MinInt64
+	}
+	return cursor.Seq
+}
+
+func (t *Table) key(m *model.Message) int64 {
+	if t.Key == nil {
+		return m.Seq
+	}
+	return t.Key(m)
+}
+
+// fill 读取下一批消息，批次末尾排序键相同的消息可能不完整，留到下一批从该排序键重新读取
+func (t *Table) fill(ctx context.Context) error {
+	for {
+		messages, err := t.Query(ctx, t.From, t.limit)
+		if err != nil {
+			return err
+		}
+		if len(messages) < t.limit {
+			t.buf, t.done = messages, true
+			return nil
+		}
+
+		last := t.key(messages[len(messages)-1])
+		i := len(messages)
+		for i > 0 && t.key(messages[i-1]) == last {
+			i--
+		}
+		if i > 0 {
+			t.buf, t.From = messages[:i], last
+			if t.limit < MaxBatchSize {
+				t.limit = min(t.limit*2, MaxBatchSize)
+			}
+			return nil
+		}
+
+		// 整批消息的排序键相同，扩大批次后重新读取
+		t.limit *= 2
+	}
+}
+
+// Walk 按 Seq、Talker 顺序归并多个消息表，依次调用 fn，fn 返回 false 时停止
+// 每个消息表分批读取，单批数量从 batch 开始逐步增大，batch <= 0 时使用 MaxBatchSize
+func Walk(ctx context.Context, tables []*Table, batch int, fn func(m *model.Message) bool) error {
+	if batch <= 0 || batch > MaxBatchSize {
+		batch = MaxBatchSize
+	}
+	batch = max(batch, MinBatchSize)
+
+	h := make(tableHeap, 0, len(tables))
+	for _, t := range tables {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.limit = batch
+		if err := t.fill(ctx); err != nil {
+			return err
+		}
+		if len(t.buf) > 0 {
+			h = append(h, t)
+		}
+	}
+	heap.Init(&h)
+
+	for len(h) > 0 {
+		t := h[0]
+		m := t.buf[0]
+		t.buf = t.buf[1:]
+		if len(t.buf) == 0 && !t.done {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := t.fill(ctx); err != nil {
+				return err
+			}
+		}
+		if len(t.buf) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+
+		if !fn(m) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// WalkEach 依次读取每个消息表并调用 fn，fn 返回 false 时停止
+// 只保证同一消息表中的消息按 Seq 顺序，同一时间只有一个消息表在读取，适用于不需要全局顺序的聚合
+func WalkEach(ctx context.Context, tables []*Table, batch int, fn func(m *model.Message) bool) error {
+	for _, t := range tables {
+		stopped := false
+		err := Walk(ctx, []*Table{t}, batch, func(m *model.Message) bool {
+			stopped = !fn(m)
+			return !stopped
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableHeap 按各消息表当前第一条消息的 Seq、Talker 排序的最小堆
+type tableHeap []*Table
+
+func (h tableHeap) Len() int { return len(h) }
+
+func (h tableHeap) Less(i, j int) bool {
+	a, b := h[i].buf[0], h[j].buf[0]
+	if a.Seq != b.Seq {
+		return a.Seq < b.Seq
+	}
+	return a.Talker < b.Talker
+}
+
+func (h tableHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *tableHeap) Push(x any) { *h = append(*h, x.(*Table)) }
+
+func (h *tableHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
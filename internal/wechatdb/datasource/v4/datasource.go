@@ -18,6 +18,7 @@ import (
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb/datasource/dbm"
+	"github.com/sjzar/chatlog/internal/wechatdb/datasource/msgmerge"
 	"github.com/sjzar/chatlog/pkg/util"
 )
 
@@ -178,20 +179,89 @@ func (ds *DataSource) getDBInfosForTimeRange(startTime, endTime time.Time) []Mes
 }
 
 func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
-	if talker == "" {
-		return nil, errors.ErrTalkerEmpty
+	return ds.getMessages(ctx, startTime, endTime, talker, sender, keyword, nil, limit, offset)
+}
+
+// GetMessagesByCursor 从游标之后开始查询消息，返回下一页的游标，没有更多消息时游标为 nil
+func (ds *DataSource) GetMessagesByCursor(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, cursor *model.Cursor, limit int) ([]*model.Message, *model.Cursor, error) {
+	messages, err := ds.getMessages(ctx, startTime, endTime, talker, sender, keyword, cursor, limit, 0)
+	if err != nil {
+		return nil, nil, err
 	}
+	if limit <= 0 || len(messages) < limit {
+		return messages, nil, nil
+	}
+	last := messages[len(messages)-1]
+	return messages, model.NewCursor(last, ds.shardID(last.Time)), nil
+}
 
-	// 解析talker参数，支持多个talker（以英文逗号分隔）
-	talkers := util.Str2List(talker, ",")
-	if len(talkers) == 0 {
-		return nil, errors.ErrTalkerEmpty
+// getShard 获取可能包含指定时间消息的第一个数据库分片
+func (ds *DataSource) getShard(t time.Time) int {
+	for i, info := range ds.messageInfos {
+		if !info.EndTime.Before(t) {
+			return i
+		}
 	}
+	return len(ds.messageInfos) - 1
+}
+
+// shardID 获取可能包含指定时间消息的第一个数据库分片的开始时间，新增分片后依然不变，用作游标中的分片标识
+func (ds *DataSource) shardID(t time.Time) int64 {
+	i := ds.getShard(t)
+	if i < 0 {
+		return 0
+	}
+	return ds.messageInfos[i].StartTime.Unix()
+}
+
+func (ds *DataSource) getMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, cursor *model.Cursor, limit, offset int) ([]*model.Message, error) {
+	// 需要读取的消息数量，limit <= 0 时读取全部
+	want := 0
+	if limit > 0 {
+		want = offset + limit
+	}
+
+	// 通过过滤的消息按 Seq 顺序加入结果，满足数量后停止读取
+	filteredMessages := []*model.Message{}
+	err := ds.walkMessages(ctx, startTime, endTime, talker, sender, keyword, cursor, want, true, func(message *model.Message) bool {
+		filteredMessages = append(filteredMessages, message)
+		return want == 0 || len(filteredMessages) < want
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 处理分页
+	if limit > 0 {
+		if offset >= len(filteredMessages) {
+			return []*model.Message{}, nil
+		}
+		end := offset + limit
+		if end > len(filteredMessages) {
+			end = len(filteredMessages)
+		}
+		return filteredMessages[offset:end], nil
+	}
+
+	return filteredMessages, nil
+}
+
+// WalkMessages 依次读取每个消息表中符合条件的消息，fn 返回 false 时停止，不保留已读取的消息
+// 同一聊天的消息按 Seq 顺序，不同聊天之间不保证顺序
+func (ds *DataSource) WalkMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, fn func(message *model.Message) bool) error {
+	return ds.walkMessages(ctx, startTime, endTime, talker, sender, keyword, nil, 0, false, fn)
+}
+
+// walkMessages 从游标之后按 Seq 顺序读取符合条件的消息并调用 fn，batch 为每个消息表首次读取的数量，<= 0 时使用默认值
+// ordered 为 false 时不归并，依次读取每个消息表，只保证同一消息表中的顺序
+func (ds *DataSource) walkMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, cursor *model.Cursor, batch int, ordered bool, fn func(message *model.Message) bool) error {
+	// 解析talker参数，支持多个talker（以英文逗号分隔），为空时查询所有聊天
+	talkers := util.Str2List(talker, ",")
 
 	// 找到时间范围内的数据库文件
 	dbInfos := ds.getDBInfosForTimeRange(startTime, endTime)
 	if len(dbInfos) == 0 {
-		return nil, errors.TimeRangeNotFound(startTime, endTime)
+		return errors.TimeRangeNotFound(startTime, endTime)
 	}
 
 	// 解析sender参数，支持多个发送者（以英文逗号分隔）
@@ -203,17 +273,58 @@ func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.T
 		var err error
 		regex, err = regexp.Compile(keyword)
 		if err != nil {
-			return nil, errors.QueryFailed("invalid regex pattern", err)
+			return errors.QueryFailed("invalid regex pattern", err)
 		}
 	}
 
-	// 从每个相关数据库中查询消息，并在读取时进行过滤
-	filteredMessages := []*model.Message{}
+	// 过滤消息，跳过游标之前和不符合条件的消息
+	match := func(message *model.Message) bool {
+		// 跳过游标之前的消息
+		if !cursor.Before(message) {
+			return false
+		}
+
+		// 应用sender过滤
+		if len(senders) > 0 {
+			senderMatch := false
+			for _, s := range senders {
+				if message.Sender == s {
+					senderMatch = true
+					break
+				}
+			}
+			if !senderMatch {
+				return false // 不匹配sender，跳过此消息
+			}
+		}
+
+		// 应用keyword过滤
+		if regex != nil {
+			plainText := message.PlainTextContent()
+			if !regex.MatchString(plainText) {
+				return false // 不匹配keyword，跳过此消息
+			}
+		}
+
+		return true
+	}
+
+	// 归并各消息表得到全局顺序，不需要时依次读取每个消息表
+	walk := msgmerge.Walk
+	if !ordered {
+		walk = msgmerge.WalkEach
+	}
 
+	// 数据库分片按时间先后排列，依次归并每个分片中各聊天的消息表
 	for _, dbInfo := range dbInfos {
 		// 检查上下文是否已取消
 		if err := ctx.Err(); err != nil {
-			return nil, err
+			return err
+		}
+
+		// 跳过游标之前的数据库分片
+		if cursor != nil && dbInfo.StartTime.Unix() < cursor.Shard {
+			continue
 		}
 
 		db, err := ds.dbm.OpenDB(dbInfo.FilePath)
@@ -222,141 +333,183 @@ func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.T
 			continue
 		}
 
-		// 对每个talker进行查询
+		// 未指定talker时查询数据库中所有聊天的消息表
+		tables := make(map[string]string)
+		if len(talkers) == 0 {
+			tables, err = ds.getMessageTables(ctx, db)
+			if err != nil {
+				return err
+			}
+		}
 		for _, talkerItem := range talkers {
 			// 构建表名
 			_talkerMd5Bytes := md5.Sum([]byte(talkerItem))
 			talkerMd5 := hex.EncodeToString(_talkerMd5Bytes[:])
-			tableName := "Msg_" + talkerMd5
+			tables["Msg_"+talkerMd5] = talkerItem
+		}
 
-			// 检查表是否存在
-			var exists bool
-			err = db.QueryRowContext(ctx,
-				"SELECT 1 FROM sqlite_master WHERE type='table' AND name=?",
-				tableName).Scan(&exists)
+		// 每个消息表按 sort_seq 分批读取，只读取当前页需要的消息
+		merged := make([]*msgmerge.Table, 0, len(tables))
+		for tableName, talkerItem := range tables {
+			filePath, tableName, talkerItem := dbInfo.FilePath, tableName, talkerItem
+			merged = append(merged, msgmerge.NewTable(func(ctx context.Context, from int64, n int) ([]*model.Message, error) {
+				return ds.queryMessageTable(ctx, filePath, tableName, talkerItem,
+					"m.create_time >= ? AND m.create_time <= ? AND m.sort_seq >= ?", "ASC", n,
+					startTime.Unix(), endTime.Unix(), from)
+			}, msgmerge.CursorFrom(cursor)))
+		}
 
-			if err != nil {
-				if err == sql.ErrNoRows {
-					// 表不存在，继续下一个talker
-					continue
-				}
-				return nil, errors.QueryFailed("", err)
+		stopped := false
+		err = walk(ctx, merged, batch, func(message *model.Message) bool {
+			if !match(message) {
+				return true
 			}
+			stopped = !fn(message)
+			return !stopped
+		})
+		if err != nil {
+			return err
+		}
+		if stopped {
+			break
+		}
+	}
 
-			// 构建查询条件
-			conditions := []string{"create_time >= ? AND create_time <= ?"}
-			args := []interface{}{startTime.Unix(), endTime.Unix()}
-			log.Debug().Msgf("Table name: %s", tableName)
-			log.Debug().Msgf("Start time: %d, End time: %d", startTime.Unix(), endTime.Unix())
-
-			query := fmt.Sprintf(`
-				SELECT m.sort_seq, m.server_id, m.local_type, n.user_name, m.create_time, m.message_content, m.packed_info_data, m.status
-				FROM %s m
-				LEFT JOIN Name2Id n ON m.real_sender_id = n.rowid
-				WHERE %s 
-				ORDER BY m.sort_seq ASC
-			`, tableName, strings.Join(conditions, " AND "))
-
-			// 执行查询
-			rows, err := db.QueryContext(ctx, query, args...)
-			if err != nil {
-				// 如果表不存在，SQLite 会返回错误
-				if strings.Contains(err.Error(), "no such table") {
-					continue
-				}
-				log.Err(err).Msgf("从数据库 %s 查询消息失败", dbInfo.FilePath)
-				continue
-			}
+	return nil
+}
 
-			// 处理查询结果，在读取时进行过滤
-			for rows.Next() {
-				var msg model.MessageV4
-				err := rows.Scan(
-					&msg.SortSeq,
-					&msg.ServerID,
-					&msg.LocalType,
-					&msg.UserName,
-					&msg.CreateTime,
-					&msg.MessageContent,
-					&msg.PackedInfoData,
-					&msg.Status,
-				)
-				if err != nil {
-					rows.Close()
-					return nil, errors.ScanRowFailed(err)
-				}
+// GetMessageContext 获取聊天中指定消息前后的消息，按 Seq 升序排列
+// 结果包含 Seq 对应的消息 (存在时)，前后的消息可能分布在多个数据库分片中
+func (ds *DataSource) GetMessageContext(ctx context.Context, talker string, seq int64, before, after int) ([]*model.Message, error) {
+	if talker == "" {
+		return nil, errors.ErrTalkerEmpty
+	}
+	_talkerMd5Bytes := md5.Sum([]byte(talker))
+	tableName := "Msg_" + hex.EncodeToString(_talkerMd5Bytes[:])
 
-				// 将消息转换为标准格式
-				message := msg.Wrap(talkerItem)
-
-				// 应用sender过滤
-				if len(senders) > 0 {
-					senderMatch := false
-					for _, s := range senders {
-						if message.Sender == s {
-							senderMatch = true
-							break
-						}
-					}
-					if !senderMatch {
-						continue // 不匹配sender，跳过此消息
-					}
-				}
+	infos := ds.messageInfos
+	t := time.Unix(seq/1000, 0)
 
-				// 应用keyword过滤
-				if regex != nil {
-					plainText := message.PlainTextContent()
-					if !regex.MatchString(plainText) {
-						continue // 不匹配keyword，跳过此消息
-					}
-				}
+	// 向前查找，从可能包含该消息的最后一个分片开始，多取一条用于包含 Seq 对应的消息
+	prev := make([]*model.Message, 0, before+1)
+	start := len(infos) - 1
+	for start > 0 && infos[start].StartTime.After(t) {
+		start--
+	}
+	for i := start; i >= 0 && len(prev) < before+1; i-- {
+		messages, err := ds.queryMessageTable(ctx, infos[i].FilePath, tableName, talker, "m.sort_seq <= ?", "DESC", before+1-len(prev), seq)
+		if err != nil {
+			return nil, err
+		}
+		prev = append(prev, messages...)
+	}
+	if len(prev) > 0 && prev[0].Seq != seq && len(prev) > before {
+		prev = prev[:before]
+	}
 
-				// 通过所有过滤条件，保留此消息
-				filteredMessages = append(filteredMessages, message)
+	// 向后查找，从可能包含该消息的第一个分片开始
+	next := make([]*model.Message, 0, after)
+	for i := ds.getShard(t); i >= 0 && i < len(infos) && len(next) < after; i++ {
+		messages, err := ds.queryMessageTable(ctx, infos[i].FilePath, tableName, talker, "m.sort_seq > ?", "ASC", after-len(next), seq)
+		if err != nil {
+			return nil, err
+		}
+		next = append(next, messages...)
+	}
 
-				// 检查是否已经满足分页处理数量
-				if limit > 0 && len(filteredMessages) >= offset+limit {
-					// 已经获取了足够的消息，可以提前返回
-					rows.Close()
+	result := make([]*model.Message, 0, len(prev)+len(next))
+	for i := len(prev) - 1; i >= 0; i-- {
+		result = append(result, prev[i])
+	}
+	return append(result, next...), nil
+}
 
-					// 对所有消息按时间排序
-					sort.Slice(filteredMessages, func(i, j int) bool {
-						return filteredMessages[i].Seq < filteredMessages[j].Seq
-					})
+// queryMessageTable 按条件查询单个数据库中一个聊天的消息，表不存在时返回空结果
+func (ds *DataSource) queryMessageTable(ctx context.Context, filePath, tableName, talker string, condition string, order string, limit int, args ...interface{}) ([]*model.Message, error) {
+	db, err := ds.dbm.OpenDB(filePath)
+	if err != nil {
+		log.Error().Msgf("数据库 %s 未打开", filePath)
+		return nil, nil
+	}
 
-					// 处理分页
-					if offset >= len(filteredMessages) {
-						return []*model.Message{}, nil
-					}
-					end := offset + limit
-					if end > len(filteredMessages) {
-						end = len(filteredMessages)
-					}
-					return filteredMessages[offset:end], nil
-				}
-			}
+	query := fmt.Sprintf(`
+		SELECT m.sort_seq, m.server_id, m.local_type, n.user_name, m.create_time, m.message_content, m.packed_info_data, m.status
+		FROM %s m
+		LEFT JOIN Name2Id n ON m.real_sender_id = n.rowid
+		WHERE %s
+		ORDER BY m.sort_seq %s
+		LIMIT %d
+	`, tableName, condition, order, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return nil, nil
+		}
+		return nil, errors.QueryFailed(query, err)
+	}
+	defer rows.Close()
+
+	messages := make([]*model.Message, 0, limit)
+	for rows.Next() {
+		var msg model.MessageV4
+		err := rows.Scan(
+			&msg.SortSeq,
+			&msg.ServerID,
+			&msg.LocalType,
+			&msg.UserName,
+			&msg.CreateTime,
+			&msg.MessageContent,
+			&msg.PackedInfoData,
+			&msg.Status,
+		)
+		if err != nil {
+			return nil, errors.ScanRowFailed(err)
+		}
+		messages = append(messages, msg.Wrap(talker))
+	}
+	return messages, nil
+}
+
+// getMessageTables 获取数据库中所有聊天的消息表，返回表名到talker的映射
+// 消息表名为 Msg_ 加 talker 的 md5，通过 Name2Id 中的用户名还原 talker
+func (ds *DataSource) getMessageTables(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	md5ToTalker := make(map[string]string)
+	rows, err := db.QueryContext(ctx, "SELECT user_name FROM Name2Id")
+	if err != nil {
+		return nil, errors.QueryFailed("", err)
+	}
+	for rows.Next() {
+		var userName string
+		if err := rows.Scan(&userName); err != nil {
 			rows.Close()
+			return nil, errors.ScanRowFailed(err)
 		}
+		_md5Bytes := md5.Sum([]byte(userName))
+		md5ToTalker[hex.EncodeToString(_md5Bytes[:])] = userName
 	}
+	rows.Close()
 
-	// 对所有消息按时间排序
-	sort.Slice(filteredMessages, func(i, j int) bool {
-		return filteredMessages[i].Seq < filteredMessages[j].Seq
-	})
+	rows, err = db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type='table' AND name LIKE 'Msg_%'")
+	if err != nil {
+		return nil, errors.QueryFailed("", err)
+	}
+	defer rows.Close()
 
-	// 处理分页
-	if limit > 0 {
-		if offset >= len(filteredMessages) {
-			return []*model.Message{}, nil
+	tables := make(map[string]string)
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, errors.ScanRowFailed(err)
 		}
-		end := offset + limit
-		if end > len(filteredMessages) {
-			end = len(filteredMessages)
+		talker, ok := md5ToTalker[strings.TrimPrefix(tableName, "Msg_")]
+		if !ok {
+			log.Debug().Msgf("未找到消息表 %s 对应的talker", tableName)
+			continue
 		}
-		return filteredMessages[offset:end], nil
+		tables[tableName] = talker
 	}
-
-	return filteredMessages, nil
+	return tables, nil
 }
 
 // 联系人
@@ -366,13 +519,16 @@ func (ds *DataSource) GetContacts(ctx context.Context, key string, limit, offset
 
 	if key != "" {
 		// 按照关键字查询
-		query = `SELECT username, local_type, alias, remark, nick_name 
+		query = `SELECT username, local_type, alias, remark, nick_name,
+				IFNULL(quan_pin,''), IFNULL(pin_yin_initial,''), IFNULL(remark_quan_pin,''), IFNULL(remark_pin_yin_initial,'')
 				FROM contact 
 				WHERE username = ? OR alias = ? OR remark = ? OR nick_name = ?`
 		args = []interface{}{key, key, key, key}
 	} else {
 		// 查询所有联系人
-		query = `SELECT username, local_type, alias, remark, nick_name FROM contact`
+		query = `SELECT username, local_type, alias, remark, nick_name,
+				IFNULL(quan_pin,''), IFNULL(pin_yin_initial,''), IFNULL(remark_quan_pin,''), IFNULL(remark_pin_yin_initial,'')
+				FROM contact`
 	}
 
 	// 添加排序、分页
@@ -404,6 +560,10 @@ func (ds *DataSource) GetContacts(ctx context.Context, key string, limit, offset
 			&contactV4.Alias,
 			&contactV4.Remark,
 			&contactV4.NickName,
+			&contactV4.QuanPin,
+			&contactV4.PinYinInitial,
+			&contactV4.RemarkQuanPin,
+			&contactV4.RemarkPinYinInitial,
 		)
 
 		if err != nil {
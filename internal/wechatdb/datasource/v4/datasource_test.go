@@ -0,0 +1,181 @@
+package v4
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// testMessage 写入测试消息表的一条消息
+type testMessage struct {
+	talker  string
+	sender  string
+	seq     int64
+	content string
+}
+
+// newTestDataSource 在临时目录中创建只有一个消息数据库的数据目录
+func newTestDataSource(t *testing.T, start time.Time, messages []testMessage) *DataSource {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "message_0.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("CREATE TABLE Timestamp (timestamp INTEGER)")
+	exec("INSERT INTO Timestamp VALUES (?)", start.Unix())
+	exec("CREATE TABLE Name2Id (user_name TEXT)")
+
+	senderIDs := make(map[string]int64)
+	tables := make(map[string]bool)
+	for _, m := range messages {
+		for _, name := range []string{m.talker, m.sender} {
+			if _, ok := senderIDs[name]; ok {
+				continue
+			}
+			res, err := db.Exec("INSERT INTO Name2Id (user_name) VALUES (?)", name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			senderIDs[name], _ = res.LastInsertId()
+		}
+
+		sum := md5.Sum([]byte(m.talker))
+		table := "Msg_" + hex.EncodeToString(sum[:])
+		if !tables[table] {
+			exec(fmt.Sprintf(`CREATE TABLE %s (local_id INTEGER PRIMARY KEY, server_id INTEGER, local_type INTEGER,
+				sort_seq INTEGER, real_sender_id INTEGER, create_time INTEGER, status INTEGER,
+				message_content TEXT, packed_info_data BLOB)`, table))
+			tables[table] = true
+		}
+		exec(fmt.Sprintf(`INSERT INTO %s (server_id, local_type, sort_seq, real_sender_id, create_time, status, message_content)
+			VALUES (?, 1, ?, ?, ?, 0, ?)`, table), m.seq, m.seq, senderIDs[m.sender], m.seq/1000, m.content)
+	}
+
+	ds, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ds.Close() })
+	return ds
+}
+
+func seqs(messages []*model.Message) []int64 {
+	s := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		s = append(s, m.Seq)
+	}
+	return s
+}
+
+func TestGetMessages(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	base := start.Unix() * 1000
+	var messages []testMessage
+	for i := int64(0); i < 30; i++ {
+		// 两个聊天的消息交错
+		talker := "wxid_a"
+		if i%3 == 0 {
+			talker = "wxid_b"
+		}
+		messages = append(messages, testMessage{talker: talker, sender: talker, seq: base + i*1000, content: fmt.Sprintf("message %d", i)})
+	}
+	ds := newTestDataSource(t, start, messages)
+	ctx := context.Background()
+	end := start.Add(time.Hour)
+
+	all, err := ds.GetMessages(ctx, start, end, "", "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(messages) {
+		t.Fatalf("GetMessages() = %d messages, want %d", len(all), len(messages))
+	}
+	for i, m := range all {
+		if m.Seq != messages[i].seq || m.Talker != messages[i].talker {
+			t.Fatalf("message %d = %d %s, want %d %s", i, m.Seq, m.Talker, messages[i].seq, messages[i].talker)
+		}
+	}
+
+	page, err := ds.GetMessages(ctx, start, end, "wxid_a,wxid_b", "", "", 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(seqs(page)), fmt.Sprint(seqs(all[10:15])); got != want {
+		t.Errorf("GetMessages(limit 5, offset 10) = %s, want %s", got, want)
+	}
+
+	filtered, err := ds.GetMessages(ctx, start, end, "", "wxid_b", "message 1", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wxid_b 的消息序号为 3 的倍数，其中匹配 "message 1" 的为 12、15、18
+	if got := fmt.Sprint(seqs(filtered)); got != fmt.Sprint([]int64{base + 12000, base + 15000, base + 18000}) {
+		t.Errorf("GetMessages(sender, keyword) = %s", got)
+	}
+
+	// 游标分页读取的消息与一次读取的结果一致
+	var paged []*model.Message
+	var cursor *model.Cursor
+	for {
+		items, next, err := ds.GetMessagesByCursor(ctx, start, end, "", "", "", cursor, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, items...)
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if got, want := fmt.Sprint(seqs(paged)), fmt.Sprint(seqs(all)); got != want {
+		t.Errorf("GetMessagesByCursor() = %s, want %s", got, want)
+	}
+
+	n := 0
+	err = ds.WalkMessages(ctx, start, end, "wxid_a", "", "", func(m *model.Message) bool {
+		n++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 {
+		t.Errorf("WalkMessages() visited %d messages, want 20", n)
+	}
+
+	// 未指定talker时依次读取每个消息表，同一聊天内保持 Seq 顺序
+	last := make(map[string]int64)
+	n = 0
+	err = ds.WalkMessages(ctx, start, end, "", "", "", func(m *model.Message) bool {
+		if m.Seq <= last[m.Talker] {
+			t.Errorf("WalkMessages() %s: seq %d after %d", m.Talker, m.Seq, last[m.Talker])
+		}
+		last[m.Talker] = m.Seq
+		n++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(messages) {
+		t.Errorf("WalkMessages() visited %d messages, want %d", n, len(messages))
+	}
+}
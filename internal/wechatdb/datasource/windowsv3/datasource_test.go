@@ -0,0 +1,102 @@
+package windowsv3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+func TestGetMessages(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	base := start.Unix() * 1000
+
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "MSG0.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("CREATE TABLE DBInfo (tableIndex INTEGER, tableVersion INTEGER, tableDesc TEXT)")
+	exec("INSERT INTO DBInfo VALUES (0, ?, 'Start Time')", base)
+	exec("CREATE TABLE Name2ID (UsrName TEXT)")
+	exec("INSERT INTO Name2ID VALUES ('wxid_a'), ('wxid_b')")
+	exec(`CREATE TABLE MSG (localId INTEGER PRIMARY KEY, TalkerId INTEGER, MsgSvrID INTEGER, Type INTEGER, SubType INTEGER,
+		IsSender INTEGER, CreateTime INTEGER, Sequence INTEGER, StrTalker TEXT, StrContent TEXT,
+		CompressContent BLOB, BytesExtra BLOB)`)
+
+	// 两个聊天的消息交错
+	var want []string
+	for i := int64(0); i < 30; i++ {
+		talker, talkerID := "wxid_a", 1
+		if i%3 == 0 {
+			talker, talkerID = "wxid_b", 2
+		}
+		seq := base + i*1000
+		exec(`INSERT INTO MSG (TalkerId, MsgSvrID, Type, SubType, IsSender, CreateTime, Sequence, StrTalker, StrContent)
+			VALUES (?, ?, 1, 0, 0, ?, ?, ?, ?)`, talkerID, seq, seq/1000, seq, talker, fmt.Sprintf("message %d", i))
+		want = append(want, fmt.Sprintf("%d %s", seq, talker))
+	}
+	db.Close()
+
+	ds, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	ctx := context.Background()
+	end := start.Add(time.Hour)
+
+	format := func(messages []*model.Message) string {
+		s := make([]string, 0, len(messages))
+		for _, m := range messages {
+			s = append(s, fmt.Sprintf("%d %s", m.Seq, m.Talker))
+		}
+		return fmt.Sprint(s)
+	}
+
+	all, err := ds.GetMessages(ctx, start, end, "", "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(all); got != fmt.Sprint(want) {
+		t.Fatalf("GetMessages() = %s, want %s", got, fmt.Sprint(want))
+	}
+
+	page, err := ds.GetMessages(ctx, start, end, "wxid_a,wxid_b", "", "", 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(page); got != fmt.Sprint(want[10:15]) {
+		t.Errorf("GetMessages(limit 5, offset 10) = %s, want %s", got, fmt.Sprint(want[10:15]))
+	}
+
+	// 游标分页读取的消息与一次读取的结果一致
+	var paged []*model.Message
+	var cursor *model.Cursor
+	for {
+		items, next, err := ds.GetMessagesByCursor(ctx, start, end, "", "", "message", cursor, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, items...)
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if got := format(paged); got != fmt.Sprint(want) {
+		t.Errorf("GetMessagesByCursor() = %s, want %s", got, fmt.Sprint(want))
+	}
+}
@@ -0,0 +1,421 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 全文索引
+// 索引数据库由 chatlog 维护，存放在工作目录中，与解密后的数据库互不影响
+// 依赖 SQLite FTS5 扩展，需要使用 sqlite_fts5 build tag 编译
+
+const (
+	// IndexFile 索引数据库文件名
+	IndexFile = "chatlog_index.db"
+
+	// Version 索引结构版本，版本不一致时重建索引
+	Version = "1"
+
+	// SnippetLength 摘要的最大长度 (字符数)
+	SnippetLength = 64
+
+	SnippetStart = "【"
+	SnippetEnd   = "】"
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS talker (
+		talker TEXT PRIMARY KEY,
+		last_time INTEGER NOT NULL,
+		last_seq INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS message (
+		id INTEGER PRIMARY KEY,
+		talker TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		time INTEGER NOT NULL,
+		sender TEXT NOT NULL,
+		is_self INTEGER NOT NULL,
+		is_chatroom INTEGER NOT NULL,
+		type INTEGER NOT NULL,
+		sub_type INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		UNIQUE (talker, seq)
+	)`,
+	`CREATE INDEX IF NOT EXISTS message_time ON message (time)`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS message_fts USING fts5 (tokens, content='', tokenize='unicode61 remove_diacritics 2')`,
+}
+
+var dropSchema = []string{
+	`DROP TABLE IF EXISTS message_fts`,
+	`DROP TABLE IF EXISTS message`,
+	`DROP TABLE IF EXISTS talker`,
+	`DROP TABLE IF EXISTS meta`,
+}
+
+type Index struct {
+	path string
+	db   *sql.DB
+
+	// 索引是否已完成首次构建
+	ready bool
+	mu    sync.RWMutex
+}
+
+// TalkerState 记录每个对话已索引到的位置，用于增量更新
+type TalkerState struct {
+	LastTime time.Time
+	LastSeq  int64
+}
+
+// Query 检索条件
+type Query struct {
+	Keyword string
+	Talkers []string
+	Senders []string
+	Start   time.Time
+	End     time.Time
+	Limit   int
+	Offset  int
+
+	// OrderBySeq 按消息顺序排列，否则按相关度排列
+	OrderBySeq bool
+
+	// After 仅返回游标之后的消息，需要与 OrderBySeq 一起使用
+	After *model.Cursor
+}
+
+// Hit 检索结果
+// 索引中只保存了用于检索和展示摘要的字段，完整的消息需要从数据源获取
+type Hit struct {
+	Talker     string
+	Seq        int64
+	Time       time.Time
+	Sender     string
+	IsSelf     bool
+	IsChatRoom bool
+	Type       int64
+	SubType    int64
+	Content    string
+	Score      float64
+	Snippet    string
+}
+
+// Message 将检索结果转换为消息，仅包含索引中保存的字段
+func (h *Hit) Message() *model.Message {
+	return &model.Message{
+		Seq:        h.Seq,
+		Time:       h.Time,
+		Talker:     h.Talker,
+		IsChatRoom: h.IsChatRoom,
+		Sender:     h.Sender,
+		IsSelf:     h.IsSelf,
+		Type:       h.Type,
+		SubType:    h.SubType,
+		Content:    h.Content,
+	}
+}
+
+// Open 打开工作目录中的索引数据库，不存在时创建
+func Open(workDir string) (*Index, error) {
+	path := filepath.Join(workDir, IndexFile)
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, errors.DBConnectFailed(path, err)
+	}
+	// 写入集中在后台构建任务中，单连接避免 database is locked
+	db.SetMaxOpenConns(1)
+
+	idx := &Index{
+		path: path,
+		db:   db,
+	}
+	if err := idx.init(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+func (idx *Index) init() error {
+	var version string
+	err := idx.db.QueryRow("SELECT value FROM meta WHERE key = 'version'").Scan(&version)
+	if err != nil || version != Version {
+		for _, stmt := range dropSchema {
+			if _, err := idx.db.Exec(stmt); err != nil {
+				return errors.IndexInitFailed(err)
+			}
+		}
+	}
+
+	for _, stmt := range schema {
+		if _, err := idx.db.Exec(stmt); err != nil {
+			return errors.IndexInitFailed(err)
+		}
+	}
+
+	if _, err := idx.db.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('version', ?)", Version); err != nil {
+		return errors.IndexInitFailed(err)
+	}
+
+	var ready string
+	if err := idx.db.QueryRow("SELECT value FROM meta WHERE key = 'ready'").Scan(&ready); err == nil {
+		idx.ready = ready == "1"
+	}
+	return nil
+}
+
+// Ready 索引是否已完成首次构建，未完成时检索结果不完整
+func (idx *Index) Ready() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.ready
+}
+
+// SetReady 标记索引已完成首次构建
+func (idx *Index) SetReady() error {
+	if _, err := idx.db.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('ready', '1')"); err != nil {
+		return errors.QueryFailed("", err)
+	}
+	idx.mu.Lock()
+	idx.ready = true
+	idx.mu.Unlock()
+	return nil
+}
+
+// State 获取对话已索引到的位置
+func (idx *Index) State(ctx context.Context, talker string) (*TalkerState, error) {
+	var lastTime, lastSeq int64
+	err := idx.db.QueryRowContext(ctx, "SELECT last_time, last_seq FROM talker WHERE talker = ?", talker).Scan(&lastTime, &lastSeq)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.QueryFailed("", err)
+	}
+	return &TalkerState{LastTime: time.Unix(lastTime, 0), LastSeq: lastSeq}, nil
+}
+
+// Add 将一个对话中的新消息写入索引，并更新该对话已索引到的位置
+// messages 需要按 Seq 升序排列
+func (idx *Index) Add(ctx context.Context, talker string, messages []*model.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	tx, err := idx.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.QueryFailed("", err)
+	}
+	defer tx.Rollback()
+
+	insertMsg, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO message
+		(talker, seq, time, sender, is_self, is_chatroom, type, sub_type, content)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return errors.QueryFailed("", err)
+	}
+	defer insertMsg.Close()
+
+	insertFTS, err := tx.PrepareContext(ctx, "INSERT INTO message_fts (rowid, tokens) VALUES (?, ?)")
+	if err != nil {
+		return errors.QueryFailed("", err)
+	}
+	defer insertFTS.Close()
+
+	for _, m := range messages {
+		if !Indexable(m) {
+			continue
+		}
+		content := m.PlainTextContent()
+		tokens := Tokenize(content)
+		if len(tokens) == 0 {
+			continue
+		}
+		res, err := insertMsg.ExecContext(ctx, talker, m.Seq, m.Time.Unix(), m.Sender, m.IsSelf, m.IsChatRoom, m.Type, m.SubType, content)
+		if err != nil {
+			return errors.QueryFailed("", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return errors.QueryFailed("", err)
+		}
+		if _, err := insertFTS.ExecContext(ctx, id, strings.Join(tokens, " ")); err != nil {
+			return errors.QueryFailed("", err)
+		}
+	}
+
+	last := messages[len(messages)-1]
+	if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO talker (talker, last_time, last_seq) VALUES (?, ?, ?)",
+		talker, last.Time.Unix(), last.Seq); err != nil {
+		return errors.QueryFailed("", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.QueryFailed("", err)
+	}
+	return nil
+}
+
+// Search 检索消息，返回当前页的结果和符合条件的结果总数
+func (idx *Index) Search(ctx context.Context, q *Query) ([]*Hit, int, error) {
+	match := MatchQuery(q.Keyword)
+	if match == "" {
+		return nil, 0, errors.ErrKeywordEmpty
+	}
+
+	conditions := []string{"message_fts MATCH ?"}
+	args := []interface{}{match}
+	if !q.Start.IsZero() {
+		conditions = append(conditions, "m.time >= ?")
+		args = append(args, q.Start.Unix())
+	}
+	if !q.End.IsZero() {
+		conditions = append(conditions, "m.time <= ?")
+		args = append(args, q.End.Unix())
+	}
+	if len(q.Talkers) > 0 {
+		conditions = append(conditions, fmt.Sprintf("m.talker IN (%s)", placeholders(len(q.Talkers))))
+		for _, t := range q.Talkers {
+			args = append(args, t)
+		}
+	}
+	if q.After != nil {
+		conditions = append(conditions, "(m.seq > ? OR (m.seq = ? AND m.talker > ?))")
+		args = append(args, q.After.Seq, q.After.Seq, q.After.Talker)
+	}
+	if len(q.Senders) > 0 {
+		conditions = append(conditions, fmt.Sprintf("m.sender IN (%s)", placeholders(len(q.Senders))))
+		for _, s := range q.Senders {
+			args = append(args, s)
+		}
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM message_fts JOIN message m ON m.id = message_fts.rowid WHERE %s`, where)
+	if err := idx.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, errors.QueryFailed(countQuery, err)
+	}
+
+	order := "score ASC, m.seq DESC"
+	if q.OrderBySeq {
+		order = "m.seq ASC, m.talker ASC"
+	}
+	query := fmt.Sprintf(`
+		SELECT m.talker, m.seq, m.time, m.sender, m.is_self, m.is_chatroom, m.type, m.sub_type, m.content, bm25(message_fts) AS score
+		FROM message_fts JOIN message m ON m.id = message_fts.rowid
+		WHERE %s
+		ORDER BY %s`, where, order)
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", q.Limit, q.Offset)
+	}
+
+	rows, err := idx.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.QueryFailed(query, err)
+	}
+	defer rows.Close()
+
+	terms := Terms(q.Keyword)
+	hits := make([]*Hit, 0)
+	for rows.Next() {
+		var h Hit
+		var t int64
+		if err := rows.Scan(&h.Talker, &h.Seq, &t, &h.Sender, &h.IsSelf, &h.IsChatRoom, &h.Type, &h.SubType, &h.Content, &h.Score); err != nil {
+			return nil, 0, errors.ScanRowFailed(err)
+		}
+		h.Time = time.Unix(t, 0)
+		// bm25 越小越相关，取反后分数越大越相关
+		h.Score = -h.Score
+		h.Snippet = Snippet(h.Content, terms, SnippetLength)
+		hits = append(hits, &h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.ScanRowFailed(err)
+	}
+
+	return hits, total, nil
+}
+
+func (idx *Index) Close() error {
+	return idx.db.Close()
+}
+
+// Snippet 截取内容中第一个匹配关键词附近的片段，匹配部分使用【】标记
+func Snippet(content string, terms []string, length int) string {
+	content = strings.ReplaceAll(content, "\n", " ")
+	lower := strings.ToLower(content)
+
+	pos, matchLen := -1, 0
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 && (pos < 0 || i < pos) {
+			pos, matchLen = i, len(term)
+		}
+	}
+	if pos < 0 || len(lower) != len(content) {
+		// 未找到完全一致的片段，或大小写转换改变了长度，直接截取开头
+		return truncate(content, 0, length)
+	}
+
+	// 以匹配位置为中心截取
+	before := (length - utf8.RuneCountInString(content[pos:pos+matchLen])) / 2
+	start := pos
+	for i := 0; i < before && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(content[:start])
+		start -= size
+	}
+
+	marked := content[:pos] + SnippetStart + content[pos:pos+matchLen] + SnippetEnd + content[pos+matchLen:]
+	return truncate(marked, start, length+utf8.RuneCountInString(SnippetStart+SnippetEnd))
+}
+
+// truncate 从 start 字节处截取 length 个字符，被截断的一侧使用 ... 表示
+func truncate(s string, start int, length int) string {
+	end := start
+	for i := 0; i < length && end < len(s); i++ {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		end += size
+	}
+	result := s[start:end]
+	if start > 0 {
+		result = "..." + result
+	}
+	if end < len(s) {
+		result += "..."
+	}
+	return result
+}
+
+// Indexable 是否为需要索引的消息
+// 图片、语音、视频等消息的文本内容只有媒体链接，不写入索引
+func Indexable(m *model.Message) bool {
+	switch m.Type {
+	case 1, 49, 10000:
+		return true
+	default:
+		return false
+	}
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
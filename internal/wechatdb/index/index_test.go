@@ -0,0 +1,148 @@
+//go:build sqlite_fts5
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+func testMessages(talker string, base time.Time, contents ...string) []*model.Message {
+	messages := make([]*model.Message, 0, len(contents))
+	for i, content := range contents {
+		t := base.Add(time.Duration(i) * time.Second)
+		messages = append(messages, &model.Message{
+			Seq:     t.Unix()*1000 + int64(i),
+			Time:    t,
+			Talker:  talker,
+			Sender:  talker,
+			Type:    1,
+			Content: content,
+		})
+	}
+	return messages
+}
+
+func hitSeqs(hits []*Hit) string {
+	s := make([]string, 0, len(hits))
+	for _, h := range hits {
+		s = append(s, fmt.Sprintf("%s/%d", h.Talker, h.Seq))
+	}
+	return fmt.Sprint(s)
+}
+
+func TestIndex(t *testing.T) {
+	idx, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+
+	a := testMessages("wxid_a", base, "明天讨论项目进度", "晚饭吃什么", "项目进度已更新 release notes")
+	b := testMessages("wxid_b", base.Add(time.Minute), "项目的进度怎么样", "Release 计划")
+	// 图片消息不写入索引
+	a = append(a, &model.Message{Seq: a[2].Seq + 1, Time: a[2].Time, Talker: "wxid_a", Type: 3})
+
+	if err := idx.Add(ctx, "wxid_a", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Add(ctx, "wxid_b", b); err != nil {
+		t.Fatal(err)
+	}
+	// 重复写入的消息被忽略
+	if err := idx.Add(ctx, "wxid_a", a[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := idx.State(ctx, "wxid_b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.LastSeq != b[1].Seq || !state.LastTime.Equal(b[1].Time) {
+		t.Errorf("State(wxid_b) = %+v, want last seq %d", state, b[1].Seq)
+	}
+	if state, _ := idx.State(ctx, "wxid_c"); state != nil {
+		t.Errorf("State(wxid_c) = %+v, want nil", state)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []*model.Message
+		total int
+	}{
+		{name: "han phrase", query: Query{Keyword: "项目进度", OrderBySeq: true}, want: []*model.Message{a[0], a[2]}, total: 2},
+		{name: "case insensitive", query: Query{Keyword: "release", OrderBySeq: true}, want: []*model.Message{a[2], b[1]}, total: 2},
+		{name: "all terms", query: Query{Keyword: "项目 release", OrderBySeq: true}, want: []*model.Message{a[2]}, total: 1},
+		{name: "talker", query: Query{Keyword: "进度", Talkers: []string{"wxid_b"}}, want: []*model.Message{b[0]}, total: 1},
+		{name: "time range", query: Query{Keyword: "进度", Start: base.Add(time.Second), End: base.Add(time.Hour), OrderBySeq: true}, want: []*model.Message{a[2], b[0]}, total: 2},
+		{name: "page", query: Query{Keyword: "进度", OrderBySeq: true, Limit: 1, Offset: 1}, want: []*model.Message{a[2]}, total: 3},
+		{name: "after cursor", query: Query{Keyword: "进度", OrderBySeq: true, After: model.NewCursor(a[2], 0)}, want: []*model.Message{b[0]}, total: 1},
+		{name: "no match", query: Query{Keyword: "周末"}, want: []*model.Message{}, total: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, total, err := idx.Search(ctx, &tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make([]*Hit, 0, len(tt.want))
+			for _, m := range tt.want {
+				want = append(want, &Hit{Talker: m.Talker, Seq: m.Seq})
+			}
+			if got := hitSeqs(hits); got != hitSeqs(want) {
+				t.Errorf("Search() = %s, want %s", got, hitSeqs(want))
+			}
+			if total != tt.total {
+				t.Errorf("Search() total = %d, want %d", total, tt.total)
+			}
+		})
+	}
+
+	hits, _, err := idx.Search(ctx, &Query{Keyword: "release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hits {
+		if h.Score <= 0 {
+			t.Errorf("hit %s/%d score = %f, want > 0", h.Talker, h.Seq, h.Score)
+		}
+		if h.Snippet == h.Content {
+			t.Errorf("hit %s/%d snippet not marked: %q", h.Talker, h.Seq, h.Snippet)
+		}
+	}
+
+	if _, _, err := idx.Search(ctx, &Query{Keyword: "  "}); err == nil {
+		t.Error("Search() with empty keyword succeeded, want error")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		terms   []string
+		length  int
+		want    string
+	}{
+		{name: "mark match", content: "明天讨论项目进度", terms: []string{"项目"}, length: 64, want: "明天讨论【项目】进度"},
+		{name: "first match", content: "进度和项目", terms: []string{"项目", "进度"}, length: 64, want: "【进度】和项目"},
+		{name: "ignore case", content: "New Release", terms: []string{"release"}, length: 64, want: "New 【Release】"},
+		{name: "center on match", content: "一二三四五六七八九十项目一二三四五六七八九十", terms: []string{"项目"}, length: 6, want: "...九十【项目】一二..."},
+		{name: "newline", content: "第一行\n项目", terms: []string{"项目"}, length: 64, want: "第一行 【项目】"},
+		{name: "no match", content: "一二三四五六", terms: []string{"项目"}, length: 4, want: "一二三四..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Snippet(tt.content, tt.terms, tt.length); got != tt.want {
+				t.Errorf("Snippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
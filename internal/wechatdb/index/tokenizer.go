@@ -0,0 +1,92 @@
+package index
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize 将文本切分为索引词
+// FTS5 自带的 unicode61 分词器会把连续的中文视为一个词，无法检索其中的片段，
+// 因此在写入索引前先完成分词，再以空格分隔交给 unicode61：
+//   - 中文、日文、韩文按相邻两个字切分 (bigram)，每段连续文字的最后一个字单独作为一个词
+//   - 字母和数字按单词切分，统一转为小写
+//   - 其余字符视为分隔符
+//
+// 例如 "明天review项目进度" 切分为 [明天 天 review 项目 目进 进度 度]
+func Tokenize(text string) []string {
+	tokens := make([]string, 0, len(text)/2)
+
+	var run []rune
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		for i := 0; i < len(run)-1; i++ {
+			tokens = append(tokens, string(run[i:i+2]))
+		}
+		tokens = append(tokens, string(run[len(run)-1]))
+		run = run[:0]
+	}
+
+	var word strings.Builder
+	flushWord := func() {
+		if word.Len() == 0 {
+			return
+		}
+		tokens = append(tokens, word.String())
+		word.Reset()
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			run = append(run, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flush()
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flush()
+			flushWord()
+		}
+	}
+	flush()
+	flushWord()
+
+	return tokens
+}
+
+// MatchQuery 将关键词转换为 FTS5 查询语句
+// 关键词以空白字符分隔，各部分之间为 AND 关系，每部分按 Tokenize 切分后作为短语查询
+// 短语的最后一个词使用前缀查询：以单个汉字结尾时，该字在原文中可能与后面的字组成了 bigram；
+// 以单词结尾时，可以匹配原文中更长的单词，与原有的子串匹配行为保持一致
+// 关键词中没有可检索的内容时返回空字符串
+func MatchQuery(keyword string) string {
+	phrases := make([]string, 0)
+	for _, term := range strings.Fields(keyword) {
+		tokens := Tokenize(term)
+		if len(tokens) == 0 {
+			continue
+		}
+		phrases = append(phrases, `"`+strings.Join(tokens, " ")+`"*`)
+	}
+	return strings.Join(phrases, " AND ")
+}
+
+// Terms 返回关键词中可检索的部分，用于生成摘要
+func Terms(keyword string) []string {
+	terms := make([]string, 0)
+	for _, term := range strings.Fields(keyword) {
+		if len(Tokenize(term)) > 0 {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
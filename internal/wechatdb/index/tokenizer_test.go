@@ -0,0 +1,91 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "empty string",
+			input: "",
+			want:  []string{},
+		},
+		{
+			name:  "single han",
+			input: "好",
+			want:  []string{"好"},
+		},
+		{
+			name:  "han run",
+			input: "项目进度",
+			want:  []string{"项目", "目进", "进度", "度"},
+		},
+		{
+			name:  "mixed",
+			input: "明天review项目进度",
+			want:  []string{"明天", "天", "review", "项目", "目进", "进度", "度"},
+		},
+		{
+			name:  "lowercase and separators",
+			input: "Hello, World! v2.0",
+			want:  []string{"hello", "world", "v2", "0"},
+		},
+		{
+			name:  "punctuation splits han runs",
+			input: "你好，世界",
+			want:  []string{"你好", "好", "世界", "界"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Tokenize(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "empty string",
+			input: "  ",
+			want:  "",
+		},
+		{
+			name:  "han",
+			input: "项目",
+			want:  `"项目 目"*`,
+		},
+		{
+			name:  "multiple terms",
+			input: "合同 Contract",
+			want:  `"合同 同"* AND "contract"*`,
+		},
+		{
+			name:  "punctuation only term is ignored",
+			input: "合同 ，",
+			want:  `"合同 同"*`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchQuery(tt.input); got != tt.want {
+				t.Errorf("MatchQuery(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,9 +4,18 @@ import (
 	"context"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// selfSearchPages、selfSearchPageSize 查找自己的微信 ID 时最多读取的消息页数和每页消息数量
+	selfSearchPages    = 5
+	selfSearchPageSize = 1000
 )
 
 // initChatRoomCache 初始化群聊缓存
@@ -82,12 +91,21 @@ func (r *Repository) initChatRoomCache(ctx context.Context) error {
 	sort.Strings(chatRoomRemark)
 	sort.Strings(chatRoomNickName)
 
+	// 建立成员到群聊的索引，chatRoomList 已排序，各成员的群聊列表也按名称排序
+	userToChatRooms := make(map[string][]string)
+	for _, name := range chatRoomList {
+		for _, user := range chatRoomMap[name].Users {
+			userToChatRooms[user.UserName] = append(userToChatRooms[user.UserName], name)
+		}
+	}
+
 	r.chatRoomCache = chatRoomMap
 	r.remarkToChatRoom = remarkToChatRoom
 	r.nickNameToChatRoom = nickNameToChatRoom
 	r.chatRoomList = chatRoomList
 	r.chatRoomRemark = chatRoomRemark
 	r.chatRoomNickName = chatRoomNickName
+	r.userToChatRooms = userToChatRooms
 
 	return nil
 }
@@ -139,6 +157,86 @@ func (r *Repository) GetChatRoom(ctx context.Context, key string) (*model.ChatRo
 	return chatRoom, nil
 }
 
+// GetChatRoomDetail 获取群聊详情，包括完整的成员列表和自己的群昵称
+func (r *Repository) GetChatRoomDetail(ctx context.Context, key string) (*model.ChatRoomDetail, error) {
+	chatRoom := r.findChatRoom(key)
+	if chatRoom == nil {
+		return nil, errors.ChatRoomNotFound(key)
+	}
+
+	detail := &model.ChatRoomDetail{
+		Name:         chatRoom.Name,
+		Remark:       chatRoom.Remark,
+		NickName:     chatRoom.NickName,
+		Owner:        chatRoom.Owner,
+		SelfUserName: r.findSelfInChatRoom(ctx, chatRoom),
+		Members:      make([]*model.ChatRoomMember, 0, len(chatRoom.Users)),
+	}
+	for _, user := range chatRoom.Users {
+		member := &model.ChatRoomMember{
+			UserName:    user.UserName,
+			DisplayName: user.DisplayName,
+			IsOwner:     user.UserName == chatRoom.Owner,
+			IsSelf:      user.UserName == detail.SelfUserName,
+		}
+		if contact := r.getFullContact(user.UserName); contact != nil {
+			member.Alias = contact.Alias
+			member.Remark = contact.Remark
+			member.NickName = contact.NickName
+			member.IsFriend = contact.IsFriend
+		}
+		if member.IsOwner {
+			detail.OwnerName = member.Name()
+		}
+		if member.IsSelf {
+			detail.SelfDisplayName = member.Name()
+		}
+		detail.Members = append(detail.Members, member)
+	}
+	return detail, nil
+}
+
+// findSelfInChatRoom 通过自己发送的消息确定自己的微信 ID，无法确定时返回空字符串
+// 结果会被缓存，之后查询其他群聊时直接使用
+func (r *Repository) findSelfInChatRoom(ctx context.Context, chatRoom *model.ChatRoom) string {
+	members := make(map[string]bool, len(chatRoom.Users))
+	for _, user := range chatRoom.Users {
+		members[user.UserName] = true
+	}
+	r.selfMu.Lock()
+	self := r.selfUserName
+	r.selfMu.Unlock()
+	if self != "" {
+		if members[self] {
+			return self
+		}
+		return ""
+	}
+
+	var cursor *model.Cursor
+	for i := 0; i < selfSearchPages; i++ {
+		messages, next, err := r.ds.GetMessagesByCursor(ctx, time.Unix(0, 0), time.Now(), chatRoom.Name, "", "", cursor, selfSearchPageSize)
+		if err != nil {
+			log.Debug().Err(err).Msgf("find self in chat room failed: %s", chatRoom.Name)
+			return ""
+		}
+		for _, m := range messages {
+			// 发送者需为群成员，避免消息状态误判
+			if m.IsSelf && members[m.Sender] {
+				r.selfMu.Lock()
+				r.selfUserName = m.Sender
+				r.selfMu.Unlock()
+				return m.Sender
+			}
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	return ""
+}
+
 // enrichChatRoom 从联系人信息中补充群聊信息
 func (r *Repository) enrichChatRoom(chatRoom *model.ChatRoom) {
 	if contact, ok := r.contactCache[chatRoom.Name]; ok {
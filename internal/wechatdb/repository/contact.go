@@ -98,6 +98,30 @@ func (r *Repository) GetContact(ctx context.Context, key string) (*model.Contact
 	return contact, nil
 }
 
+// GetContactDetail 获取联系人详情，包括与联系人共同所在的群聊
+func (r *Repository) GetContactDetail(ctx context.Context, key string) (*model.ContactDetail, error) {
+	contact := r.findContact(key)
+	if contact == nil {
+		return nil, errors.ContactNotFound(key)
+	}
+
+	detail := &model.ContactDetail{
+		Contact:   contact,
+		ChatRooms: make([]*model.ContactChatRoom, 0),
+	}
+	for _, name := range r.userToChatRooms[contact.UserName] {
+		chatRoom := r.chatRoomCache[name]
+		detail.ChatRooms = append(detail.ChatRooms, &model.ContactChatRoom{
+			Name:        chatRoom.Name,
+			DisplayName: chatRoom.DisplayName(),
+			UserCount:   len(chatRoom.Users),
+			MemberName:  chatRoom.User2DisplayName[contact.UserName],
+			IsOwner:     chatRoom.Owner == contact.UserName,
+		})
+	}
+	return detail, nil
+}
+
 func (r *Repository) GetContacts(ctx context.Context, key string, limit, offset int) ([]*model.Contact, error) {
 	ret := make([]*model.Contact, 0)
 	if key != "" {
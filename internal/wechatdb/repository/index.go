@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/internal/wechatdb/index"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+// indexBatchSize 构建索引时每次写入的消息数量
+const indexBatchSize = 1000
+
+// SearchResult 全文检索结果
+type SearchResult struct {
+	Message *model.Message `json:"message"`
+	Score   float64        `json:"score"`
+	Snippet string         `json:"snippet"`
+}
+
+// EnableIndex 启用全文索引
+// 启用后在后台构建索引，并在消息数据库重新解密后增量更新
+func (r *Repository) EnableIndex(idx *index.Index) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.idx = idx
+	r.idxCancel = cancel
+	r.idxTrigger = make(chan struct{}, 1)
+
+	if err := r.ds.SetCallback("message", r.messageCallback); err != nil {
+		log.Debug().Err(err).Msg("set index callback failed")
+	}
+
+	go r.indexLoop(ctx)
+	r.triggerIndexUpdate()
+}
+
+func (r *Repository) messageCallback(event fsnotify.Event) error {
+	if !event.Op.Has(fsnotify.Create) {
+		return nil
+	}
+	r.triggerIndexUpdate()
+	return nil
+}
+
+// triggerIndexUpdate 通知后台更新索引，更新进行中时合并为一次
+func (r *Repository) triggerIndexUpdate() {
+	select {
+	case r.idxTrigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Repository) indexLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.idxTrigger:
+			start := time.Now()
+			if err := r.UpdateIndex(ctx); err != nil {
+				log.Err(err).Msg("update search index failed")
+				continue
+			}
+			log.Debug().Msgf("search index updated in %s", time.Since(start))
+		}
+	}
+}
+
+// UpdateIndex 将最近会话中尚未索引的消息写入索引
+func (r *Repository) UpdateIndex(ctx context.Context) error {
+	sessions, err := r.ds.GetSessions(ctx, "", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		state, err := r.idx.State(ctx, session.UserName)
+		if err != nil {
+			return err
+		}
+
+		start := time.Unix(0, 0)
+		if state != nil {
+			if !session.NTime.After(state.LastTime) {
+				continue
+			}
+			// 同一秒内可能还有未索引的消息，通过 Seq 去重
+			start = state.LastTime
+		}
+
+		// 逐条读取消息，每 indexBatchSize 条写入一次索引，避免一次读取整个对话的历史消息
+		pending := make([]*model.Message, 0, indexBatchSize)
+		var addErr error
+		err = r.ds.WalkMessages(ctx, start, time.Now(), session.UserName, "", "", func(m *model.Message) bool {
+			if state != nil && m.Seq <= state.LastSeq {
+				return true
+			}
+			// 索引中不保存媒体链接的 host
+			m.SetContent("host", "")
+			pending = append(pending, m)
+			if len(pending) < indexBatchSize {
+				return true
+			}
+			addErr = r.idx.Add(ctx, session.UserName, pending)
+			pending = pending[:0]
+			return addErr == nil
+		})
+		if addErr != nil {
+			return addErr
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Debug().Err(err).Msgf("get messages for index failed: %s", session.UserName)
+			continue
+		}
+		if err := r.idx.Add(ctx, session.UserName, pending); err != nil {
+			return err
+		}
+	}
+
+	if !r.idx.Ready() {
+		return r.idx.SetReady()
+	}
+	return nil
+}
+
+// useIndex 判断是否可以使用全文索引完成查询
+// 索引仅用于不指定聊天对象的关键词查询，关键词为正则表达式时仍使用数据源逐条匹配
+func (r *Repository) useIndex(talker, keyword string) bool {
+	return r.idx != nil && r.idx.Ready() &&
+		talker == "" && keyword != "" &&
+		regexp.QuoteMeta(keyword) == keyword &&
+		index.MatchQuery(keyword) != ""
+}
+
+// SearchMessages 使用全文索引检索消息，结果按相关度排序
+func (r *Repository) SearchMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*SearchResult, int, error) {
+	if r.idx == nil || !r.idx.Ready() {
+		return nil, 0, errors.ErrIndexNotReady
+	}
+
+	talker, sender, err := r.parseTalkerAndSender(ctx, talker, sender)
+	if err != nil {
+		return nil, 0, err
+	}
+	hits, total, err := r.idx.Search(ctx, &index.Query{
+		Keyword: keyword,
+		Talkers: util.Str2List(talker, ","),
+		Senders: util.Str2List(sender, ","),
+		Start:   startTime,
+		End:     endTime,
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]*SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, &SearchResult{
+			Message: r.hitMessage(ctx, hit),
+			Score:   hit.Score,
+			Snippet: hit.Snippet,
+		})
+	}
+	return results, total, nil
+}
+
+// searchMessages 使用全文索引完成 GetMessages 查询，结果按消息顺序排列
+func (r *Repository) searchMessages(ctx context.Context, startTime, endTime time.Time, sender string, keyword string, cursor *model.Cursor, limit, offset int) ([]*model.Message, error) {
+	_, sender, err := r.parseTalkerAndSender(ctx, "", sender)
+	if err != nil {
+		return nil, err
+	}
+	hits, _, err := r.idx.Search(ctx, &index.Query{
+		Keyword:    keyword,
+		Senders:    util.Str2List(sender, ","),
+		Start:      startTime,
+		End:        endTime,
+		Limit:      limit,
+		Offset:     offset,
+		OrderBySeq: true,
+		After:      cursor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*model.Message, 0, len(hits))
+	for _, hit := range hits {
+		messages = append(messages, r.hitMessage(ctx, hit))
+	}
+	return messages, nil
+}
+
+// hitMessage 获取检索结果对应的消息
+// 文本消息直接使用索引中的内容，其余消息从数据源重新获取，获取失败时使用索引中的内容
+func (r *Repository) hitMessage(ctx context.Context, hit *index.Hit) *model.Message {
+	if hit.Type != 1 {
+		messages, err := r.ds.GetMessages(ctx, hit.Time.Add(-time.Second), hit.Time.Add(time.Second), hit.Talker, "", "", 0, 0)
+		if err == nil {
+			for _, m := range messages {
+				if m.Seq == hit.Seq {
+					r.enrichMessage(m)
+					return m
+				}
+			}
+		}
+	}
+	m := hit.Message()
+	r.enrichMessage(m)
+	return m
+}
+
+// closeIndex 停止后台更新并关闭索引
+func (r *Repository) closeIndex() error {
+	if r.idx == nil {
+		return nil
+	}
+	r.idxCancel()
+	return r.idx.Close()
+}
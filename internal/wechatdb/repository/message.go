@@ -2,19 +2,31 @@ package repository
 
 import (
 	"context"
+	"math"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
-	"github.com/sjzar/chatlog/pkg/util"
 
 	"github.com/rs/zerolog/log"
 )
 
+// MaxContextSize 消息上下文前后消息数量的上限
+const MaxContextSize = 500
+
 // GetMessages 实现 Repository 接口的 GetMessages 方法
 func (r *Repository) GetMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
 
-	talker, sender = r.parseTalkerAndSender(ctx, talker, sender)
+	if r.useIndex(talker, keyword) {
+		return r.searchMessages(ctx, startTime, endTime, sender, keyword, nil, limit, offset)
+	}
+
+	talker, sender, err := r.parseTalkerAndSender(ctx, talker, sender)
+	if err != nil {
+		return nil, err
+	}
 	messages, err := r.ds.GetMessages(ctx, startTime, endTime, talker, sender, keyword, limit, offset)
 	if err != nil {
 		return nil, err
@@ -28,6 +40,94 @@ func (r *Repository) GetMessages(ctx context.Context, startTime, endTime time.Ti
 	return messages, nil
 }
 
+// GetMessagesByCursor 从游标之后开始查询消息，返回下一页的游标，没有更多消息时游标为 nil
+func (r *Repository) GetMessagesByCursor(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, cursor *model.Cursor, limit int) ([]*model.Message, *model.Cursor, error) {
+
+	if r.useIndex(talker, keyword) {
+		messages, err := r.searchMessages(ctx, startTime, endTime, sender, keyword, cursor, limit, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		if limit <= 0 || len(messages) < limit {
+			return messages, nil, nil
+		}
+		// 全文索引不区分数据库分片
+		return messages, model.NewCursor(messages[len(messages)-1], 0), nil
+	}
+
+	talker, sender, err := r.parseTalkerAndSender(ctx, talker, sender)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages, next, err := r.ds.GetMessagesByCursor(ctx, startTime, endTime, talker, sender, keyword, cursor, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 补充消息信息
+	if err := r.EnrichMessages(ctx, messages); err != nil {
+		log.Debug().Msgf("EnrichMessages failed: %v", err)
+	}
+
+	return messages, next, nil
+}
+
+// GetMessageContext 获取聊天中指定消息前后的消息
+func (r *Repository) GetMessageContext(ctx context.Context, talker string, seq int64, before, after int) ([]*model.Message, error) {
+	talker, err := r.resolveTalker(talker)
+	if err != nil {
+		return nil, err
+	}
+	if talker == "" || strings.Contains(talker, ",") {
+		return nil, errors.InvalidArg("talker")
+	}
+
+	before, after = clampContextSize(before), clampContextSize(after)
+	messages, err := r.ds.GetMessageContext(ctx, talker, seq, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	// 补充消息信息
+	if err := r.EnrichMessages(ctx, messages); err != nil {
+		log.Debug().Msgf("EnrichMessages failed: %v", err)
+	}
+
+	return messages, nil
+}
+
+// GetMessageContextByTime 获取聊天中指定时间前后的消息
+// 以该时间及之后的第一条消息为中心，之后没有消息时返回该时间之前的消息
+func (r *Repository) GetMessageContextByTime(ctx context.Context, talker string, t time.Time, before, after int) ([]*model.Message, error) {
+	talker, err := r.resolveTalker(talker)
+	if err != nil {
+		return nil, err
+	}
+	if talker == "" || strings.Contains(talker, ",") {
+		return nil, errors.InvalidArg("talker")
+	}
+
+	// 各版本的 Seq 编码方式不同，通过数据源按时间找到第一条消息
+	var anchor *model.Message
+	err = r.ds.WalkMessages(ctx, t, time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), talker, "", "", func(m *model.Message) bool {
+		anchor = m
+		return false
+	})
+	// 该时间之后没有数据库分片时返回 404，按没有消息处理
+	if err != nil && errors.GetCode(err) != http.StatusNotFound {
+		return nil, err
+	}
+	if anchor == nil {
+		return r.GetMessageContext(ctx, talker, math.MaxInt64, before, 0)
+	}
+	return r.GetMessageContext(ctx, talker, anchor.Seq, before, after)
+}
+
+// clampContextSize 将消息上下文的前后消息数量限制在 [0, MaxContextSize] 范围内
+func clampContextSize(n int) int {
+	return max(0, min(n, MaxContextSize))
+}
+
 // EnrichMessages 补充消息的额外信息
 func (r *Repository) EnrichMessages(ctx context.Context, messages []*model.Message) error {
 	for _, msg := range messages {
@@ -59,53 +159,3 @@ func (r *Repository) enrichMessage(msg *model.Message) {
 		}
 	}
 }
-
-func (r *Repository) parseTalkerAndSender(ctx context.Context, talker, sender string) (string, string) {
-	displayName2User := make(map[string]string)
-	users := make(map[string]bool)
-
-	talkers := util.Str2List(talker, ",")
-	if len(talkers) > 0 {
-		for i := 0; i < len(talkers); i++ {
-			if contact, _ := r.GetContact(ctx, talkers[i]); contact != nil {
-				talkers[i] = contact.UserName
-			} else if chatRoom, _ := r.GetChatRoom(ctx, talker); chatRoom != nil {
-				talkers[i] = chatRoom.Name
-			}
-		}
-		// 获取群聊的用户列表
-		for i := 0; i < len(talkers); i++ {
-			if chatRoom, _ := r.GetChatRoom(ctx, talkers[i]); chatRoom != nil {
-				for user, displayName := range chatRoom.User2DisplayName {
-					displayName2User[displayName] = user
-				}
-				for _, user := range chatRoom.Users {
-					users[user.UserName] = true
-				}
-			}
-		}
-		talker = strings.Join(talkers, ",")
-	}
-
-	senders := util.Str2List(sender, ",")
-	if len(senders) > 0 {
-		for i := 0; i < len(senders); i++ {
-			if user, ok := displayName2User[senders[i]]; ok {
-				senders[i] = user
-			} else {
-				// FIXME 大量群聊用户名称重复，无法直接通过 GetContact 获取 ID，后续再优化
-				for user := range users {
-					if contact := r.getFullContact(user); contact != nil {
-						if contact.DisplayName() == senders[i] {
-							senders[i] = user
-							break
-						}
-					}
-				}
-			}
-		}
-		sender = strings.Join(senders, ",")
-	}
-
-	return talker, sender
-}
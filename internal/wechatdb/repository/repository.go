@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
@@ -9,6 +10,7 @@ import (
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb/datasource"
+	"github.com/sjzar/chatlog/internal/wechatdb/index"
 )
 
 // Repository 实现了 repository.Repository 接口
@@ -33,9 +35,20 @@ type Repository struct {
 	chatRoomList       []string
 	chatRoomRemark     []string
 	chatRoomNickName   []string
+	userToChatRooms    map[string][]string // 成员所在的群聊
 
 	// 快速查找索引
 	chatRoomUserToInfo map[string]*model.Contact
+
+	// 自己的微信 ID，通过群聊中自己发送的消息确定，未确定时为空
+	// 并发查询群聊时可能同时读写，由 selfMu 保护
+	selfUserName string
+	selfMu       sync.Mutex
+
+	// 全文索引，未启用时为 nil
+	idx        *index.Index
+	idxTrigger chan struct{}
+	idxCancel  context.CancelFunc
 }
 
 // New 创建一个新的 Repository
@@ -57,6 +70,7 @@ func New(ds datasource.DataSource) (*Repository, error) {
 		chatRoomList:       make([]string, 0),
 		chatRoomRemark:     make([]string, 0),
 		chatRoomNickName:   make([]string, 0),
+		userToChatRooms:    make(map[string][]string),
 	}
 
 	// 初始化缓存
@@ -107,5 +121,8 @@ func (r *Repository) chatroomCallback(event fsnotify.Event) error {
 
 // Close 实现 Repository 接口的 Close 方法
 func (r *Repository) Close() error {
+	if err := r.closeIndex(); err != nil {
+		log.Debug().Err(err).Msg("close search index failed")
+	}
 	return r.ds.Close()
 }
@@ -0,0 +1,343 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+// 名称匹配得分，按匹配程度由高到低排列
+const (
+	scoreID             = 100 // 微信 ID 或微信号一致
+	scoreName           = 90  // 名称一致
+	scorePinyin         = 80  // 全拼一致
+	scoreNamePrefix     = 70  // 名称前缀
+	scoreInitials       = 65  // 拼音首字母一致
+	scorePinyinPrefix   = 60  // 全拼前缀
+	scoreNameContains   = 50  // 名称包含
+	scoreInitialsPrefix = 45  // 拼音首字母前缀
+)
+
+// MaxCandidates 名称存在歧义时返回的候选数量上限
+const MaxCandidates = 10
+
+type matchKind int
+
+const (
+	matchID matchKind = iota
+	matchName
+	matchPinyin
+	matchInitials
+)
+
+// nameField 参与名称匹配的字段
+type nameField struct {
+	name  string
+	value string
+	kind  matchKind
+}
+
+// Resolve 按名称查找联系人、群聊或群成员，结果按匹配程度排序
+// 名称支持微信 ID、微信号、备注、昵称、群昵称，以及备注和昵称的全拼与拼音首字母
+// 指定 talker 时只在该群聊的成员中查找
+func (r *Repository) Resolve(ctx context.Context, key string, talker string, limit int) ([]*model.Candidate, error) {
+	key = normalizeName(key)
+	if key == "" {
+		return nil, errors.InvalidArg("key")
+	}
+
+	var candidates []*model.Candidate
+	if talker != "" {
+		talker, err := r.resolveTalker(talker)
+		if err != nil {
+			return nil, err
+		}
+		chatRoom, ok := r.chatRoomCache[talker]
+		if !ok {
+			return nil, errors.ChatRoomNotFound(talker)
+		}
+		candidates = r.memberCandidates(key, []*model.ChatRoom{chatRoom})
+	} else {
+		candidates = r.talkerCandidates(key)
+	}
+
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+// parseTalkerAndSender 将名称形式的 talker 和 sender 解析为微信 ID，多个值以英文逗号分隔
+// talker 中包含群聊时，sender 只在这些群聊的成员中查找，以区分不同群聊中的同名成员
+// 名称存在歧义时返回包含候选列表的错误，找不到匹配时保留原值
+func (r *Repository) parseTalkerAndSender(ctx context.Context, talker, sender string) (string, string, error) {
+	talker, err := r.resolveTalker(talker)
+	if err != nil {
+		return "", "", err
+	}
+
+	senders := util.Str2List(sender, ",")
+	if len(senders) == 0 {
+		return talker, sender, nil
+	}
+
+	chatRooms := make([]*model.ChatRoom, 0)
+	for _, t := range util.Str2List(talker, ",") {
+		if chatRoom, ok := r.chatRoomCache[t]; ok && len(chatRoom.Users) > 0 {
+			chatRooms = append(chatRooms, chatRoom)
+		}
+	}
+
+	for i, s := range senders {
+		key := normalizeName(s)
+		var candidates []*model.Candidate
+		if len(chatRooms) > 0 {
+			candidates = r.memberCandidates(key, chatRooms)
+		} else {
+			candidates = r.contactCandidates(key, func(c *model.Contact) bool {
+				return !strings.HasSuffix(c.UserName, "@chatroom")
+			})
+		}
+		if senders[i], err = pickCandidate(s, candidates); err != nil {
+			return "", "", err
+		}
+	}
+
+	return talker, strings.Join(senders, ","), nil
+}
+
+// resolveTalker 将名称形式的 talker 解析为微信 ID，多个值以英文逗号分隔
+func (r *Repository) resolveTalker(talker string) (string, error) {
+	talkers := util.Str2List(talker, ",")
+	if len(talkers) == 0 {
+		return talker, nil
+	}
+
+	var err error
+	for i, t := range talkers {
+		if _, ok := r.contactCache[t]; ok {
+			continue
+		}
+		if _, ok := r.chatRoomCache[t]; ok {
+			continue
+		}
+		if talkers[i], err = pickCandidate(t, r.talkerCandidates(normalizeName(t))); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(talkers, ","), nil
+}
+
+// talkerCandidates 在联系人和群聊中查找
+// 优先匹配好友和群聊，没有匹配时再查找非好友的群成员
+func (r *Repository) talkerCandidates(key string) []*model.Candidate {
+	candidates := r.contactCandidates(key, func(c *model.Contact) bool { return c.IsFriend })
+
+	// 未保存到通讯录的群聊只存在于群聊缓存中
+	for _, chatRoom := range r.chatRoomCache {
+		if contact, ok := r.contactCache[chatRoom.Name]; ok && contact.IsFriend {
+			continue
+		}
+		fields := []nameField{
+			{"name", chatRoom.Name, matchID},
+			{"remark", chatRoom.Remark, matchName},
+			{"nickName", chatRoom.NickName, matchName},
+		}
+		if f, score := bestMatch(key, fields); score > 0 {
+			candidates = append(candidates, &model.Candidate{
+				UserName:    chatRoom.Name,
+				DisplayName: chatRoom.DisplayName(),
+				Kind:        model.CandidateChatRoom,
+				Field:       f.name,
+				Matched:     f.value,
+				Score:       score,
+			})
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = r.contactCandidates(key, func(c *model.Contact) bool { return !c.IsFriend })
+	}
+	sortCandidates(candidates)
+	return candidates
+}
+
+// contactCandidates 在满足 filter 的联系人中查找
+func (r *Repository) contactCandidates(key string, filter func(c *model.Contact) bool) []*model.Candidate {
+	candidates := make([]*model.Candidate, 0)
+	for _, contact := range r.contactCache {
+		if !filter(contact) {
+			continue
+		}
+		f, score := bestMatch(key, contactFields(contact))
+		if score == 0 {
+			continue
+		}
+		kind := model.CandidateContact
+		if strings.HasSuffix(contact.UserName, "@chatroom") {
+			kind = model.CandidateChatRoom
+		}
+		candidates = append(candidates, &model.Candidate{
+			UserName:    contact.UserName,
+			DisplayName: contact.DisplayName(),
+			Kind:        kind,
+			Field:       f.name,
+			Matched:     f.value,
+			Score:       score,
+		})
+	}
+	sortCandidates(candidates)
+	return candidates
+}
+
+// memberCandidates 在群聊成员中查找，群昵称同样参与匹配
+// 成员同时在多个群聊中时只保留得分最高的一次
+func (r *Repository) memberCandidates(key string, chatRooms []*model.ChatRoom) []*model.Candidate {
+	found := make(map[string]*model.Candidate)
+	for _, chatRoom := range chatRooms {
+		for _, user := range chatRoom.Users {
+			groupName := chatRoom.User2DisplayName[user.UserName]
+			fields := []nameField{{"displayName", groupName, matchName}}
+			displayName := groupName
+			if contact := r.getFullContact(user.UserName); contact != nil {
+				fields = append(fields, contactFields(contact)...)
+				if displayName == "" {
+					displayName = contact.DisplayName()
+				}
+			} else {
+				fields = append(fields, nameField{"userName", user.UserName, matchID})
+			}
+
+			f, score := bestMatch(key, fields)
+			if score == 0 {
+				continue
+			}
+			if c, ok := found[user.UserName]; ok && c.Score >= score {
+				continue
+			}
+			found[user.UserName] = &model.Candidate{
+				UserName:    user.UserName,
+				DisplayName: displayName,
+				Kind:        model.CandidateMember,
+				Field:       f.name,
+				Matched:     f.value,
+				Score:       score,
+			}
+		}
+	}
+
+	candidates := make([]*model.Candidate, 0, len(found))
+	for _, c := range found {
+		candidates = append(candidates, c)
+	}
+	sortCandidates(candidates)
+	return candidates
+}
+
+// pickCandidate 从候选中确定目标，没有候选时返回原值
+// 只有一个候选，或得分最高的候选是唯一的微信 ID、名称或全拼完全匹配时直接选择
+// 其他情况 (前缀、包含、拼音首字母匹配或得分相同) 无法确定目标，返回包含候选列表的错误
+func pickCandidate(key string, candidates []*model.Candidate) (string, error) {
+	if len(candidates) == 0 {
+		return key, nil
+	}
+	top := candidates[0]
+	exact := top.Score >= scorePinyin
+	if len(candidates) == 1 || (exact && candidates[1].Score != top.Score) {
+		return top.UserName, nil
+	}
+
+	// 完全匹配的候选得分相同时只列出这些候选
+	list := make([]string, 0, MaxCandidates)
+	for _, c := range candidates {
+		if (exact && c.Score != top.Score) || len(list) == MaxCandidates {
+			break
+		}
+		list = append(list, c.String())
+	}
+	return "", errors.AmbiguousName(key, list)
+}
+
+func contactFields(c *model.Contact) []nameField {
+	return []nameField{
+		{"userName", c.UserName, matchID},
+		{"alias", c.Alias, matchID},
+		{"remark", c.Remark, matchName},
+		{"nickName", c.NickName, matchName},
+		{"remarkQuanPin", c.RemarkQuanPin, matchPinyin},
+		{"quanPin", c.QuanPin, matchPinyin},
+		{"remarkPYInitial", c.RemarkPYInitial, matchInitials},
+		{"pyInitial", c.PYInitial, matchInitials},
+	}
+}
+
+// bestMatch 返回得分最高的字段及其得分，均不匹配时得分为 0
+func bestMatch(key string, fields []nameField) (nameField, int) {
+	var best nameField
+	bestScore := 0
+	for _, f := range fields {
+		if score := matchScore(key, f); score > bestScore {
+			best, bestScore = f, score
+		}
+	}
+	return best, bestScore
+}
+
+// matchScore 计算 key 与字段的匹配得分，key 需已经过 normalizeName 处理
+func matchScore(key string, f nameField) int {
+	value := normalizeName(f.value)
+	if value == "" {
+		return 0
+	}
+	switch f.kind {
+	case matchID:
+		if value == key {
+			return scoreID
+		}
+	case matchName:
+		switch {
+		case value == key:
+			return scoreName
+		case strings.HasPrefix(value, key):
+			return scoreNamePrefix
+		case strings.Contains(value, key):
+			return scoreNameContains
+		}
+	case matchPinyin:
+		switch {
+		case value == key:
+			return scorePinyin
+		case strings.HasPrefix(value, key):
+			return scorePinyinPrefix
+		}
+	case matchInitials:
+		switch {
+		case value == key:
+			return scoreInitials
+		case strings.HasPrefix(value, key):
+			return scoreInitialsPrefix
+		}
+	}
+	return 0
+}
+
+// normalizeName 统一为小写并去除空白，全拼字段中可能以空格分隔
+func normalizeName(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), ""))
+}
+
+func sortCandidates(candidates []*model.Candidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if candidates[i].DisplayName != candidates[j].DisplayName {
+			return candidates[i].DisplayName < candidates[j].DisplayName
+		}
+		return candidates[i].UserName < candidates[j].UserName
+	})
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// newTestRepository 创建只包含联系人和群聊缓存的 Repository
+func newTestRepository(contacts []*model.Contact, chatRooms []*model.ChatRoom) *Repository {
+	r := &Repository{
+		contactCache:       make(map[string]*model.Contact),
+		chatRoomCache:      make(map[string]*model.ChatRoom),
+		chatRoomUserToInfo: make(map[string]*model.Contact),
+	}
+	for _, c := range contacts {
+		r.contactCache[c.UserName] = c
+	}
+	for _, c := range chatRooms {
+		r.chatRoomCache[c.Name] = c
+	}
+	return r
+}
+
+func TestResolveName(t *testing.T) {
+	r := newTestRepository(
+		[]*model.Contact{
+			{UserName: "wxid_zhangsan", Alias: "zs001", NickName: "张三", QuanPin: "zhangsan", PYInitial: "zs", IsFriend: true},
+			{UserName: "wxid_zhangsanfeng", NickName: "张三丰", QuanPin: "zhangsanfeng", PYInitial: "zsf", IsFriend: true},
+			{UserName: "wxid_lisi", NickName: "李四", QuanPin: "lisi", PYInitial: "ls", IsFriend: true},
+			{UserName: "wxid_lisi2", Remark: "李四", RemarkQuanPin: "lisi", RemarkPYInitial: "ls", IsFriend: true},
+			{UserName: "wxid_wangwu", NickName: "王五", QuanPin: "wangwu", PYInitial: "ww", IsFriend: true},
+		},
+		[]*model.ChatRoom{
+			{
+				Name:  "123@chatroom",
+				Users: []model.ChatRoomUser{{UserName: "wxid_zhangsanfeng"}, {UserName: "wxid_wangwu"}, {UserName: "wxid_member"}},
+				User2DisplayName: map[string]string{
+					"wxid_member": "老张",
+				},
+			},
+		},
+	)
+
+	tests := []struct {
+		name    string
+		talker  string // 不为空时在该群聊的成员中解析 sender
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{name: "exact id", key: "zs001", want: "wxid_zhangsan"},
+		{name: "exact name over prefix", key: "张三", want: "wxid_zhangsan"},
+		{name: "exact pinyin over pinyin prefix", key: "Zhang San", want: "wxid_zhangsan"},
+		{name: "ambiguous name prefix", key: "张", wantErr: true},
+		{name: "single name prefix", key: "王", want: "wxid_wangwu"},
+		{name: "ambiguous pinyin prefix", key: "zhang", wantErr: true},
+		{name: "initials are not exact", key: "zs", wantErr: true},
+		{name: "single initials", key: "ww", want: "wxid_wangwu"},
+		{name: "tie on exact name", key: "李四", wantErr: true},
+		{name: "no match keeps key", key: "nobody", want: "nobody"},
+		{name: "ambiguous member name", talker: "123@chatroom", key: "张", wantErr: true},
+		{name: "single member name substring", talker: "123@chatroom", key: "三", want: "wxid_zhangsanfeng"},
+		{name: "member group display name", talker: "123@chatroom", key: "老张", want: "wxid_member"},
+		{name: "member initials", talker: "123@chatroom", key: "zs", want: "wxid_zhangsanfeng"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			var err error
+			if tt.talker != "" {
+				_, got, err = r.parseTalkerAndSender(context.Background(), tt.talker, tt.key)
+			} else {
+				got, err = r.resolveTalker(tt.key)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve %q error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolve %q = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// GetStats 统计聊天记录，依次读取每个消息表并逐条累计，不保留原始消息
+// talker 为空时统计所有聊天；sender 指定两人时可统计两人之间的回复时间
+func (r *Repository) GetStats(ctx context.Context, startTime, endTime time.Time, talker string, sender string, top int) (*model.Stats, error) {
+	talker, sender, err := r.parseTalkerAndSender(ctx, talker, sender)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := model.NewStatsBuilder()
+	err = r.ds.WalkMessages(ctx, startTime, endTime, talker, sender, "", func(m *model.Message) bool {
+		r.enrichMessage(m)
+		builder.Add(m)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.Build(top), nil
+}
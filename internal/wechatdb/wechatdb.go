@@ -4,8 +4,13 @@ import (
 	"context"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb/datasource"
+	"github.com/sjzar/chatlog/internal/wechatdb/index"
 	"github.com/sjzar/chatlog/internal/wechatdb/repository"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -54,12 +59,23 @@ func (w *DB) Initialize() error {
 		return err
 	}
 
+	// 全文索引不可用时 (如未启用 FTS5) 仍可正常查询，仅无法使用索引加速
+	idx, err := index.Open(w.path)
+	if err != nil {
+		log.Warn().Err(err).Msg("open search index failed, full-text search disabled")
+		return nil
+	}
+	w.repo.EnableIndex(idx)
+
 	return nil
 }
 
-func (w *DB) GetMessages(start, end time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
-	ctx := context.Background()
+// SetCallback 设置数据库文件变更的回调函数，name 为 message、contact、chatroom 或 session
+func (w *DB) SetCallback(name string, callback func(event fsnotify.Event) error) error {
+	return w.ds.SetCallback(name, callback)
+}
 
+func (w *DB) GetMessages(ctx context.Context, start, end time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
 	// 使用 repository 获取消息
 	messages, err := w.repo.GetMessages(ctx, start, end, talker, sender, keyword, limit, offset)
 	if err != nil {
@@ -69,13 +85,67 @@ func (w *DB) GetMessages(start, end time.Time, talker string, sender string, key
 	return messages, nil
 }
 
+// GetMessageContext 获取聊天中指定消息前后的消息
+func (w *DB) GetMessageContext(ctx context.Context, talker string, seq int64, before, after int) ([]*model.Message, error) {
+	return w.repo.GetMessageContext(ctx, talker, seq, before, after)
+}
+
+// GetMessageContextByTime 获取聊天中指定时间前后的消息
+func (w *DB) GetMessageContextByTime(ctx context.Context, talker string, t time.Time, before, after int) ([]*model.Message, error) {
+	return w.repo.GetMessageContextByTime(ctx, talker, t, before, after)
+}
+
+type GetMessagesResp struct {
+	Items      []*model.Message `json:"items"`
+	NextCursor string           `json:"next_cursor"`
+}
+
+// GetMessagesByCursor 从游标之后开始查询消息，cursor 为空时从头开始，没有更多消息时 NextCursor 为空
+func (w *DB) GetMessagesByCursor(ctx context.Context, start, end time.Time, talker string, sender string, keyword string, cursor string, limit int) (*GetMessagesResp, error) {
+	c, err := model.ParseCursor(cursor)
+	if err != nil {
+		return nil, errors.InvalidArg("cursor")
+	}
+
+	messages, next, err := w.repo.GetMessagesByCursor(ctx, start, end, talker, sender, keyword, c, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetMessagesResp{
+		Items:      messages,
+		NextCursor: next.String(),
+	}, nil
+}
+
+type SearchMessagesResp struct {
+	Items []*repository.SearchResult `json:"items"`
+	Total int                        `json:"total"`
+}
+
+// SearchMessages 使用全文索引检索消息，结果按相关度排序
+func (w *DB) SearchMessages(ctx context.Context, start, end time.Time, talker string, sender string, keyword string, limit, offset int) (*SearchMessagesResp, error) {
+	items, total, err := w.repo.SearchMessages(ctx, start, end, talker, sender, keyword, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchMessagesResp{
+		Items: items,
+		Total: total,
+	}, nil
+}
+
+// GetStats 统计聊天记录
+func (w *DB) GetStats(ctx context.Context, start, end time.Time, talker string, sender string, top int) (*model.Stats, error) {
+	return w.repo.GetStats(ctx, start, end, talker, sender, top)
+}
+
 type GetContactsResp struct {
 	Items []*model.Contact `json:"items"`
 }
 
-func (w *DB) GetContacts(key string, limit, offset int) (*GetContactsResp, error) {
-	ctx := context.Background()
-
+func (w *DB) GetContacts(ctx context.Context, key string, limit, offset int) (*GetContactsResp, error) {
 	contacts, err := w.repo.GetContacts(ctx, key, limit, offset)
 	if err != nil {
 		return nil, err
@@ -86,13 +156,19 @@ func (w *DB) GetContacts(key string, limit, offset int) (*GetContactsResp, error
 	}, nil
 }
 
+func (w *DB) GetContactDetail(ctx context.Context, key string) (*model.ContactDetail, error) {
+	return w.repo.GetContactDetail(ctx, key)
+}
+
+func (w *DB) Resolve(ctx context.Context, key string, talker string, limit int) ([]*model.Candidate, error) {
+	return w.repo.Resolve(ctx, key, talker, limit)
+}
+
 type GetChatRoomsResp struct {
 	Items []*model.ChatRoom `json:"items"`
 }
 
-func (w *DB) GetChatRooms(key string, limit, offset int) (*GetChatRoomsResp, error) {
-	ctx := context.Background()
-
+func (w *DB) GetChatRooms(ctx context.Context, key string, limit, offset int) (*GetChatRoomsResp, error) {
 	chatRooms, err := w.repo.GetChatRooms(ctx, key, limit, offset)
 	if err != nil {
 		return nil, err
@@ -103,13 +179,15 @@ func (w *DB) GetChatRooms(key string, limit, offset int) (*GetChatRoomsResp, err
 	}, nil
 }
 
+func (w *DB) GetChatRoomDetail(ctx context.Context, key string) (*model.ChatRoomDetail, error) {
+	return w.repo.GetChatRoomDetail(ctx, key)
+}
+
 type GetSessionsResp struct {
 	Items []*model.Session `json:"items"`
 }
 
-func (w *DB) GetSessions(key string, limit, offset int) (*GetSessionsResp, error) {
-	ctx := context.Background()
-
+func (w *DB) GetSessions(ctx context.Context, key string, limit, offset int) (*GetSessionsResp, error) {
 	// 使用 repository 获取会话列表
 	sessions, err := w.repo.GetSessions(ctx, key, limit, offset)
 	if err != nil {
@@ -121,6 +199,6 @@ func (w *DB) GetSessions(key string, limit, offset int) (*GetSessionsResp, error
 	}, nil
 }
 
-func (w *DB) GetMedia(_type string, key string) (*model.Media, error) {
-	return w.repo.GetMedia(context.Background(), _type, key)
+func (w *DB) GetMedia(ctx context.Context, _type string, key string) (*model.Media, error) {
+	return w.repo.GetMedia(ctx, _type, key)
 }